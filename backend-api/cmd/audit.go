@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/galanafai/aroni-backend/internal/audit"
+	"github.com/galanafai/aroni-backend/internal/db"
+)
+
+// runAudit prints an audit report as JSON and returns the process exit code:
+// 0 when the scan log is intact, 1 when tampering was detected, 2 on error.
+func runAudit(store db.Store) int {
+	report, err := audit.Run(context.Background(), store)
+	if err != nil {
+		log.Printf("audit failed: %v", err)
+		return 2
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Printf("failed to write report: %v", err)
+		return 2
+	}
+
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
@@ -1,18 +1,118 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
+	"github.com/galanafai/aroni-backend/internal/anchor"
 	"github.com/galanafai/aroni-backend/internal/db"
 	"github.com/galanafai/aroni-backend/internal/handlers"
+	"github.com/galanafai/aroni-backend/internal/matching"
+	"github.com/galanafai/aroni-backend/internal/ots"
+	"github.com/galanafai/aroni-backend/internal/outbox"
+	"github.com/galanafai/aroni-backend/internal/receipt"
+	"github.com/galanafai/aroni-backend/internal/tsa"
+	"github.com/galanafai/aroni-backend/internal/webhook"
 )
 
 func main() {
 	_ = godotenv.Load()
 
-	db.InitSupabaseClient()
+	// "verify-receipt", "ots-calendar", "tsa", "schema" and
+	// "webhook-receiver" need no store.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify-receipt":
+			os.Exit(runVerifyReceipt(os.Args[2:]))
+		case "ots-calendar":
+			os.Exit(runFakeCalendar(os.Args[2:]))
+		case "tsa":
+			os.Exit(runFakeTSA(os.Args[2:]))
+		case "schema":
+			os.Exit(runSchema(os.Args[2:]))
+		case "webhook-receiver":
+			os.Exit(runWebhookReceiver(os.Args[2:]))
+		}
+	}
+
+	store, err := newStore(os.Getenv("STORE_BACKEND"))
+	if err != nil {
+		log.Fatalf("failed to initialise store: %v", err)
+	}
+
+	// Subcommands: "serve" (default) runs the API, "audit" checks the scan log and exits.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+		case "audit":
+			os.Exit(runAudit(store))
+		default:
+			log.Fatalf("unknown command %q (want serve, audit, verify-receipt, ots-calendar, tsa, schema or webhook-receiver)", os.Args[1])
+		}
+	}
+
+	h := handlers.New(store)
+
+	if path := os.Getenv("MATCH_RULES_FILE"); path != "" {
+		rules, err := matching.LoadRules(path)
+		if err != nil {
+			log.Fatalf("failed to load match rules: %v", err)
+		}
+		h.Rules = rules
+	}
+
+	anchorers, err := newAnchorers(os.Getenv("ANCHOR_BACKENDS"))
+	if err != nil {
+		log.Fatalf("failed to configure anchoring: %v", err)
+	}
+	h.Anchorers = anchorers
+
+	signer, err := newReceiptSigner(os.Getenv("RECEIPT_SIGNING_KEY"))
+	if err != nil {
+		log.Fatalf("failed to load receipt signing key: %v", err)
+	}
+	h.Receipts = signer
+
+	if v := os.Getenv("REQUIRE_DEVICE_SIGNATURES"); v != "" {
+		required, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid REQUIRE_DEVICE_SIGNATURES %q: %v", v, err)
+		}
+		h.RequireDeviceSignatures = required
+	}
+	h.DeviceRegistrationToken = os.Getenv("DEVICE_REGISTRATION_TOKEN")
+	if h.DeviceRegistrationToken == "" {
+		log.Println("⚠️ DEVICE_REGISTRATION_TOKEN not set; anyone can register scanner devices")
+	}
+
+	// Webhooks start first: they wrap h.Store, which everything started
+	// after them then writes through.
+	if err := startWebhooks(h); err != nil {
+		log.Fatalf("failed to start webhooks: %v", err)
+	}
+	if err := startAnchorUpgrader(h); err != nil {
+		log.Fatalf("failed to start anchor upgrader: %v", err)
+	}
+	if err := startScanOutbox(h); err != nil {
+		log.Fatalf("failed to open scan outbox: %v", err)
+	}
+	if err := startAnchorWorker(h); err != nil {
+		log.Fatalf("failed to start anchor worker: %v", err)
+	}
+	if err := startAnchorScheduler(h); err != nil {
+		log.Fatalf("failed to start anchor scheduler: %v", err)
+	}
 
 	e := echo.New()
 
@@ -20,14 +120,382 @@ func main() {
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 
-	e.POST("/api/metadata", handlers.HandleMetadata)
-	e.POST("/api/scan", handlers.HandleScan)
-	e.POST("/api/anchor-batch", handlers.AnchorBatch)
-	e.POST("/api/verify-scan", handlers.VerifyScan)
+	e.POST("/api/metadata", h.HandleMetadata)
+	e.POST("/api/scan", h.HandleScan)
+	e.POST("/api/anchor-batch", h.AnchorBatch)
+	e.POST("/api/verify-scan", h.VerifyScan)
+	e.POST("/api/devices", h.RegisterDevice)
 
-	e.GET("/api/history/:tracking_id", handlers.GetScanHistory)
-	e.GET("/api/proof/:scan_hash", handlers.GetProofForScan)
-	e.GET("/api/scans", handlers.GetAllScanLogs)
+	e.GET("/api/history/:tracking_id", h.GetScanHistory)
+	e.GET("/api/proof/:scan_hash", h.GetProofForScan)
+	e.GET("/api/scans", h.GetAllScanLogs)
+	e.GET("/api/audit", h.RunAudit)
+	e.GET("/api/receipt-key", h.GetReceiptKey)
+	e.GET("/api/devices/:device_id", h.GetDevice)
+	e.GET("/api/batches", h.ListBatches)
+	e.GET("/api/batches/:batch_id", h.GetBatchStatus)
+	e.GET("/api/batches/:batch_id/ots", h.GetBatchOTSProof)
+	e.GET("/api/batches/:batch_id/rfc3161", h.GetBatchTimestampToken)
+	e.GET("/api/anchor-jobs/:id", h.GetAnchorJob)
+	e.GET("/api/outbox", h.GetOutbox)
+	e.GET("/api/schemas", h.ListSchemas)
+	e.GET("/api/schemas/:name", h.GetSchema)
+	e.POST("/api/webhooks", h.CreateWebhook)
+	e.GET("/api/webhooks", h.ListWebhooks)
+	e.DELETE("/api/webhooks/:id", h.DeleteWebhook)
+	e.GET("/api/webhook-deliveries", h.ListWebhookDeliveries)
+	e.GET("/api/webhook-deliveries/:id", h.GetWebhookDelivery)
+	e.POST("/api/webhook-deliveries/:id/replay", h.ReplayWebhookDelivery)
 
 	e.Logger.Fatal(e.Start(":8080"))
 }
+
+// newStore picks the storage backend from STORE_BACKEND ("supabase" by default, "postgres" or "memory").
+func newStore(backend string) (db.Store, error) {
+	switch backend {
+	case "", "supabase":
+		return db.NewSupabaseClient()
+	case "postgres":
+		return db.NewPostgresStore(context.Background())
+	case "memory":
+		log.Println("⚠️ Using in-memory store; data will be lost on restart")
+		return db.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORE_BACKEND %q", backend)
+	}
+}
+
+// newReceiptSigner loads the base64 Ed25519 seed in RECEIPT_SIGNING_KEY, or
+// generates a throwaway key when it is unset.
+func newReceiptSigner(seed string) (*receipt.Signer, error) {
+	if seed != "" {
+		return receipt.ParseSeed(seed)
+	}
+	log.Println("⚠️ RECEIPT_SIGNING_KEY not set; receipts are signed with a key that changes on restart")
+	return receipt.GenerateSigner()
+}
+
+// newAnchorers builds the anchoring backends listed in ANCHOR_BACKENDS
+// (comma-separated, "ots" by default, "none" to leave batches pending). Every
+// batch root is submitted to all of them.
+func newAnchorers(names string) ([]anchor.Anchorer, error) {
+	if names == "" {
+		names = anchor.OTSBackend
+	}
+	if names == "none" {
+		log.Println("⚠️ ANCHOR_BACKENDS is none; batch roots will not be anchored")
+		return nil, nil
+	}
+
+	var anchorers []anchor.Anchorer
+	seen := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		switch name {
+		case anchor.OTSBackend:
+			calendars := ots.DefaultCalendars
+			if urls := os.Getenv("OTS_CALENDAR_URLS"); urls != "" {
+				calendars = strings.Split(urls, ",")
+			}
+			anchorers = append(anchorers, &anchor.OTS{Client: ots.NewClient(calendars)})
+		case anchor.RFC3161Backend:
+			url := os.Getenv("TSA_URL")
+			if url == "" {
+				return nil, fmt.Errorf("TSA_URL is required for the %s backend", name)
+			}
+			r := &anchor.RFC3161{Client: tsa.NewClient(url)}
+			if path := os.Getenv("TSA_CERTS"); path != "" {
+				roots, err := tsa.LoadCertPool(path)
+				if err != nil {
+					return nil, fmt.Errorf("failed to load TSA_CERTS: %w", err)
+				}
+				r.Roots = roots
+			} else {
+				log.Println("⚠️ TSA_CERTS not set; RFC 3161 tokens are stored without checking who signed them")
+			}
+			anchorers = append(anchorers, r)
+		case anchor.EVMBackend:
+			url, from := os.Getenv("EVM_RPC_URL"), os.Getenv("EVM_FROM")
+			if url == "" || from == "" {
+				return nil, fmt.Errorf("EVM_RPC_URL and EVM_FROM are required for the %s backend", name)
+			}
+			anchorers = append(anchorers, anchor.NewEVM(url, from, os.Getenv("EVM_TO")))
+		case anchor.FileBackend:
+			dir := os.Getenv("ANCHOR_FILE_DIR")
+			if dir == "" {
+				return nil, fmt.Errorf("ANCHOR_FILE_DIR is required for the %s backend", name)
+			}
+			anchorers = append(anchorers, &anchor.File{Dir: dir})
+		default:
+			return nil, fmt.Errorf("unknown anchoring backend %q (want ots, rfc3161, evm or file)", name)
+		}
+	}
+	return anchorers, nil
+}
+
+// startAnchorUpgrader follows submitted OTS, EVM and RFC 3161 anchors every
+// ANCHOR_UPGRADE_INTERVAL (OTS_UPGRADE_INTERVAL is still read; default 10m,
+// 0 disables). OTS attestations are checked against the Esplora API in
+// OTS_BLOCK_EXPLORER_URL when it is set.
+func startAnchorUpgrader(h *handlers.Handler) error {
+	u := &anchor.Upgrader{Store: h.Store}
+	for _, a := range h.Anchorers {
+		switch a := a.(type) {
+		case *anchor.OTS:
+			u.OTS = a.Client
+		case *anchor.EVM:
+			u.EVM = a
+		case *anchor.RFC3161:
+			if a.Roots != nil {
+				u.RFC3161 = a
+			}
+		}
+	}
+	if u.OTS == nil && u.EVM == nil && u.RFC3161 == nil {
+		return nil
+	}
+
+	interval := 10 * time.Minute
+	v := os.Getenv("ANCHOR_UPGRADE_INTERVAL")
+	if v == "" {
+		v = os.Getenv("OTS_UPGRADE_INTERVAL")
+	}
+	if v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid ANCHOR_UPGRADE_INTERVAL %q: %w", v, err)
+		}
+		interval = d
+	}
+	if interval <= 0 {
+		log.Println("⚠️ Anchor upgrades disabled; batches will stay submitted")
+		return nil
+	}
+	u.Interval = interval
+
+	if url := os.Getenv("OTS_BLOCK_EXPLORER_URL"); url != "" && u.OTS != nil {
+		u.Blocks = &ots.Esplora{URL: url, HTTP: u.OTS.HTTP}
+	}
+	go u.Run(context.Background())
+	return nil
+}
+
+// startScanOutbox keeps scans the store refuses in SCAN_OUTBOX_DIR (default
+// "scan-outbox"; "none" disables it, failing such scans instead) and
+// replays them every SCAN_OUTBOX_POLL_INTERVAL (default 5s). A failed replay
+// is retried after SCAN_OUTBOX_RETRY_DELAY (default 5s), doubling up to
+// SCAN_OUTBOX_MAX_RETRY_DELAY (default 5m), for SCAN_OUTBOX_MAX_ATTEMPTS
+// attempts in all (default 100, about eight hours) before the scan becomes
+// a dead letter.
+func startScanOutbox(h *handlers.Handler) error {
+	dir := os.Getenv("SCAN_OUTBOX_DIR")
+	if dir == "none" {
+		log.Println("⚠️ Scan outbox disabled; scans fail while the store is unavailable")
+		return nil
+	}
+	if dir == "" {
+		dir = "scan-outbox"
+	}
+
+	poll, err := envDuration("SCAN_OUTBOX_POLL_INTERVAL", 5*time.Second)
+	if err != nil {
+		return err
+	}
+	retry, err := envDuration("SCAN_OUTBOX_RETRY_DELAY", 5*time.Second)
+	if err != nil {
+		return err
+	}
+	maxRetry, err := envDuration("SCAN_OUTBOX_MAX_RETRY_DELAY", 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	maxAttempts := 100
+	if v := os.Getenv("SCAN_OUTBOX_MAX_ATTEMPTS"); v != "" {
+		if maxAttempts, err = strconv.Atoi(v); err != nil || maxAttempts < 1 {
+			return fmt.Errorf("invalid SCAN_OUTBOX_MAX_ATTEMPTS %q", v)
+		}
+	}
+	if poll <= 0 {
+		return fmt.Errorf("SCAN_OUTBOX_POLL_INTERVAL must be positive")
+	}
+
+	o, err := outbox.Open(dir, retry, maxRetry, maxAttempts)
+	if err != nil {
+		return err
+	}
+	if n := o.Depth(); n > 0 {
+		log.Printf("📤 Scan outbox %s holds %d queued scans", dir, n)
+	}
+	if n := len(o.DeadLetters()); n > 0 {
+		log.Printf("⚠️ Scan outbox %s holds %d dead letters", dir, n)
+	}
+	h.Outbox = o
+	go o.Run(context.Background(), poll, h.ReplayScan)
+	return nil
+}
+
+// startWebhooks sends webhook deliveries and wraps h.Store so scan and
+// anchoring writes publish events. Webhooks stay disabled unless
+// WEBHOOK_ADMIN_TOKEN is set; it is the bearer token the webhook endpoints
+// require. Subscriptions may only reach public addresses unless
+// WEBHOOK_ALLOW_PRIVATE_URLS is true. Each request times out after
+// WEBHOOK_TIMEOUT (default 10s). Deliveries queued by other instances or due
+// for a retry are picked up every WEBHOOK_POLL_INTERVAL (default 10s). A
+// failed delivery is retried up to WEBHOOK_MAX_ATTEMPTS times in all (default
+// 8), after WEBHOOK_RETRY_DELAY (default 10s) doubling up to
+// WEBHOOK_MAX_RETRY_DELAY (default 1h). WEBHOOK_LEASE (default 1m, longer
+// than WEBHOOK_TIMEOUT) is how long a delivery stays with a dispatcher that
+// has stopped responding.
+func startWebhooks(h *handlers.Handler) error {
+	h.WebhookAdminToken = os.Getenv("WEBHOOK_ADMIN_TOKEN")
+	if h.WebhookAdminToken == "" {
+		log.Println("⚠️ WEBHOOK_ADMIN_TOKEN not set; webhooks are disabled")
+		return nil
+	}
+	if v := os.Getenv("WEBHOOK_ALLOW_PRIVATE_URLS"); v != "" {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WEBHOOK_ALLOW_PRIVATE_URLS %q: %w", v, err)
+		}
+		h.WebhookAllowPrivateURLs = allow
+	}
+
+	d := &webhook.Dispatcher{Store: h.Store, MaxAttempts: 8}
+
+	timeout, err := envDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return err
+	}
+	d.Client = &http.Client{Timeout: timeout}
+	if !h.WebhookAllowPrivateURLs {
+		d.Client.Transport = &http.Transport{
+			DialContext:         webhook.PublicDialer(timeout).DialContext,
+			TLSHandshakeTimeout: timeout,
+		}
+	}
+	if d.Poll, err = envDuration("WEBHOOK_POLL_INTERVAL", 10*time.Second); err != nil {
+		return err
+	}
+	if d.Lease, err = envDuration("WEBHOOK_LEASE", time.Minute); err != nil {
+		return err
+	}
+	if d.RetryDelay, err = envDuration("WEBHOOK_RETRY_DELAY", 10*time.Second); err != nil {
+		return err
+	}
+	if d.MaxRetryDelay, err = envDuration("WEBHOOK_MAX_RETRY_DELAY", time.Hour); err != nil {
+		return err
+	}
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		if d.MaxAttempts, err = strconv.Atoi(v); err != nil || d.MaxAttempts < 1 {
+			return fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %q", v)
+		}
+	}
+	if d.Poll <= 0 || d.Lease <= 0 {
+		return fmt.Errorf("WEBHOOK_POLL_INTERVAL and WEBHOOK_LEASE must be positive")
+	}
+	if d.Lease <= timeout {
+		return fmt.Errorf("WEBHOOK_LEASE must be longer than WEBHOOK_TIMEOUT")
+	}
+
+	h.Webhooks = d
+	h.Store = &webhook.Notifier{Store: h.Store, Dispatcher: d}
+	go d.Run(context.Background())
+	return nil
+}
+
+// startAnchorWorker carries out the jobs queued by /api/anchor-batch. Jobs
+// queued by other instances or due for a retry are picked up every
+// ANCHOR_JOB_POLL_INTERVAL (default 10s). A failed job is retried up to
+// ANCHOR_JOB_MAX_ATTEMPTS times in all (default 5), after ANCHOR_JOB_RETRY_DELAY
+// (default 30s) doubling up to ANCHOR_JOB_MAX_RETRY_DELAY (default 30m).
+// ANCHOR_JOB_LEASE (default 5m) is how long a job stays with a worker that
+// has stopped responding.
+func startAnchorWorker(h *handlers.Handler) error {
+	w := &anchor.Worker{Store: h.Store, Anchorers: h.Anchorers, MaxAttempts: 5}
+
+	var err error
+	if w.Poll, err = envDuration("ANCHOR_JOB_POLL_INTERVAL", 10*time.Second); err != nil {
+		return err
+	}
+	if w.Lease, err = envDuration("ANCHOR_JOB_LEASE", 5*time.Minute); err != nil {
+		return err
+	}
+	if w.RetryDelay, err = envDuration("ANCHOR_JOB_RETRY_DELAY", 30*time.Second); err != nil {
+		return err
+	}
+	if w.MaxRetryDelay, err = envDuration("ANCHOR_JOB_MAX_RETRY_DELAY", 30*time.Minute); err != nil {
+		return err
+	}
+	if v := os.Getenv("ANCHOR_JOB_MAX_ATTEMPTS"); v != "" {
+		if w.MaxAttempts, err = strconv.Atoi(v); err != nil || w.MaxAttempts < 1 {
+			return fmt.Errorf("invalid ANCHOR_JOB_MAX_ATTEMPTS %q", v)
+		}
+	}
+	if w.Poll <= 0 || w.Lease <= 0 {
+		return fmt.Errorf("ANCHOR_JOB_POLL_INTERVAL and ANCHOR_JOB_LEASE must be positive")
+	}
+
+	h.AnchorJobs = w
+	go w.Run(context.Background())
+	return nil
+}
+
+// startAnchorScheduler anchors pending scans without manual calls once
+// ANCHOR_THRESHOLD scans are pending or the oldest is ANCHOR_INTERVAL old;
+// it stays off while neither is set. The store is polled every
+// ANCHOR_POLL_INTERVAL (default 30s), backing off up to ANCHOR_MAX_BACKOFF
+// (default 10m) while idle, and ANCHOR_LOCK_TTL (default 2m) bounds how long
+// a stalled leader blocks other instances.
+func startAnchorScheduler(h *handlers.Handler) error {
+	s := &anchor.Scheduler{Store: h.Store, Anchorers: h.Anchorers}
+
+	var err error
+	if s.Interval, err = envDuration("ANCHOR_INTERVAL", 0); err != nil {
+		return err
+	}
+	if v := os.Getenv("ANCHOR_THRESHOLD"); v != "" {
+		if s.Threshold, err = strconv.Atoi(v); err != nil || s.Threshold < 0 {
+			return fmt.Errorf("invalid ANCHOR_THRESHOLD %q", v)
+		}
+	}
+	if s.Interval <= 0 && s.Threshold == 0 {
+		return nil
+	}
+	if s.Poll, err = envDuration("ANCHOR_POLL_INTERVAL", 30*time.Second); err != nil {
+		return err
+	}
+	if s.MaxBackoff, err = envDuration("ANCHOR_MAX_BACKOFF", 10*time.Minute); err != nil {
+		return err
+	}
+	if s.LockTTL, err = envDuration("ANCHOR_LOCK_TTL", 2*time.Minute); err != nil {
+		return err
+	}
+	if s.Poll <= 0 {
+		return fmt.Errorf("ANCHOR_POLL_INTERVAL must be positive")
+	}
+
+	host, _ := os.Hostname()
+	s.Holder = fmt.Sprintf("%s-%s", host, uuid.NewString()[:8])
+	log.Printf("⏰ Anchor scheduler %s started (interval %s, threshold %d)", s.Holder, s.Interval, s.Threshold)
+	go s.Run(context.Background())
+	return nil
+}
+
+// envDuration parses the duration in the named variable, or returns def
+// when it is unset.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, v, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/ots/otstest"
+)
+
+// runFakeCalendar serves an otstest.Calendar so anchoring can be exercised
+// locally by pointing OTS_CALENDAR_URLS at it.
+func runFakeCalendar(args []string) int {
+	fs := flag.NewFlagSet("ots-calendar", flag.ContinueOnError)
+	addr := fs.String("addr", ":8090", "listen address")
+	confirmAfter := fs.Duration("confirm-after", time.Minute, "how long commitments stay pending")
+	height := fs.Uint64("height", 1, "block height of the fake Bitcoin attestations")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cal := &otstest.Calendar{ConfirmAfter: *confirmAfter, BlockHeight: *height}
+	log.Printf("🗓️ Fake OpenTimestamps calendar listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, cal); err != nil {
+		log.Printf("calendar stopped: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/galanafai/aroni-backend/internal/handlers"
+	"github.com/galanafai/aroni-backend/internal/schema"
+)
+
+// runSchema writes the JSON Schema of every API response type served at
+// /api/schemas/:name into a directory, one <name>.schema.json file each. It
+// returns 0 on success, 1 if a file cannot be written and 2 on usage errors.
+func runSchema(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: schema <output-dir>")
+		return 2
+	}
+	dir := args[0]
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create %s: %v\n", dir, err)
+		return 1
+	}
+
+	for _, name := range handlers.SchemaNames() {
+		raw, err := json.MarshalIndent(schema.Generate(name, handlers.Schemas[name]), "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode %s schema: %v\n", name, err)
+			return 1
+		}
+		path := filepath.Join(dir, name+".schema.json")
+		if err := os.WriteFile(path, append(raw, '\n'), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", path, err)
+			return 1
+		}
+		fmt.Println(path)
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/pem"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/galanafai/aroni-backend/internal/tsa/tsatest"
+)
+
+// runFakeTSA serves a tsatest.Stub so RFC 3161 anchoring can be exercised
+// locally by pointing TSA_URL at it and TSA_CERTS at the CA it writes out.
+func runFakeTSA(args []string) int {
+	fs := flag.NewFlagSet("tsa", flag.ContinueOnError)
+	addr := fs.String("addr", ":8092", "listen address")
+	caOut := fs.String("ca-out", "tsa-ca.pem", "where to write the stub's CA certificate")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	stub, err := tsatest.NewStub()
+	if err != nil {
+		log.Printf("failed to create stub TSA: %v", err)
+		return 1
+	}
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: stub.CA.Raw})
+	if err := os.WriteFile(*caOut, ca, 0o644); err != nil {
+		log.Printf("failed to write CA certificate: %v", err)
+		return 1
+	}
+
+	log.Printf("🕰️ Stub RFC 3161 TSA listening on %s, CA certificate in %s", *addr, *caOut)
+	if err := http.ListenAndServe(*addr, stub); err != nil {
+		log.Printf("TSA stopped: %v", err)
+		return 1
+	}
+	return 0
+}
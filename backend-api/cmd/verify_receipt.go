@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/galanafai/aroni-backend/internal/receipt"
+)
+
+// runVerifyReceipt checks a receipt saved from /api/scan against a base64
+// public key from /api/receipt-key without contacting the server. It
+// returns 0 for a valid receipt, 1 for an invalid one and 2 on usage errors.
+func runVerifyReceipt(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: verify-receipt <receipt.json|-> <public-key>")
+		return 2
+	}
+
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open receipt: %v\n", err)
+			return 2
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var signed receipt.Signed
+	if err := json.NewDecoder(in).Decode(&signed); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to decode receipt: %v\n", err)
+		return 2
+	}
+	pub, err := base64.StdEncoding.DecodeString(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to decode public key: %v\n", err)
+		return 2
+	}
+
+	if err := receipt.Verify(ed25519.PublicKey(pub), signed); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ receipt for scan %s is valid\n", signed.ScanHash)
+	return 0
+}
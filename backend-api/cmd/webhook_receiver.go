@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/webhook"
+)
+
+// runWebhookReceiver serves a local webhook endpoint that checks signatures
+// and logs every event, so webhooks can be exercised by subscribing its URL.
+// With -fail it answers the first N requests with a 503 to exercise retries.
+func runWebhookReceiver(args []string) int {
+	fs := flag.NewFlagSet("webhook-receiver", flag.ContinueOnError)
+	addr := fs.String("addr", ":8095", "listen address")
+	secret := fs.String("secret", "", "subscription secret; signatures are not checked when empty")
+	fail := fs.Int("fail", 0, "answer this many requests with 503 before accepting any")
+	tolerance := fs.Duration("tolerance", 5*time.Minute, "maximum signature age")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var mu sync.Mutex
+	failed := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		event, delivery := r.Header.Get(webhook.EventHeader), r.Header.Get(webhook.DeliveryHeader)
+		if *secret != "" {
+			if err := webhook.Verify(*secret, r.Header.Get(webhook.SignatureHeader), body, *tolerance, time.Now()); err != nil {
+				log.Printf("❌ %s delivery %s rejected: %v", event, delivery, err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		mu.Lock()
+		refuse := failed < *fail
+		if refuse {
+			failed++
+		}
+		mu.Unlock()
+		if refuse {
+			log.Printf("⚠️ %s delivery %s refused (%d of %d)", event, delivery, failed, *fail)
+			http.Error(w, "refused by -fail", http.StatusServiceUnavailable)
+			return
+		}
+
+		log.Printf("📬 %s delivery %s: %s", event, delivery, body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("🪝 Webhook receiver listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, handler); err != nil {
+		log.Printf("receiver stopped: %v", err)
+		return 1
+	}
+	return 0
+}
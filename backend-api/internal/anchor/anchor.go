@@ -0,0 +1,65 @@
+// Package anchor submits batch roots to external anchoring backends and
+// runs the background work that follows them once submitted.
+package anchor
+
+import (
+	"context"
+	"sync"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+)
+
+// Anchorer submits a batch root to one anchoring backend.
+type Anchorer interface {
+	// Name identifies the backend in configuration and batch_anchor rows.
+	Name() string
+	// Anchor submits the batch's root and returns its state on the backend.
+	// BatchID and Backend are filled in by the caller.
+	Anchor(ctx context.Context, batch *db.Batch) (*db.BatchAnchor, error)
+}
+
+// AnchorAll submits a batch root to every anchorer at once and returns one
+// BatchAnchor per anchorer, in the same order. A backend that fails gets
+// AnchorFailed and the error text rather than stopping the others.
+func AnchorAll(ctx context.Context, anchorers []Anchorer, batch *db.Batch) []db.BatchAnchor {
+	results := make([]db.BatchAnchor, len(anchorers))
+
+	var wg sync.WaitGroup
+	for i, a := range anchorers {
+		wg.Add(1)
+		go func(i int, a Anchorer) {
+			defer wg.Done()
+			result, err := a.Anchor(ctx, batch)
+			if err != nil {
+				result = &db.BatchAnchor{Status: db.AnchorFailed, Error: err.Error()}
+			}
+			result.BatchID = batch.ID
+			result.Backend = a.Name()
+			results[i] = *result
+		}(i, a)
+	}
+	wg.Wait()
+	return results
+}
+
+// statusRank orders anchor statuses from least to most progress.
+var statusRank = map[string]int{
+	db.AnchorPending:   0,
+	db.AnchorFailed:    1,
+	db.AnchorSubmitted: 2,
+	db.AnchorConfirmed: 3,
+	db.AnchorVerified:  4,
+}
+
+// Status is a batch's overall anchor status: the furthest any of its
+// backends has got, so one working backend is enough for a batch to count
+// as anchored. A batch with no anchors is pending.
+func Status(anchors []db.BatchAnchor) string {
+	status := db.AnchorPending
+	for _, a := range anchors {
+		if statusRank[a.Status] > statusRank[status] {
+			status = a.Status
+		}
+	}
+	return status
+}
@@ -0,0 +1,131 @@
+package anchor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/crypto"
+	"github.com/galanafai/aroni-backend/internal/db"
+)
+
+// ErrNoScans is returned by CreateBatch when no scans match the filter.
+var ErrNoScans = errors.New("no unbatched scans found")
+
+// CreateBatch saves a batch with NewBatch and anchors it with AnchorBatch.
+// Failing anchorers are recorded on their anchors rather than returned; the
+// error is only set when the batch itself was not saved.
+func CreateBatch(ctx context.Context, store db.Store, anchorers []Anchorer, filter db.BatchFilter, note string) (*db.Batch, []db.BatchAnchor, error) {
+	batch, err := NewBatch(ctx, store, filter, note)
+	if err != nil {
+		return nil, nil, err
+	}
+	return batch, AnchorBatch(ctx, store, anchorers, batch), nil
+}
+
+// NewBatch builds a Merkle tree over the unbatched scans matching filter and
+// saves the root together with every scan's inclusion proof, as a batch
+// still AnchorPending. An empty note is replaced by one recording the batch
+// time. It returns ErrNoScans when no scans match, and db.ErrBatchConflict
+// when its scans were batched concurrently.
+func NewBatch(ctx context.Context, store db.Store, filter db.BatchFilter, note string) (*db.Batch, error) {
+	pending, err := store.FetchUnbatchedScans(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scan hashes: %w", err)
+	}
+	if len(pending) == 0 {
+		return nil, ErrNoScans
+	}
+
+	hashes := make([]string, len(pending))
+	ids := make([]string, len(pending))
+	for i, p := range pending {
+		hashes[i] = p.ScanHash
+		ids[i] = p.TrackingID
+	}
+
+	tree, err := crypto.BuildMerkleTree(hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Merkle tree: %w", err)
+	}
+	proofs, err := buildProofs(tree, hashes, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Merkle proofs: %w", err)
+	}
+
+	if note == "" {
+		note = "Batch anchored at " + time.Now().UTC().Format(time.RFC3339)
+	}
+	batch := &db.Batch{
+		RootHash:            tree.Root(),
+		ScanCount:           len(hashes),
+		IncludedTrackingIDs: ids,
+		Note:                note,
+		HashScheme:          tree.Scheme,
+		ScanTimeFrom:        pending[0].ScanTime,
+		ScanTimeTo:          pending[len(pending)-1].ScanTime,
+		AnchorStatus:        db.AnchorPending,
+	}
+	if err := store.SaveBatch(ctx, batch, proofs); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// AnchorBatch submits a saved batch's root to each of anchorers, records
+// the result on each backend's anchor and updates the batch's overall
+// status, which also counts anchors from earlier calls. It returns the
+// anchors of this call; failures are recorded on them rather than returned.
+func AnchorBatch(ctx context.Context, store db.Store, anchorers []Anchorer, batch *db.Batch) []db.BatchAnchor {
+	anchors := AnchorAll(ctx, anchorers, batch)
+	if len(anchors) == 0 {
+		return anchors
+	}
+	for i := range anchors {
+		a := &anchors[i]
+		if a.Status == db.AnchorFailed {
+			log.Printf("❌ Failed to anchor root hash via %s: %s", a.Backend, a.Error)
+		} else {
+			log.Printf("🔗 Root hash %s anchored via %s", batch.RootHash, a.Backend)
+		}
+		if err := store.SaveBatchAnchor(ctx, a); err != nil {
+			log.Printf("❌ Failed to record %s anchor: %v", a.Backend, err)
+		}
+	}
+
+	all, err := store.FetchBatchAnchors(ctx, batch.ID)
+	if err != nil || len(all) == 0 {
+		all = anchors
+	}
+	batch.AnchorStatus = Status(all)
+	if err := store.SetBatchAnchorStatus(ctx, batch.ID, batch.AnchorStatus); err != nil {
+		log.Printf("❌ Failed to record anchor status: %v", err)
+	}
+	return anchors
+}
+
+// buildProofs returns the inclusion proof of every leaf in the tree, tagged
+// with the tracking ID of the scan it came from.
+func buildProofs(tree *crypto.MerkleTree, hashes, trackingIDs []string) ([]db.ScanProof, error) {
+	idByHash := make(map[string]string, len(hashes))
+	for i, h := range hashes {
+		idByHash[h] = trackingIDs[i]
+	}
+
+	proofs := make([]db.ScanProof, 0, len(tree.Leaves))
+	for i := range tree.Leaves {
+		path, err := tree.GetProof(i)
+		if err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, db.ScanProof{
+			ScanHash:   tree.Leaf(i),
+			TrackingID: idByHash[tree.Leaf(i)],
+			LeafIndex:  i,
+			Proof:      path,
+		})
+	}
+	return proofs, nil
+}
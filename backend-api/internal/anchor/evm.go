@@ -0,0 +1,158 @@
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+)
+
+// EVMBackend is the name of the EVM transaction backend.
+const EVMBackend = "evm"
+
+// ErrTransactionMismatch is returned when a mined anchor transaction does
+// not carry the batch root it was recorded for.
+var ErrTransactionMismatch = errors.New("transaction data does not match batch root")
+
+// EVM anchors a batch root as the data of a zero-value transaction sent
+// through an Ethereum JSON-RPC node. The transaction is signed by the node
+// (eth_sendTransaction), so From must be an account the node holds; dev
+// chains such as anvil, hardhat or geth --dev have such accounts unlocked.
+// The transaction hash is kept as the reference.
+type EVM struct {
+	URL  string
+	From string
+	// To receives the transaction; defaults to From.
+	To   string
+	HTTP *http.Client
+}
+
+// NewEVM returns an EVM anchorer for the node at url.
+func NewEVM(url, from, to string) *EVM {
+	return &EVM{URL: url, From: from, To: to, HTTP: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (e *EVM) Name() string { return EVMBackend }
+
+func (e *EVM) Anchor(ctx context.Context, batch *db.Batch) (*db.BatchAnchor, error) {
+	to := e.To
+	if to == "" {
+		to = e.From
+	}
+	tx := map[string]string{
+		"from":  e.From,
+		"to":    to,
+		"value": "0x0",
+		"data":  "0x" + batch.RootHash,
+	}
+
+	var hash string
+	if err := e.call(ctx, "eth_sendTransaction", []interface{}{tx}, &hash); err != nil {
+		return nil, err
+	}
+	return &db.BatchAnchor{Status: db.AnchorSubmitted, Reference: hash}, nil
+}
+
+// Confirm checks whether an anchor transaction has been mined. Once it has,
+// the anchor is updated with its block and becomes AnchorVerified if the
+// transaction carries rootHash, or AnchorFailed with ErrTransactionMismatch
+// if it reverted or carries something else. Unmined transactions are left
+// as they are.
+func (e *EVM) Confirm(ctx context.Context, a *db.BatchAnchor, rootHash string) error {
+	var receipt *struct {
+		Status      string `json:"status"`
+		BlockNumber string `json:"blockNumber"`
+	}
+	if err := e.call(ctx, "eth_getTransactionReceipt", []interface{}{a.Reference}, &receipt); err != nil {
+		return err
+	}
+	if receipt == nil || receipt.BlockNumber == "" {
+		return nil
+	}
+
+	var tx struct {
+		Input string `json:"input"`
+	}
+	if err := e.call(ctx, "eth_getTransactionByHash", []interface{}{a.Reference}, &tx); err != nil {
+		return err
+	}
+	var block struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := e.call(ctx, "eth_getBlockByNumber", []interface{}{receipt.BlockNumber, false}, &block); err != nil {
+		return err
+	}
+
+	height, err := strconv.ParseInt(strings.TrimPrefix(receipt.BlockNumber, "0x"), 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid block number %q: %w", receipt.BlockNumber, err)
+	}
+	a.BlockHeight = height
+	if ts, err := strconv.ParseInt(strings.TrimPrefix(block.Timestamp, "0x"), 16, 64); err == nil {
+		a.BlockTime = time.Unix(ts, 0).UTC().Format(time.RFC3339)
+	}
+
+	if receipt.Status != "0x1" || !strings.EqualFold(tx.Input, "0x"+rootHash) {
+		a.Status = db.AnchorFailed
+		a.Error = ErrTransactionMismatch.Error()
+		return ErrTransactionMismatch
+	}
+	a.Status = db.AnchorVerified
+	return nil
+}
+
+// call makes one JSON-RPC request and decodes its result into out.
+func (e *EVM) call(ctx context.Context, method string, params []interface{}, out any) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: node responded with status %d: %s", method, resp.StatusCode, body)
+	}
+
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s: failed to decode response: %w", method, err)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("%s: %s (code %d)", method, reply.Error.Message, reply.Error.Code)
+	}
+	if err := json.Unmarshal(reply.Result, out); err != nil {
+		return fmt.Errorf("%s: failed to decode result: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package anchor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+)
+
+// FileBackend is the name of the local file backend.
+const FileBackend = "file"
+
+// File writes each batch root to <Dir>/<root>.json. It proves nothing to a
+// third party and is meant for development, or for deployments that ship
+// the directory to their own archive.
+type File struct {
+	Dir string
+}
+
+func (f *File) Name() string { return FileBackend }
+
+func (f *File) Anchor(ctx context.Context, batch *db.Batch) (*db.BatchAnchor, error) {
+	record, err := json.MarshalIndent(map[string]interface{}{
+		"batch_id":       batch.ID,
+		"root_hash":      batch.RootHash,
+		"hash_scheme":    batch.HashScheme,
+		"scan_count":     batch.ScanCount,
+		"scan_time_from": batch.ScanTimeFrom,
+		"scan_time_to":   batch.ScanTimeTo,
+		"created_at":     batch.CreatedAt,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode root: %w", err)
+	}
+
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", f.Dir, err)
+	}
+	path := filepath.Join(f.Dir, batch.RootHash+".json")
+	if err := os.WriteFile(path, append(record, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write root: %w", err)
+	}
+	return &db.BatchAnchor{Status: db.AnchorSubmitted, Reference: path}, nil
+}
@@ -0,0 +1,175 @@
+package anchor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+)
+
+// Worker carries out queued anchor jobs. A job first saves its batch with
+// NewBatch and then anchors it with AnchorBatch. When either step fails, or
+// any backend fails to anchor, the job is queued again after RetryDelay,
+// doubling with every attempt up to MaxRetryDelay, until it has used its
+// MaxAttempts. Retries after the batch is saved only resubmit to the
+// backends that have not succeeded.
+//
+// Jobs are claimed through the store with a Lease, so several instances can
+// run workers against one store, and a job whose worker died is taken up
+// again once its lease runs out.
+type Worker struct {
+	Store     db.Store
+	Anchorers []Anchorer
+	// Poll is how often the store is checked for jobs queued elsewhere or
+	// due for a retry; Wake checks it straight away.
+	Poll          time.Duration
+	Lease         time.Duration
+	MaxAttempts   int
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+
+	once sync.Once
+	wake chan struct{}
+}
+
+// Enqueue queues job with the worker's MaxAttempts and wakes the worker.
+func (w *Worker) Enqueue(ctx context.Context, job *db.AnchorJob) error {
+	job.MaxAttempts = w.MaxAttempts
+	if err := w.Store.CreateAnchorJob(ctx, job); err != nil {
+		return err
+	}
+	w.Wake()
+	return nil
+}
+
+// Wake makes a running worker check for jobs without waiting for Poll.
+func (w *Worker) Wake() {
+	select {
+	case w.wakeC() <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Worker) wakeC() chan struct{} {
+	w.once.Do(func() { w.wake = make(chan struct{}, 1) })
+	return w.wake
+}
+
+// Run carries out jobs as they become due until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		for ctx.Err() == nil {
+			job, err := w.Store.ClaimAnchorJob(ctx, w.Lease)
+			if err != nil {
+				log.Printf("❌ Failed to claim anchor job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			w.Process(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wakeC():
+		case <-time.After(w.Poll):
+		}
+	}
+}
+
+// Process makes one attempt at a claimed job and records the outcome.
+func (w *Worker) Process(ctx context.Context, job *db.AnchorJob) {
+	err := w.attempt(ctx, job)
+	switch {
+	case err == nil:
+		job.Status = db.JobSucceeded
+		job.Step = db.StepDone
+		job.Error = ""
+		log.Printf("⚓ Anchor job %s succeeded with batch %s", job.ID, job.BatchID)
+	case errors.Is(err, ErrNoScans) || job.Attempts >= job.MaxAttempts:
+		job.Status = db.JobFailed
+		job.Error = err.Error()
+		log.Printf("❌ Anchor job %s failed after %d attempts: %v", job.ID, job.Attempts, err)
+	default:
+		delay := w.retryDelay(job.Attempts)
+		job.Status = db.JobQueued
+		job.Error = err.Error()
+		job.RunAfter = time.Now().UTC().Add(delay).Format(time.RFC3339)
+		log.Printf("⚠️ Anchor job %s attempt %d failed, retrying in %s: %v", job.ID, job.Attempts, delay, err)
+		time.AfterFunc(delay, w.Wake)
+	}
+	if err := w.Store.UpdateAnchorJob(ctx, job); err != nil {
+		log.Printf("❌ Failed to record anchor job %s: %v", job.ID, err)
+	}
+}
+
+// attempt runs whichever steps the job still needs.
+func (w *Worker) attempt(ctx context.Context, job *db.AnchorJob) error {
+	var batch *db.Batch
+	if job.BatchID == "" {
+		w.progress(ctx, job, db.StepBatching)
+		filter, err := job.Filter()
+		if err != nil {
+			return err
+		}
+		if batch, err = NewBatch(ctx, w.Store, filter, job.Note); err != nil {
+			return err
+		}
+		job.BatchID = batch.ID
+	} else {
+		var err error
+		if batch, err = w.Store.FetchBatch(ctx, job.BatchID); err != nil {
+			return fmt.Errorf("failed to fetch batch: %w", err)
+		}
+		if batch == nil {
+			return fmt.Errorf("batch %s not found", job.BatchID)
+		}
+	}
+	w.progress(ctx, job, db.StepAnchoring)
+
+	existing, err := w.Store.FetchBatchAnchors(ctx, batch.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch batch anchors: %w", err)
+	}
+	done := map[string]bool{}
+	for _, a := range existing {
+		done[a.Backend] = a.Status != db.AnchorFailed
+	}
+	var todo []Anchorer
+	for _, a := range w.Anchorers {
+		if !done[a.Name()] {
+			todo = append(todo, a)
+		}
+	}
+
+	var errs []error
+	for _, a := range AnchorBatch(ctx, w.Store, todo, batch) {
+		if a.Status == db.AnchorFailed {
+			errs = append(errs, fmt.Errorf("%s: %s", a.Backend, a.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// progress records that job has reached step.
+func (w *Worker) progress(ctx context.Context, job *db.AnchorJob, step string) {
+	job.Step = step
+	if err := w.Store.UpdateAnchorJob(ctx, job); err != nil {
+		log.Printf("❌ Failed to record anchor job %s: %v", job.ID, err)
+	}
+}
+
+// retryDelay is the wait before the attempt after the given one.
+func (w *Worker) retryDelay(attempts int) time.Duration {
+	delay := w.RetryDelay
+	for i := 1; i < attempts && delay < w.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, w.MaxRetryDelay)
+}
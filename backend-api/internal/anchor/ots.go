@@ -0,0 +1,35 @@
+package anchor
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/ots"
+)
+
+// OTSBackend is the name of the OpenTimestamps backend.
+const OTSBackend = "ots"
+
+// OTS timestamps batch roots on OpenTimestamps calendars. The stamped file
+// is the root's hex string, as `ots stamp` was run on <root>.txt before, and
+// the serialized .ots proof is stored as the anchor's proof.
+type OTS struct {
+	Client *ots.Client
+}
+
+func (o *OTS) Name() string { return OTSBackend }
+
+func (o *OTS) Anchor(ctx context.Context, batch *db.Batch) (*db.BatchAnchor, error) {
+	digest := sha256.Sum256([]byte(batch.RootHash))
+	stamp, err := o.Client.Stamp(ctx, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	proof, err := stamp.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize proof: %w", err)
+	}
+	return &db.BatchAnchor{Status: db.AnchorSubmitted, Proof: proof}, nil
+}
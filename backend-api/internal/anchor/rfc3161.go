@@ -0,0 +1,72 @@
+package anchor
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/tsa"
+)
+
+// RFC3161Backend is the name of the RFC 3161 timestamping backend.
+const RFC3161Backend = "rfc3161"
+
+// RFC3161 has a Time Stamping Authority sign the batch root. The root is
+// already a SHA-256 digest, so it is sent as the message imprint as is and
+// `openssl ts -verify -digest <root>` checks the stored token directly. The
+// token's serial number is kept as the reference.
+//
+// With Roots set, the token's signature is checked against them before it
+// is stored and the anchor is AnchorVerified straight away; a token from an
+// untrusted signer fails the anchor. Without Roots it stays AnchorSubmitted.
+type RFC3161 struct {
+	Client *tsa.Client
+	Roots  *x509.CertPool
+}
+
+func (r *RFC3161) Name() string { return RFC3161Backend }
+
+func (r *RFC3161) Anchor(ctx context.Context, batch *db.Batch) (*db.BatchAnchor, error) {
+	digest, err := hex.DecodeString(batch.RootHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid root hash: %w", err)
+	}
+	token, err := r.Client.Timestamp(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	a := &db.BatchAnchor{
+		Status:    db.AnchorSubmitted,
+		Reference: token.Info.SerialNumber.String(),
+		Proof:     token.Raw,
+	}
+	if r.Roots != nil {
+		if err := r.Verify(a, batch.RootHash); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Verify checks a stored RFC 3161 anchor's token against Roots and that it
+// covers rootHash. On success the anchor becomes AnchorVerified with the
+// token's genTime as its BlockTime.
+func (r *RFC3161) Verify(a *db.BatchAnchor, rootHash string) error {
+	token, err := tsa.ParseToken(a.Proof)
+	if err != nil {
+		return fmt.Errorf("stored token is invalid: %w", err)
+	}
+	digest, err := hex.DecodeString(rootHash)
+	if err != nil || !token.Covers(digest) {
+		return tsa.ErrImprintMismatch
+	}
+	if _, err := token.Verify(r.Roots); err != nil {
+		return err
+	}
+	a.Status = db.AnchorVerified
+	a.BlockTime = token.Info.GenTime.UTC().Format(time.RFC3339)
+	return nil
+}
@@ -0,0 +1,125 @@
+package anchor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+)
+
+// SchedulerLock is the name of the lease held by the instance running
+// scheduled batches.
+const SchedulerLock = "anchor-scheduler"
+
+// Scheduler creates batches without anyone calling /api/anchor-batch. Every
+// Poll it anchors all pending scans once there are at least Threshold of
+// them, or once the oldest has waited longer than Interval; either trigger
+// is off when zero. Both are worked out from the store on every poll, so an
+// instance taking over from another picks up where it left off.
+//
+// Only the instance holding the SchedulerLock lease polls the store; the
+// others keep trying to take it over every Poll. While no scans are pending
+// the leader doubles its delay between polls up to MaxBackoff, dropping back
+// to Poll once scans arrive.
+type Scheduler struct {
+	Store     db.Store
+	Anchorers []Anchorer
+	Interval  time.Duration
+	Threshold int
+	Poll      time.Duration
+	// MaxBackoff caps the delay between polls while idle; defaults to Poll.
+	MaxBackoff time.Duration
+	// Holder identifies this instance in the lease.
+	Holder string
+	// LockTTL is how long the lease outlives a poll. It must cover a whole
+	// anchoring run, or another instance may take over during it.
+	LockTTL time.Duration
+}
+
+// Run polls until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	delay := s.Poll
+	for {
+		idle, err := s.Tick(ctx)
+		if err != nil {
+			log.Printf("❌ Scheduled anchoring failed: %v", err)
+		}
+		if idle || err != nil {
+			delay = min(delay*2, max(s.MaxBackoff, s.Poll))
+		} else {
+			delay = s.Poll
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Tick makes one scheduling decision, anchoring a batch if one is due. It
+// reports idle when this instance is the leader and no scans are pending.
+func (s *Scheduler) Tick(ctx context.Context) (idle bool, err error) {
+	leader, err := s.Store.AcquireLock(ctx, SchedulerLock, s.Holder, s.Poll+s.LockTTL)
+	if err != nil {
+		return false, err
+	}
+	if !leader {
+		return false, nil
+	}
+
+	count, err := s.Store.CountUnbatchedScans(ctx)
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return true, nil
+	}
+
+	reason, err := s.due(ctx, count)
+	if err != nil || reason == "" {
+		return false, err
+	}
+
+	batch, _, err := CreateBatch(ctx, s.Store, s.Anchorers, db.BatchFilter{}, "Scheduled batch ("+reason+")")
+	if errors.Is(err, ErrNoScans) || errors.Is(err, db.ErrBatchConflict) {
+		// Batched by someone else since the count; the next poll sees it.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	log.Printf("⏰ Scheduled batch %s of %d scans (%s): %s", batch.ID, batch.ScanCount, reason, batch.AnchorStatus)
+	return false, nil
+}
+
+// due returns why a batch of the count pending scans should be anchored
+// now, or "" if it should not.
+func (s *Scheduler) due(ctx context.Context, count int) (string, error) {
+	if s.Threshold > 0 && count >= s.Threshold {
+		return fmt.Sprintf("%d pending scans", count), nil
+	}
+	if s.Interval <= 0 {
+		return "", nil
+	}
+
+	oldest, err := s.Store.FetchUnbatchedScans(ctx, db.BatchFilter{Limit: 1})
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch oldest pending scan: %w", err)
+	}
+	if len(oldest) == 0 {
+		return "", nil
+	}
+	scanTime, err := time.Parse(time.RFC3339Nano, oldest[0].ScanTime)
+	if err != nil {
+		return "", fmt.Errorf("invalid scan time %q: %w", oldest[0].ScanTime, err)
+	}
+	if waited := time.Since(scanTime); waited >= s.Interval {
+		return fmt.Sprintf("oldest scan waited %s", waited.Round(time.Second)), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,192 @@
+package anchor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/ots"
+)
+
+// Upgrader periodically upgrades the OpenTimestamps proofs of submitted
+// batches until they carry a Bitcoin attestation, and verifies that
+// attestation against the block header when Blocks is set. When EVM is set
+// it also checks whether submitted anchor transactions have been mined, and
+// when RFC3161 is set it verifies RFC 3161 tokens stored before its Roots
+// were configured.
+type Upgrader struct {
+	Store db.Store
+	OTS   *ots.Client
+	// Blocks, when set, is used to check Bitcoin attestations; without it
+	// OTS anchors stop at AnchorConfirmed.
+	Blocks   ots.BlockSource
+	EVM      *EVM
+	RFC3161  *RFC3161
+	Interval time.Duration
+}
+
+// Run upgrades pending anchors every Interval until ctx is cancelled.
+func (u *Upgrader) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := u.UpgradeAll(ctx); err != nil {
+			log.Printf("❌ Anchor upgrade failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// UpgradeAll makes one pass over every OTS anchor that is submitted or, when
+// Blocks is set, confirmed but not yet verified, and over every submitted
+// EVM anchor when EVM is set.
+func (u *Upgrader) UpgradeAll(ctx context.Context) error {
+	var errs []error
+
+	if u.OTS != nil {
+		statuses := []string{db.AnchorSubmitted}
+		if u.Blocks != nil {
+			statuses = append(statuses, db.AnchorConfirmed)
+		}
+		anchors, err := u.Store.FetchAnchorsByStatus(ctx, OTSBackend, statuses...)
+		if err != nil {
+			return fmt.Errorf("failed to fetch OTS anchors: %w", err)
+		}
+		for i := range anchors {
+			a := &anchors[i]
+			before := a.Status
+			if err := u.Upgrade(ctx, a); err != nil {
+				errs = append(errs, fmt.Errorf("batch %s: %w", a.BatchID, err))
+			}
+			if err := u.save(ctx, a, before); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if u.EVM != nil {
+		anchors, err := u.Store.FetchAnchorsByStatus(ctx, EVMBackend, db.AnchorSubmitted)
+		if err != nil {
+			return errors.Join(append(errs, fmt.Errorf("failed to fetch EVM anchors: %w", err))...)
+		}
+		for i := range anchors {
+			a := &anchors[i]
+			batch, err := u.Store.FetchBatch(ctx, a.BatchID)
+			if err != nil || batch == nil {
+				errs = append(errs, fmt.Errorf("batch %s: failed to fetch batch: %v", a.BatchID, err))
+				continue
+			}
+			if err := u.EVM.Confirm(ctx, a, batch.RootHash); err != nil {
+				errs = append(errs, fmt.Errorf("batch %s: %w", a.BatchID, err))
+			}
+			if a.Status == db.AnchorSubmitted {
+				continue
+			}
+			if err := u.save(ctx, a, db.AnchorSubmitted); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if u.RFC3161 != nil && u.RFC3161.Roots != nil {
+		anchors, err := u.Store.FetchAnchorsByStatus(ctx, RFC3161Backend, db.AnchorSubmitted)
+		if err != nil {
+			return errors.Join(append(errs, fmt.Errorf("failed to fetch RFC 3161 anchors: %w", err))...)
+		}
+		for i := range anchors {
+			a := &anchors[i]
+			batch, err := u.Store.FetchBatch(ctx, a.BatchID)
+			if err != nil || batch == nil {
+				errs = append(errs, fmt.Errorf("batch %s: failed to fetch batch: %v", a.BatchID, err))
+				continue
+			}
+			if err := u.RFC3161.Verify(a, batch.RootHash); err != nil {
+				errs = append(errs, fmt.Errorf("batch %s: %w", a.BatchID, err))
+				a.Status = db.AnchorFailed
+				a.Error = err.Error()
+			}
+			if err := u.save(ctx, a, db.AnchorSubmitted); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// save stores an upgraded anchor and, if its status changed, the batch's
+// overall anchor status.
+func (u *Upgrader) save(ctx context.Context, a *db.BatchAnchor, before string) error {
+	if err := u.Store.SaveBatchAnchor(ctx, a); err != nil {
+		return fmt.Errorf("batch %s: failed to store %s anchor: %w", a.BatchID, a.Backend, err)
+	}
+	if a.Status == before {
+		return nil
+	}
+	log.Printf("🔗 Batch %s %s anchor status %s → %s", a.BatchID, a.Backend, before, a.Status)
+
+	anchors, err := u.Store.FetchBatchAnchors(ctx, a.BatchID)
+	if err != nil {
+		return fmt.Errorf("batch %s: failed to fetch anchors: %w", a.BatchID, err)
+	}
+	if err := u.Store.SetBatchAnchorStatus(ctx, a.BatchID, Status(anchors)); err != nil {
+		return fmt.Errorf("batch %s: failed to update anchor status: %w", a.BatchID, err)
+	}
+	return nil
+}
+
+// Upgrade fetches any completed attestations for an OTS anchor's proof and
+// works out its new status, updating a in place. An error is returned
+// alongside the update when the proof was checked but failed verification.
+func (u *Upgrader) Upgrade(ctx context.Context, a *db.BatchAnchor) error {
+	proof, err := ots.ParseDetached(a.Proof)
+	if err != nil {
+		return fmt.Errorf("stored proof is invalid: %w", err)
+	}
+	if _, err := u.OTS.Upgrade(ctx, proof); err != nil {
+		// Calendars that did answer may still have completed the proof.
+		log.Printf("⚠️ Batch %s: some calendars could not be reached: %v", a.BatchID, err)
+	}
+
+	serialized, err := proof.Serialize()
+	if err != nil {
+		return fmt.Errorf("failed to serialize proof: %w", err)
+	}
+	a.Proof = serialized
+	a.Status = db.AnchorSubmitted
+	a.BlockHeight = 0
+	a.BlockTime = ""
+
+	height, ok := proof.BitcoinHeight()
+	if !ok {
+		return nil
+	}
+	a.Status = db.AnchorConfirmed
+	a.BlockHeight = int64(height)
+	if u.Blocks == nil {
+		return nil
+	}
+
+	height, header, err := ots.Verify(ctx, proof, u.Blocks)
+	if errors.Is(err, ots.ErrAttestationMismatch) {
+		a.Status = db.AnchorFailed
+		a.Error = err.Error()
+		return err
+	}
+	if err != nil {
+		// The explorer may be unreachable; try again on the next pass.
+		return fmt.Errorf("failed to verify attestation: %w", err)
+	}
+	a.Status = db.AnchorVerified
+	a.BlockHeight = int64(height)
+	a.BlockTime = header.Time.Format(time.RFC3339)
+	return nil
+}
@@ -0,0 +1,175 @@
+// Package audit checks that stored scans still match their hashes and the
+// Merkle roots of the batches that anchored them.
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/crypto"
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/scanhash"
+)
+
+// Finding describes one scan that failed a check.
+type Finding struct {
+	ScanHash   string `json:"scan_hash"`
+	TrackingID string `json:"tracking_id,omitempty"`
+	BatchID    string `json:"batch_id,omitempty"`
+	Detail     string `json:"detail"`
+}
+
+// Report is the result of an audit run.
+type Report struct {
+	CheckedAt      string `json:"checked_at"`
+	ScansChecked   int    `json:"scans_checked"`
+	BatchesChecked int    `json:"batches_checked"`
+
+	// Altered scans no longer hash to their scan_hash, or their scan_hash is
+	// not part of the batch they claim to belong to.
+	Altered []Finding `json:"altered"`
+	// Missing scans were anchored in a batch but no longer exist in scan_log.
+	Missing []Finding `json:"missing"`
+	// Unanchored scans have not been included in any batch yet.
+	Unanchored []Finding `json:"unanchored"`
+	// Unverifiable scans use a hash version that cannot be recomputed.
+	Unverifiable []Finding `json:"unverifiable"`
+	// InvalidProofs are stored proofs that do not lead to their batch root.
+	InvalidProofs []Finding `json:"invalid_proofs"`
+	// Legacy batches were anchored before per-scan proofs were stored, so
+	// neither they nor any scan in them can be checked. They do not fail the
+	// audit.
+	Legacy []Finding `json:"legacy"`
+
+	OK bool `json:"ok"`
+}
+
+// Run audits every scan and batch in the store.
+func Run(ctx context.Context, store db.Store) (*Report, error) {
+	report := &Report{
+		CheckedAt:     time.Now().UTC().Format(time.RFC3339),
+		Altered:       []Finding{},
+		Missing:       []Finding{},
+		Unanchored:    []Finding{},
+		Unverifiable:  []Finding{},
+		InvalidProofs: []Finding{},
+		Legacy:        []Finding{},
+	}
+
+	scans, err := store.FetchAllScans(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scans: %w", err)
+	}
+	batches, err := store.FetchBatches(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch batches: %w", err)
+	}
+	report.ScansChecked = len(scans)
+	report.BatchesChecked = len(batches)
+
+	// Index every stored proof by batch and scan hash, verifying each against
+	// its batch root as we go.
+	proofs := map[string]map[string]db.ScanProof{}
+	legacy := map[string]bool{}
+	for _, batch := range batches {
+		if batch.HashScheme == crypto.SchemeSortedConcatLegacy {
+			legacy[batch.ID] = true
+			report.Legacy = append(report.Legacy, Finding{
+				BatchID: batch.ID,
+				Detail:  fmt.Sprintf("%s batch of %d scans has no per-scan proofs", batch.HashScheme, batch.ScanCount),
+			})
+			continue
+		}
+		batchProofs, err := store.FetchBatchProofs(ctx, batch.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch proofs for batch %s: %w", batch.ID, err)
+		}
+
+		byHash := make(map[string]db.ScanProof, len(batchProofs))
+		for _, p := range batchProofs {
+			byHash[p.ScanHash] = p
+			ok, err := crypto.VerifyProofWithScheme(batch.HashScheme, p.ScanHash, p.Proof, batch.RootHash)
+			if err != nil || !ok {
+				detail := "proof does not lead to batch root"
+				if err != nil {
+					detail = err.Error()
+				}
+				report.InvalidProofs = append(report.InvalidProofs, Finding{
+					ScanHash: p.ScanHash, TrackingID: p.TrackingID, BatchID: batch.ID, Detail: detail,
+				})
+			}
+		}
+		if len(batchProofs) != batch.ScanCount {
+			report.InvalidProofs = append(report.InvalidProofs, Finding{
+				BatchID: batch.ID,
+				Detail:  fmt.Sprintf("batch records %d scans but has %d proofs", batch.ScanCount, len(batchProofs)),
+			})
+		}
+		proofs[batch.ID] = byHash
+	}
+
+	seen := map[string]bool{}
+	for _, row := range scans {
+		stored, batchID := row.ScanHash, row.BatchID
+		finding := Finding{ScanHash: stored, TrackingID: row.TrackingID, BatchID: batchID}
+		seen[stored] = true
+
+		computed, err := scanhash.Recompute(row)
+		switch {
+		case errors.Is(err, scanhash.ErrUnsupportedVersion):
+			finding.Detail = err.Error()
+			report.Unverifiable = append(report.Unverifiable, finding)
+		case err != nil:
+			finding.Detail = fmt.Sprintf("failed to recompute hash: %v", err)
+			report.Altered = append(report.Altered, finding)
+			continue
+		case computed != stored:
+			finding.Detail = fmt.Sprintf("fields hash to %s", computed)
+			report.Altered = append(report.Altered, finding)
+			continue
+		}
+
+		if batchID == "" {
+			finding.Detail = "scan is not in any batch"
+			report.Unanchored = append(report.Unanchored, finding)
+			continue
+		}
+		if legacy[batchID] {
+			finding.Detail = "scan is in a batch without per-scan proofs"
+			report.Legacy = append(report.Legacy, finding)
+			continue
+		}
+		batchProofs, ok := proofs[batchID]
+		if !ok {
+			finding.Detail = "batch does not exist"
+			report.Altered = append(report.Altered, finding)
+			continue
+		}
+		if _, ok := batchProofs[stored]; !ok {
+			finding.Detail = "scan_hash is not part of its batch"
+			report.Altered = append(report.Altered, finding)
+		}
+	}
+
+	for batchID, byHash := range proofs {
+		for hash, p := range byHash {
+			if !seen[hash] {
+				report.Missing = append(report.Missing, Finding{
+					ScanHash: hash, TrackingID: p.TrackingID, BatchID: batchID,
+					Detail: "anchored scan is no longer in scan_log",
+				})
+			}
+		}
+	}
+
+	sort.Slice(report.Missing, func(i, j int) bool {
+		a, b := report.Missing[i], report.Missing[j]
+		return a.BatchID < b.BatchID || (a.BatchID == b.BatchID && a.ScanHash < b.ScanHash)
+	})
+
+	report.OK = len(report.Altered) == 0 && len(report.Missing) == 0 && len(report.InvalidProofs) == 0
+	return report, nil
+}
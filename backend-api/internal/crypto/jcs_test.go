@@ -0,0 +1,43 @@
+package crypto
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestCanonicalJSON checks canonicalization examples from RFC 8785 §3.2.2
+// and Appendix B.
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "sorting and escapes",
+			input: `{"numbers":[333333333.33333329,1E30,4.50,2e-3,0.000000000000000000000000001],"string":"\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/","literals":[null,true,false]}`,
+			want:  `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			name:  "number edge cases",
+			input: `[-0, 5e-324, 1.7976931348623157e308, 9007199254740992, 1e21, 1e-7]`,
+			want:  `[0,5e-324,1.7976931348623157e+308,9007199254740992,1e+21,1e-7]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			if err := json.Unmarshal([]byte(tt.input), &value); err != nil {
+				t.Fatal(err)
+			}
+			got, err := CanonicalJSON(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,42 +4,100 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"sort"
 )
 
+// Hash schemes. The scheme is stored with every batch so proofs issued under
+// an older scheme can still be verified after the default changes.
+const (
+	// SchemeSortedPairV0 hashes raw leaves and combines siblings in byte
+	// order. Kept for verifying proofs issued before v1; never used to build.
+	SchemeSortedPairV0 = "sha256-sorted-pair-v0"
+
+	// SchemeSortedConcatLegacy is the root of the first batches: SHA-256
+	// over the sorted hex scan hashes of the whole scan_log, concatenated.
+	// It has no per-scan proofs, so nothing can be verified under it.
+	SchemeSortedConcatLegacy = "sha256-sorted-concat-legacy"
+
+	// SchemeRFC6962V1 follows RFC 6962 §2.1: leaves are hashed as
+	// SHA256(0x00 || leaf), interior nodes as SHA256(0x01 || left || right),
+	// and an unpaired node is promoted to the next level unchanged, which
+	// yields the same root as RFC 6962's split at the largest power of two.
+	SchemeRFC6962V1 = "rfc6962-sha256-v1"
+
+	// CurrentScheme is used for every new tree.
+	CurrentScheme = SchemeRFC6962V1
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// Sibling positions in a proof step.
+const (
+	Left  = "left"
+	Right = "right"
+)
+
+// ProofStep is one sibling on the path from a leaf to the root. Position says
+// which side of the running hash the sibling sits on.
+type ProofStep struct {
+	Hash     string `json:"hash"`
+	Position string `json:"position,omitempty"`
+}
+
+// UnmarshalJSON also accepts a bare hex string, the proof format used by
+// SchemeSortedPairV0.
+func (p *ProofStep) UnmarshalJSON(data []byte) error {
+	var hash string
+	if err := json.Unmarshal(data, &hash); err == nil {
+		*p = ProofStep{Hash: hash}
+		return nil
+	}
+
+	type step ProofStep
+	return json.Unmarshal(data, (*step)(p))
+}
+
 // MerkleTree represents the full tree with proofs
 type MerkleTree struct {
-	Leaves [][]byte
-	Levels [][][]byte // Each level of the tree
+	Scheme string
+	Leaves [][]byte   // Raw scan hashes, sorted
+	Levels [][][]byte // Each level of the tree; Levels[0] holds the leaf hashes
 }
 
-// BuildMerkleTree creates a Merkle tree from sorted scan_hashes
+// BuildMerkleTree creates a Merkle tree from scan_hashes using CurrentScheme.
+// The leaves are sorted; the caller's slice is left untouched.
 func BuildMerkleTree(hashes []string) (*MerkleTree, error) {
 	if len(hashes) == 0 {
 		return nil, errors.New("no hashes provided")
 	}
 
-	sort.Strings(hashes)
+	sorted := append([]string(nil), hashes...)
+	sort.Strings(sorted)
 	leaves := [][]byte{}
-	for _, h := range hashes {
+	level := [][]byte{}
+	for _, h := range sorted {
 		b, err := hex.DecodeString(h)
 		if err != nil {
 			return nil, err
 		}
 		leaves = append(leaves, b)
+		level = append(level, HashLeaf(b))
 	}
 
-	tree := &MerkleTree{Leaves: leaves, Levels: [][][]byte{leaves}}
+	tree := &MerkleTree{Scheme: CurrentScheme, Leaves: leaves, Levels: [][][]byte{level}}
 
-	current := leaves
+	current := level
 	for len(current) > 1 {
 		next := [][]byte{}
 		for i := 0; i < len(current); i += 2 {
 			if i+1 < len(current) {
-				combined := append(current[i], current[i+1]...)
-				h := sha256.Sum256(combined)
-				next = append(next, h[:])
+				next = append(next, HashNode(current[i], current[i+1]))
 			} else {
 				next = append(next, current[i])
 			}
@@ -59,47 +117,110 @@ func (m *MerkleTree) Root() string {
 	return hex.EncodeToString(m.Levels[len(m.Levels)-1][0])
 }
 
+// Leaf returns the hex-encoded scan hash at the given leaf index.
+func (m *MerkleTree) Leaf(index int) string {
+	return hex.EncodeToString(m.Leaves[index])
+}
+
 // GetProof returns the Merkle proof path for a specific leaf index
-func (m *MerkleTree) GetProof(index int) ([]string, error) {
+func (m *MerkleTree) GetProof(index int) ([]ProofStep, error) {
 	if index < 0 || index >= len(m.Leaves) {
 		return nil, errors.New("invalid index")
 	}
 
-	proof := []string{}
+	proof := []ProofStep{}
 	for level := 0; level < len(m.Levels)-1; level++ {
 		siblingIndex := index ^ 1
 		if siblingIndex < len(m.Levels[level]) {
-			proof = append(proof, hex.EncodeToString(m.Levels[level][siblingIndex]))
+			position := Right
+			if siblingIndex < index {
+				position = Left
+			}
+			proof = append(proof, ProofStep{
+				Hash:     hex.EncodeToString(m.Levels[level][siblingIndex]),
+				Position: position,
+			})
 		}
 		index = index / 2
 	}
 	return proof, nil
 }
 
+// ErrNoProofs is returned when verifying a proof under
+// SchemeSortedConcatLegacy, which issued none.
+var ErrNoProofs = errors.New("hash scheme has no per-scan proofs")
+
 // VerifyProof checks if a given leaf + proof leads to the expected root
-func VerifyProof(leafHash string, proof []string, root string) (bool, error) {
+// under CurrentScheme.
+func VerifyProof(leafHash string, proof []ProofStep, root string) (bool, error) {
+	return VerifyProofWithScheme(CurrentScheme, leafHash, proof, root)
+}
+
+// VerifyProofWithScheme checks a proof under the named hash scheme.
+func VerifyProofWithScheme(scheme, leafHash string, proof []ProofStep, root string) (bool, error) {
 	b, err := hex.DecodeString(leafHash)
 	if err != nil {
 		return false, err
 	}
 
-	computed := b
+	var computed []byte
+	switch scheme {
+	case SchemeRFC6962V1:
+		computed = HashLeaf(b)
+	case SchemeSortedPairV0:
+		computed = b
+	case SchemeSortedConcatLegacy:
+		return false, ErrNoProofs
+	default:
+		return false, fmt.Errorf("unknown hash scheme %q", scheme)
+	}
+
 	for _, p := range proof {
-		sibling, err := hex.DecodeString(p)
+		sibling, err := hex.DecodeString(p.Hash)
 		if err != nil {
 			return false, err
 		}
 
-		var combined []byte
-		if bytes.Compare(computed, sibling) < 0 {
-			combined = append(computed, sibling...)
-		} else {
-			combined = append(sibling, computed...)
+		switch {
+		case scheme == SchemeSortedPairV0:
+			computed = hashSortedPair(computed, sibling)
+		case p.Position == Left:
+			computed = HashNode(sibling, computed)
+		case p.Position == Right:
+			computed = HashNode(computed, sibling)
+		default:
+			return false, fmt.Errorf("proof step has invalid position %q", p.Position)
 		}
-
-		h := sha256.Sum256(combined)
-		computed = h[:]
 	}
 
 	return hex.EncodeToString(computed) == root, nil
 }
+
+// HashLeaf returns SHA256(0x00 || leaf).
+func HashLeaf(leaf []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(leaf)
+	return h.Sum(nil)
+}
+
+// HashNode returns SHA256(0x01 || left || right).
+func HashNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// hashSortedPair is the SchemeSortedPairV0 node hash.
+func hashSortedPair(a, b []byte) []byte {
+	combined := make([]byte, 0, len(a)+len(b))
+	if bytes.Compare(a, b) < 0 {
+		combined = append(append(combined, a...), b...)
+	} else {
+		combined = append(append(combined, b...), a...)
+	}
+	h := sha256.Sum256(combined)
+	return h[:]
+}
@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"errors"
+	"testing"
+)
+
+// vectorLeaves are the eight leaves used by the Certificate Transparency
+// reference implementation's RFC 6962 tests. They are already in sorted
+// order, so BuildMerkleTree keeps them in place.
+var vectorLeaves = []string{
+	"",
+	"00",
+	"10",
+	"2021",
+	"3031",
+	"40414243",
+	"5051525354555657",
+	"606162636465666768696a6b6c6d6e6f",
+}
+
+// vectorRoots[n-1] is the RFC 6962 root of the first n vectorLeaves.
+var vectorRoots = []string{
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+func TestMerkleRoots(t *testing.T) {
+	for n := 1; n <= len(vectorLeaves); n++ {
+		tree, err := BuildMerkleTree(vectorLeaves[:n])
+		if err != nil {
+			t.Fatalf("%d leaves: %v", n, err)
+		}
+		if got := tree.Root(); got != vectorRoots[n-1] {
+			t.Errorf("root of %d leaves is %s, want %s", n, got, vectorRoots[n-1])
+		}
+
+		for i := 0; i < n; i++ {
+			proof, err := tree.GetProof(i)
+			if err != nil {
+				t.Fatalf("proof for leaf %d of %d: %v", i, n, err)
+			}
+			ok, err := VerifyProof(tree.Leaf(i), proof, tree.Root())
+			if err != nil {
+				t.Fatalf("verify leaf %d of %d: %v", i, n, err)
+			}
+			if !ok {
+				t.Errorf("proof for leaf %d of %d does not verify", i, n)
+			}
+		}
+	}
+}
+
+// TestMerkleProofs checks audit paths for single leaves, computed
+// independently from RFC 6962 §2.1.1.
+func TestMerkleProofs(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		index int
+		proof []ProofStep
+	}{
+		{
+			name:  "last leaf of 7",
+			size:  7,
+			index: 6,
+			proof: []ProofStep{
+				{Hash: "0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a", Position: Left},
+				{Hash: "d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7", Position: Left},
+			},
+		},
+		{
+			name:  "middle leaf of 5",
+			size:  5,
+			index: 2,
+			proof: []ProofStep{
+				{Hash: "07506a85fd9dd2f120eb694f86011e5bb4662e5c415a62917033d4a9624487e7", Position: Right},
+				{Hash: "fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125", Position: Left},
+				{Hash: "bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b", Position: Right},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := BuildMerkleTree(vectorLeaves[:tt.size])
+			if err != nil {
+				t.Fatal(err)
+			}
+			proof, err := tree.GetProof(tt.index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(proof) != len(tt.proof) {
+				t.Fatalf("proof has %d steps, want %d", len(proof), len(tt.proof))
+			}
+			for i := range proof {
+				if proof[i] != tt.proof[i] {
+					t.Errorf("step %d is %+v, want %+v", i, proof[i], tt.proof[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyLegacyScheme(t *testing.T) {
+	_, err := VerifyProofWithScheme(SchemeSortedConcatLegacy, "00", nil, "00")
+	if !errors.Is(err, ErrNoProofs) {
+		t.Errorf("got %v, want %v", err, ErrNoProofs)
+	}
+}
@@ -0,0 +1,743 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/crypto"
+	"github.com/galanafai/aroni-backend/internal/models"
+	"github.com/galanafai/aroni-backend/internal/scanhash"
+	"github.com/google/uuid"
+)
+
+// MemoryStore is an in-process Store used for local development and tests.
+// Rows are round-tripped through JSON so callers see the same shapes the
+// Supabase REST API would return.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	metadata   map[string]MetadataRecord
+	devices    map[string]Device
+	signatures map[string]bool
+	scans      []models.ScanLog
+	batches    []Batch
+	proofs     []ScanProof
+	anchors    []BatchAnchor
+	jobs       []AnchorJob
+	webhooks   []Webhook
+	deliveries []WebhookDelivery
+	locks      map[string]lease
+}
+
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		metadata:   map[string]MetadataRecord{},
+		devices:    map[string]Device{},
+		signatures: map[string]bool{},
+		locks:      map[string]lease{},
+	}
+}
+
+func (m *MemoryStore) PostMetadata(ctx context.Context, payload models.MetadataPayload) error {
+	var record MetadataRecord
+	if err := roundTrip(payload, &record); err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.metadata[record.TrackingID]; ok {
+		return ErrDuplicateTrackingID
+	}
+	m.metadata[record.TrackingID] = record
+	return nil
+}
+
+func (m *MemoryStore) FetchMetadataByTrackingID(ctx context.Context, trackingID string) (*MetadataRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	record, ok := m.metadata[trackingID]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (m *MemoryStore) PostScanLog(ctx context.Context, scan *models.ScanLog) error {
+	row := copyScan(*scan)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if scanhash.Chained(row.HashVersion) {
+		if row.PrevScanHash != chainHead(m.scansFor(row.TrackingID)) {
+			return ErrChainConflict
+		}
+	}
+
+	if row.ID == "" {
+		row.ID = uuid.NewString()
+	}
+	m.scans = append(m.scans, row)
+	scan.ID = row.ID
+	return nil
+}
+
+func (m *MemoryStore) FetchLastScanHash(ctx context.Context, trackingID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return chainHead(m.scansFor(trackingID)), nil
+}
+
+// scansFor returns the stored scans of a tracking ID in insertion order.
+// Callers must hold m.mu.
+func (m *MemoryStore) scansFor(trackingID string) []models.ScanLog {
+	var rows []models.ScanLog
+	for _, row := range m.scans {
+		if row.TrackingID == trackingID {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func (m *MemoryStore) FetchScanHistory(ctx context.Context, trackingID string) ([]models.ScanLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	history := []models.ScanLog{}
+	for _, row := range m.scans {
+		if row.TrackingID == trackingID {
+			history = append(history, copyScan(row))
+		}
+	}
+	sortByScanTimeDesc(history)
+	return history, nil
+}
+
+func (m *MemoryStore) FetchAllScans(ctx context.Context) ([]models.ScanLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	scans := make([]models.ScanLog, 0, len(m.scans))
+	for _, row := range m.scans {
+		scans = append(scans, copyScan(row))
+	}
+	sortByScanTimeDesc(scans)
+	return scans, nil
+}
+
+func (m *MemoryStore) QueryScans(ctx context.Context, q ScanQuery) ([]models.ScanLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type keyed struct {
+		row      models.ScanLog
+		scanTime time.Time
+	}
+	var rows []keyed
+	for _, row := range m.scans {
+		k := keyed{row: row}
+		k.scanTime, _ = time.Parse(time.RFC3339, row.ScanTime)
+		if !m.matchesScan(row, k.scanTime, q) {
+			continue
+		}
+		if a := q.After; a != nil && !(k.scanTime.Before(a.ScanTime) || k.scanTime.Equal(a.ScanTime) && row.ID < a.ID) {
+			continue
+		}
+		rows = append(rows, k)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].scanTime.Equal(rows[j].scanTime) {
+			return rows[i].scanTime.After(rows[j].scanTime)
+		}
+		return rows[i].row.ID > rows[j].row.ID
+	})
+	if q.Limit > 0 && len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+	}
+
+	scans := make([]models.ScanLog, len(rows))
+	for i, k := range rows {
+		scans[i] = copyScan(k.row)
+	}
+	return scans, nil
+}
+
+func (m *MemoryStore) CountScans(ctx context.Context, q ScanQuery) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n := 0
+	for _, row := range m.scans {
+		t, _ := time.Parse(time.RFC3339, row.ScanTime)
+		if m.matchesScan(row, t, q) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// matchesScan applies every ScanQuery filter except After. Callers must
+// hold m.mu.
+func (m *MemoryStore) matchesScan(row models.ScanLog, scanTime time.Time, q ScanQuery) bool {
+	switch {
+	case q.Result != "" && string(row.Result) != q.Result,
+		q.TrackingID != "" && row.TrackingID != q.TrackingID,
+		q.Location != "" && row.Location != q.Location,
+		q.DeviceID != "" && row.DeviceID != q.DeviceID,
+		q.Field != "" && !hasReason(row, q.Field),
+		q.SKU != "" && m.metadata[row.TrackingID].SKU != q.SKU,
+		!q.Since.IsZero() && scanTime.Before(q.Since),
+		!q.Until.IsZero() && !scanTime.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+func (m *MemoryStore) RegisterDevice(ctx context.Context, device *Device) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.devices[device.ID]; ok {
+		return ErrDuplicateDevice
+	}
+	device.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	m.devices[device.ID] = *device
+	return nil
+}
+
+func (m *MemoryStore) FetchDevice(ctx context.Context, deviceID string) (*Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	device, ok := m.devices[deviceID]
+	if !ok {
+		return nil, nil
+	}
+	return &device, nil
+}
+
+func (m *MemoryStore) UseDeviceSignature(ctx context.Context, deviceID, signature string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.signatures[signature] {
+		return ErrSignatureReused
+	}
+	m.signatures[signature] = true
+	return nil
+}
+
+func (m *MemoryStore) FetchUnbatchedScans(ctx context.Context, filter BatchFilter) ([]PendingScan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var pending []PendingScan
+	for _, row := range m.scans {
+		if row.ScanHash == "" || row.BatchID != "" {
+			continue
+		}
+		if !filter.Since.IsZero() || !filter.Until.IsZero() {
+			t, err := time.Parse(time.RFC3339, row.ScanTime)
+			if err != nil {
+				continue
+			}
+			if !filter.Since.IsZero() && t.Before(filter.Since) {
+				continue
+			}
+			if !filter.Until.IsZero() && !t.Before(filter.Until) {
+				continue
+			}
+		}
+		pending = append(pending, PendingScan{ScanHash: row.ScanHash, TrackingID: row.TrackingID, ScanTime: row.ScanTime})
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].ScanTime < pending[j].ScanTime })
+	if filter.Limit > 0 && len(pending) > filter.Limit {
+		pending = pending[:filter.Limit]
+	}
+	return pending, nil
+}
+
+func (m *MemoryStore) CountUnbatchedScans(ctx context.Context) (int, error) {
+	pending, err := m.FetchUnbatchedScans(ctx, BatchFilter{})
+	return len(pending), err
+}
+
+func (m *MemoryStore) SaveBatch(ctx context.Context, batch *Batch, proofs []ScanProof) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	covered := map[string]bool{}
+	for _, p := range proofs {
+		covered[p.ScanHash] = true
+	}
+	var rows []int
+	for i, row := range m.scans {
+		if covered[row.ScanHash] {
+			if row.BatchID != "" {
+				return ErrBatchConflict
+			}
+			rows = append(rows, i)
+		}
+	}
+
+	batch.ID = uuid.NewString()
+	batch.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	m.batches = append(m.batches, *batch)
+
+	for _, i := range rows {
+		m.scans[i].BatchID = batch.ID
+	}
+	for _, p := range proofs {
+		p.BatchID = batch.ID
+		p.Proof = append([]crypto.ProofStep{}, p.Proof...)
+		m.proofs = append(m.proofs, p)
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetBatchAnchorStatus(ctx context.Context, batchID string, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.batches {
+		if m.batches[i].ID == batchID {
+			m.batches[i].AnchorStatus = status
+			if status == AnchorSubmitted {
+				m.batches[i].AnchoredAt = time.Now().UTC().Format(time.RFC3339)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("batch %s not found", batchID)
+}
+
+func (m *MemoryStore) SaveBatchAnchor(ctx context.Context, anchor *BatchAnchor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	anchor.UpdatedAt = now
+	saved := *anchor
+	saved.Proof = append([]byte{}, anchor.Proof...)
+
+	for i := range m.anchors {
+		a := &m.anchors[i]
+		if a.BatchID == anchor.BatchID && a.Backend == anchor.Backend {
+			saved.CreatedAt = a.CreatedAt
+			anchor.CreatedAt = a.CreatedAt
+			*a = saved
+			return nil
+		}
+	}
+	for _, b := range m.batches {
+		if b.ID == anchor.BatchID {
+			saved.CreatedAt = now
+			anchor.CreatedAt = now
+			m.anchors = append(m.anchors, saved)
+			return nil
+		}
+	}
+	return fmt.Errorf("batch %s not found", anchor.BatchID)
+}
+
+func (m *MemoryStore) FetchBatchAnchors(ctx context.Context, batchID string) ([]BatchAnchor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var anchors []BatchAnchor
+	for _, a := range m.anchors {
+		if a.BatchID == batchID {
+			a.Proof = append([]byte{}, a.Proof...)
+			anchors = append(anchors, a)
+		}
+	}
+	sort.Slice(anchors, func(i, j int) bool { return anchors[i].Backend < anchors[j].Backend })
+	return anchors, nil
+}
+
+func (m *MemoryStore) FetchAnchorsByStatus(ctx context.Context, backend string, statuses ...string) ([]BatchAnchor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var anchors []BatchAnchor
+	for _, a := range m.anchors {
+		if a.Backend != backend {
+			continue
+		}
+		for _, s := range statuses {
+			if a.Status == s {
+				a.Proof = append([]byte{}, a.Proof...)
+				anchors = append(anchors, a)
+				break
+			}
+		}
+	}
+	return anchors, nil
+}
+
+func (m *MemoryStore) FetchProof(ctx context.Context, scanHash string) (*ScanProof, *Batch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.proofs {
+		if p.ScanHash != scanHash {
+			continue
+		}
+		for _, b := range m.batches {
+			if b.ID == p.BatchID {
+				proof := p
+				proof.Proof = append([]crypto.ProofStep{}, p.Proof...)
+				batch := b
+				return &proof, &batch, nil
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+func (m *MemoryStore) FetchBatch(ctx context.Context, batchID string) (*Batch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, b := range m.batches {
+		if b.ID == batchID {
+			var out Batch
+			if err := roundTrip(b, &out); err != nil {
+				return nil, err
+			}
+			return &out, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) FetchBatches(ctx context.Context) ([]Batch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var batches []Batch
+	if err := roundTrip(m.batches, &batches); err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+func (m *MemoryStore) FetchBatchProofs(ctx context.Context, batchID string) ([]ScanProof, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	proofs := []ScanProof{}
+	for _, p := range m.proofs {
+		if p.BatchID == batchID {
+			p.Proof = append([]crypto.ProofStep{}, p.Proof...)
+			proofs = append(proofs, p)
+		}
+	}
+	sort.Slice(proofs, func(i, j int) bool { return proofs[i].LeafIndex < proofs[j].LeafIndex })
+	return proofs, nil
+}
+
+func roundTrip(in any, out any) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// hasReason reports whether one of the scan's reasons is about field.
+func hasReason(scan models.ScanLog, field string) bool {
+	for _, r := range scan.Reasons {
+		if r.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// copyScan returns scan with its slices copied, so stored scans are never
+// shared with callers.
+func copyScan(scan models.ScanLog) models.ScanLog {
+	var out models.ScanLog
+	_ = roundTrip(scan, &out)
+	return out
+}
+
+// chainHead returns the latest scan that no other scan points back to. Ties
+// on scan_time go to the row listed last.
+func chainHead(rows []models.ScanLog) string {
+	followed := map[string]bool{}
+	for _, row := range rows {
+		if row.PrevScanHash != "" {
+			followed[row.PrevScanHash] = true
+		}
+	}
+
+	head, headTime := "", ""
+	for _, row := range rows {
+		if row.ScanHash == "" || followed[row.ScanHash] || row.ScanTime < headTime {
+			continue
+		}
+		head, headTime = row.ScanHash, row.ScanTime
+	}
+	return head
+}
+
+func sortByScanTimeDesc(rows []models.ScanLog) {
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].ScanTime > rows[j].ScanTime })
+}
+
+func (m *MemoryStore) CreateAnchorJob(ctx context.Context, job *AnchorJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	job.ID = uuid.NewString()
+	job.Status = JobQueued
+	job.RunAfter = now
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	m.jobs = append(m.jobs, *job)
+	return nil
+}
+
+func (m *MemoryStore) FetchAnchorJob(ctx context.Context, jobID string) (*AnchorJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, j := range m.jobs {
+		if j.ID == jobID {
+			return &j, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) ClaimAnchorJob(ctx context.Context, lease time.Duration) (*AnchorJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	var due *AnchorJob
+	var dueAt time.Time
+	for i := range m.jobs {
+		j := &m.jobs[i]
+		if j.Status != JobQueued && j.Status != JobRunning {
+			continue
+		}
+		runAfter, err := time.Parse(time.RFC3339, j.RunAfter)
+		if err != nil || runAfter.After(now) {
+			continue
+		}
+		if due == nil || runAfter.Before(dueAt) {
+			due, dueAt = j, runAfter
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+
+	due.Status = JobRunning
+	due.Attempts++
+	due.RunAfter = now.Add(lease).Format(time.RFC3339)
+	due.UpdatedAt = now.Format(time.RFC3339)
+	job := *due
+	return &job, nil
+}
+
+func (m *MemoryStore) UpdateAnchorJob(ctx context.Context, job *AnchorJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.jobs {
+		if m.jobs[i].ID == job.ID {
+			job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+			m.jobs[i] = *job
+			return nil
+		}
+	}
+	return fmt.Errorf("anchor job %s not found", job.ID)
+}
+
+func (m *MemoryStore) CreateWebhook(ctx context.Context, hook *Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hook.ID = uuid.NewString()
+	hook.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	stored := *hook
+	stored.Events = append([]string(nil), hook.Events...)
+	m.webhooks = append(m.webhooks, stored)
+	return nil
+}
+
+func (m *MemoryStore) FetchWebhook(ctx context.Context, webhookID string) (*Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, w := range m.webhooks {
+		if w.ID == webhookID {
+			w.Events = append([]string(nil), w.Events...)
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) FetchWebhooks(ctx context.Context) ([]Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]Webhook, len(m.webhooks))
+	for i, w := range m.webhooks {
+		w.Events = append([]string(nil), w.Events...)
+		out[i] = w
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) DeleteWebhook(ctx context.Context, webhookID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	hooks := m.webhooks[:0]
+	for _, w := range m.webhooks {
+		if w.ID == webhookID {
+			found = true
+			continue
+		}
+		hooks = append(hooks, w)
+	}
+	m.webhooks = hooks
+
+	deliveries := m.deliveries[:0]
+	for _, d := range m.deliveries {
+		if d.WebhookID != webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	m.deliveries = deliveries
+	return found, nil
+}
+
+func (m *MemoryStore) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	delivery.ID = uuid.NewString()
+	delivery.Status = DeliveryQueued
+	delivery.RunAfter = now
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	m.deliveries = append(m.deliveries, *delivery)
+	return nil
+}
+
+func (m *MemoryStore) FetchWebhookDelivery(ctx context.Context, deliveryID string) (*WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, d := range m.deliveries {
+		if d.ID == deliveryID {
+			return &d, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) FetchWebhookDeliveries(ctx context.Context, q DeliveryQuery) ([]WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := []WebhookDelivery{}
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		d := m.deliveries[i]
+		if (q.WebhookID != "" && d.WebhookID != q.WebhookID) ||
+			(q.Event != "" && d.Event != q.Event) ||
+			(q.Status != "" && d.Status != q.Status) {
+			continue
+		}
+		out = append(out, d)
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	var due *WebhookDelivery
+	var dueAt time.Time
+	for i := range m.deliveries {
+		d := &m.deliveries[i]
+		if d.Status != DeliveryQueued && d.Status != DeliverySending {
+			continue
+		}
+		runAfter, err := time.Parse(time.RFC3339, d.RunAfter)
+		if err != nil || runAfter.After(now) {
+			continue
+		}
+		if due == nil || runAfter.Before(dueAt) {
+			due, dueAt = d, runAfter
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+
+	due.Status = DeliverySending
+	due.Attempts++
+	due.RunAfter = now.Add(lease).Format(time.RFC3339)
+	due.UpdatedAt = now.Format(time.RFC3339)
+	delivery := *due
+	return &delivery, nil
+}
+
+func (m *MemoryStore) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.deliveries {
+		if m.deliveries[i].ID == delivery.ID {
+			delivery.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+			m.deliveries[i] = *delivery
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook delivery %s not found", delivery.ID)
+}
+
+func (m *MemoryStore) AcquireLock(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if l, ok := m.locks[name]; ok && l.holder != holder && now.Before(l.expires) {
+		return false, nil
+	}
+	m.locks[name] = lease{holder: holder, expires: now.Add(ttl)}
+	return true, nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// migrate applies every embedded migration that has not been recorded in
+// schema_migrations yet. Each file runs in its own transaction under an
+// advisory lock so several instances can start at once.
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, `
+		create table if not exists schema_migrations (
+			version    text primary key,
+			applied_at timestamptz not null default now()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	entries, err := fs.ReadDir(migrationFS, "migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var versions []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".sql") {
+			versions = append(versions, e.Name())
+		}
+	}
+	sort.Strings(versions)
+
+	for _, version := range versions {
+		sql, err := migrationFS.ReadFile("migrations/" + version)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", version, err)
+		}
+
+		err = withTx(ctx, pool, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, `select pg_advisory_xact_lock(hashtext('aroni_schema_migrations'))`); err != nil {
+				return err
+			}
+
+			var applied bool
+			err := tx.QueryRow(ctx, `select exists (select 1 from schema_migrations where version = $1)`, version).Scan(&applied)
+			if err != nil || applied {
+				return err
+			}
+
+			if _, err := tx.Exec(ctx, string(sql)); err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `insert into schema_migrations (version) values ($1)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// withTx runs fn inside a transaction, committing on success and rolling back otherwise.
+func withTx(ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
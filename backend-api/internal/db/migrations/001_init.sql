@@ -0,0 +1,51 @@
+create table if not exists metadata (
+	tracking_id    uuid primary key,
+	sku            text not null,
+	quantity       integer not null,
+	weight_kg      double precision not null,
+	dimensions_cm  double precision[] not null,
+	package_type   text not null,
+	source_id      text not null,
+	destination_id text not null,
+	carrier_id     text not null default '',
+	urgency_level  text not null,
+	hs_code        text not null,
+	timestamp      timestamptz not null,
+	nested_within  text not null default '',
+	created_at     timestamptz not null default now()
+);
+
+create table if not exists scan_log (
+	id                 uuid primary key default gen_random_uuid(),
+	tracking_id        uuid not null references metadata (tracking_id),
+	location           text not null default '',
+	scanned_quantity   integer not null,
+	scanned_weight_kg  double precision not null,
+	scanned_dimensions double precision[] not null,
+	result             text not null,
+	notes              text not null default '',
+	scan_hash          text unique,
+	scan_time          timestamptz not null default now()
+);
+
+create index if not exists scan_log_tracking_id_scan_time_idx on scan_log (tracking_id, scan_time desc);
+create index if not exists scan_log_scan_time_idx on scan_log (scan_time desc);
+
+create table if not exists scan_batch (
+	id                    uuid primary key default gen_random_uuid(),
+	root_hash             text not null,
+	scan_count            integer not null,
+	included_tracking_ids text[] not null default '{}',
+	note                  text not null default '',
+	created_at            timestamptz not null default now()
+);
+
+create table if not exists scan_proof (
+	batch_id   uuid not null references scan_batch (id) on delete cascade,
+	scan_hash  text not null,
+	leaf_index integer not null,
+	proof      jsonb not null,
+	primary key (batch_id, scan_hash)
+);
+
+create index if not exists scan_proof_scan_hash_idx on scan_proof (scan_hash);
@@ -0,0 +1 @@
+alter table scan_log add column if not exists dimension_permutation integer[];
@@ -0,0 +1,9 @@
+-- Batches anchored before hash schemes were versioned used sorted-pair hashing.
+alter table scan_batch add column if not exists hash_scheme text not null default 'sha256-sorted-pair-v0';
+alter table scan_batch alter column hash_scheme drop default;
+
+-- Batches from before per-scan proofs were stored have none; their root is
+-- SHA-256 over the concatenated sorted scan hashes, not a sorted-pair tree.
+update scan_batch b set hash_scheme = 'sha256-sorted-concat-legacy'
+where hash_scheme = 'sha256-sorted-pair-v0'
+and not exists (select 1 from scan_proof p where p.batch_id = b.id);
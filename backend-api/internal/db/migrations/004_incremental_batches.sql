@@ -0,0 +1,19 @@
+alter table scan_log add column if not exists batch_id uuid references scan_batch (id);
+create index if not exists scan_log_unbatched_idx on scan_log (scan_time) where batch_id is null;
+
+alter table scan_batch add column if not exists scan_time_from timestamptz;
+alter table scan_batch add column if not exists scan_time_to timestamptz;
+
+-- Before batch_id existed every batch covered the whole scan_log, so each
+-- existing scan belongs to the first batch with proofs created after it.
+-- Scans only covered by legacy batches stay unbatched, so the next batch
+-- anchors them with proofs.
+update scan_log s
+set batch_id = (
+	select b.id from scan_batch b
+	where b.created_at >= s.scan_time
+	and b.hash_scheme <> 'sha256-sorted-concat-legacy'
+	order by b.created_at
+	limit 1
+)
+where s.batch_id is null;
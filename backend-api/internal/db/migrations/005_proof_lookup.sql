@@ -0,0 +1,4 @@
+alter table scan_proof add column if not exists tracking_id uuid;
+
+alter table scan_batch add column if not exists anchor_status text not null default 'pending';
+alter table scan_batch add column if not exists anchored_at timestamptz;
@@ -0,0 +1,2 @@
+alter table scan_log add column if not exists hash_version text;
+update scan_log set hash_version = 'json-sha256-v0' where hash_version is null and scan_hash is not null;
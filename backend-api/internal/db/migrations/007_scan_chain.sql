@@ -0,0 +1,9 @@
+alter table scan_log add column if not exists prev_scan_hash text;
+
+-- Each chained scan follows exactly one earlier scan of the same package, and
+-- each package has at most one chained scan without a predecessor.
+create unique index if not exists scan_log_chain_prev_idx
+	on scan_log (tracking_id, prev_scan_hash) where prev_scan_hash is not null;
+create unique index if not exists scan_log_chain_start_idx
+	on scan_log (tracking_id)
+	where prev_scan_hash is null and hash_version not in ('json-sha256-v0', 'jcs-sha256-v1');
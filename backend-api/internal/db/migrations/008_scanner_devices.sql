@@ -0,0 +1,9 @@
+create table if not exists scanner_device (
+	id         text primary key,
+	name       text not null default '',
+	public_key text not null,
+	created_at timestamptz not null default now()
+);
+
+alter table scan_log add column if not exists device_id text references scanner_device (id);
+create index if not exists scan_log_device_id_idx on scan_log (device_id) where device_id is not null;
@@ -0,0 +1,2 @@
+-- Base64 of the serialized .ots proof for the batch root.
+alter table scan_batch add column if not exists ots_proof text;
@@ -0,0 +1,5 @@
+alter table scan_batch add column if not exists bitcoin_block_height bigint;
+alter table scan_batch add column if not exists bitcoin_block_time timestamptz;
+alter table scan_batch add column if not exists ots_checked_at timestamptz;
+
+create index if not exists scan_batch_anchor_status_idx on scan_batch (anchor_status);
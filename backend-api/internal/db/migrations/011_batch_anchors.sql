@@ -0,0 +1,30 @@
+-- One row per anchoring backend a batch root was submitted to. The
+-- OpenTimestamps columns on scan_batch move here as the "ots" backend.
+create table if not exists batch_anchor (
+	batch_id     uuid not null references scan_batch (id) on delete cascade,
+	backend      text not null,
+	status       text not null,
+	reference    text not null default '',
+	proof        text,
+	error        text not null default '',
+	block_height bigint,
+	block_time   timestamptz,
+	created_at   timestamptz not null default now(),
+	updated_at   timestamptz not null default now(),
+	primary key (batch_id, backend)
+);
+
+create index if not exists batch_anchor_status_idx on batch_anchor (backend, status);
+
+insert into batch_anchor (batch_id, backend, status, proof, block_height, block_time, created_at, updated_at)
+select id, 'ots', anchor_status, ots_proof, bitcoin_block_height, bitcoin_block_time,
+	coalesce(anchored_at, created_at), coalesce(ots_checked_at, anchored_at, created_at)
+from scan_batch
+where ots_proof is not null
+on conflict do nothing;
+
+alter table scan_batch
+	drop column if exists ots_proof,
+	drop column if exists bitcoin_block_height,
+	drop column if exists bitcoin_block_time,
+	drop column if exists ots_checked_at;
@@ -0,0 +1,23 @@
+-- Leases that let one API instance at a time run scheduled jobs.
+create table if not exists scheduler_lock (
+	name       text primary key,
+	holder     text not null,
+	expires_at timestamptz not null
+);
+
+-- Takes or renews the lease for lock_holder, unless another holder's lease
+-- is still live. Exposed to PostgREST as rpc/acquire_scheduler_lock.
+create or replace function acquire_scheduler_lock(lock_name text, lock_holder text, ttl_seconds double precision)
+returns boolean
+language sql
+as $$
+	with acquired as (
+		insert into scheduler_lock (name, holder, expires_at)
+		values (lock_name, lock_holder, now() + make_interval(secs => ttl_seconds))
+		on conflict (name) do update
+		set holder = excluded.holder, expires_at = excluded.expires_at
+		where scheduler_lock.holder = excluded.holder or scheduler_lock.expires_at < now()
+		returning 1
+	)
+	select exists (select 1 from acquired);
+$$;
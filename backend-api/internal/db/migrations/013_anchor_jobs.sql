@@ -0,0 +1,41 @@
+-- Batch-and-anchor requests, carried out by a worker with retries.
+create table if not exists anchor_job (
+	id           uuid primary key default gen_random_uuid(),
+	status       text not null default 'queued',
+	step         text not null default '',
+	since        timestamptz,
+	until        timestamptz,
+	scan_limit   integer not null default 0,
+	note         text not null default '',
+	batch_id     uuid references scan_batch (id) on delete set null,
+	attempts     integer not null default 0,
+	max_attempts integer not null default 5,
+	error        text not null default '',
+	run_after    timestamptz not null default now(),
+	created_at   timestamptz not null default now(),
+	updated_at   timestamptz not null default now()
+);
+
+create index if not exists anchor_job_due_idx on anchor_job (run_after) where status in ('queued', 'running');
+
+-- Claims the oldest due job for lease_seconds: queued jobs once run_after
+-- has passed, and running jobs whose worker's lease has run out. Exposed to
+-- PostgREST as rpc/claim_anchor_job.
+create or replace function claim_anchor_job(lease_seconds double precision)
+returns setof anchor_job
+language sql
+as $$
+	update anchor_job
+	set status = 'running',
+		attempts = attempts + 1,
+		run_after = now() + make_interval(secs => lease_seconds),
+		updated_at = now()
+	where id = (
+		select id from anchor_job
+		where status in ('queued', 'running') and run_after <= now()
+		order by run_after
+		limit 1
+		for update skip locked
+	)
+	returning *;
+$$;
@@ -0,0 +1,10 @@
+-- The mismatch reasons as a list; notes keeps the joined string the scan
+-- hashes cover. Notes written since per-field tolerances join sentences
+-- like "weight_kg mismatch: ..." with "; ", and those sentences can contain
+-- ", ". Older notes join bare phrases like "weight mismatch" with ", ".
+alter table scan_log add column if not exists reasons jsonb not null default '[]';
+update scan_log set reasons = to_jsonb(
+  case when notes like '%: %' then string_to_array(notes, '; ')
+       else string_to_array(notes, ', ')
+  end)
+where reasons = '[]' and notes <> '';
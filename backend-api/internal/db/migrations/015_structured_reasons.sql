@@ -0,0 +1,29 @@
+-- Reasons are records (field, axis, expected, observed, delta, tolerance,
+-- allowed, severity). Rewrite the strings backfilled from notes by parsing the
+-- sentence matching.Mismatch writes, splitting "dimensions_cm[1]" into the
+-- field and its axis; anything else keeps its text as the field. Severity was
+-- not recorded for these scans, so they are all critical.
+update scan_log s
+set reasons = (
+	select coalesce(jsonb_agg(
+		case when m is null then
+			jsonb_build_object('field', r.value, 'severity', 'critical')
+		else
+			jsonb_build_object(
+				'field',     regexp_replace(m[1], '\[\d\]$', ''),
+				'expected',  m[2]::double precision,
+				'observed',  m[3]::double precision,
+				'delta',     m[4]::double precision,
+				'tolerance', m[5],
+				'allowed',   m[6]::double precision,
+				'severity',  'critical'
+			) || jsonb_strip_nulls(jsonb_build_object('axis', substring(m[1] from '\[(\d)\]$')::int))
+		end order by r.ordinality
+	), '[]')
+	from jsonb_array_elements_text(s.reasons) with ordinality r,
+		lateral (select regexp_match(r.value,
+			'^(.+) mismatch: expected (\S+), observed (\S+), delta (\S+) exceeds tolerance (.+) \(allowed (\S+)\)$') m) p
+)
+where jsonb_typeof(s.reasons -> 0) = 'string';
+
+create index if not exists scan_log_reasons_idx on scan_log using gin (reasons jsonb_path_ops);
@@ -0,0 +1,14 @@
+-- Scans of tracking IDs without metadata are logged with result
+-- unknown_package, so scan_log can no longer require a metadata row.
+alter table scan_log drop constraint if exists scan_log_tracking_id_fkey;
+
+-- PostgREST found the scan_log → metadata relationship through that foreign
+-- key; this computed relationship keeps embedding metadata from scan_log
+-- (e.g. select=*,metadata!inner(sku)) working without it.
+create or replace function metadata(scan_log)
+returns setof metadata rows 1
+language sql
+stable
+as $$
+	select * from metadata where tracking_id = $1.tracking_id;
+$$;
@@ -0,0 +1,50 @@
+-- Webhook subscriptions and the log of every delivery made to them.
+create table if not exists webhook (
+	id         uuid primary key default gen_random_uuid(),
+	url        text not null,
+	events     text[] not null,
+	secret     text not null,
+	created_at timestamptz not null default now()
+);
+
+create table if not exists webhook_delivery (
+	id              uuid primary key default gen_random_uuid(),
+	webhook_id      uuid not null references webhook (id) on delete cascade,
+	event           text not null,
+	payload         jsonb not null,
+	status          text not null default 'queued',
+	attempts        integer not null default 0,
+	max_attempts    integer not null default 8,
+	response_status integer not null default 0,
+	error           text not null default '',
+	replay_of       uuid references webhook_delivery (id) on delete set null,
+	run_after       timestamptz not null default now(),
+	delivered_at    timestamptz,
+	created_at      timestamptz not null default now(),
+	updated_at      timestamptz not null default now()
+);
+
+create index if not exists webhook_delivery_due_idx on webhook_delivery (run_after) where status in ('queued', 'sending');
+create index if not exists webhook_delivery_webhook_idx on webhook_delivery (webhook_id, created_at desc);
+
+-- Claims the oldest due delivery for lease_seconds: queued deliveries once
+-- run_after has passed, and sending deliveries whose worker's lease has run
+-- out. Exposed to PostgREST as rpc/claim_webhook_delivery.
+create or replace function claim_webhook_delivery(lease_seconds double precision)
+returns setof webhook_delivery
+language sql
+as $$
+	update webhook_delivery
+	set status = 'sending',
+		attempts = attempts + 1,
+		run_after = now() + make_interval(secs => lease_seconds),
+		updated_at = now()
+	where id = (
+		select id from webhook_delivery
+		where status in ('queued', 'sending') and run_after <= now()
+		order by run_after
+		limit 1
+		for update skip locked
+	)
+	returning *;
+$$;
@@ -0,0 +1,37 @@
+-- Saves a batch, claims its scans and stores their proofs in one
+-- transaction, which the REST API cannot do itself. When a scan already
+-- belongs to a batch nothing is kept and PT409 is raised, which PostgREST
+-- answers with HTTP 409. Exposed to PostgREST as rpc/save_batch.
+create or replace function save_batch(batch jsonb, proofs jsonb)
+returns setof scan_batch
+language plpgsql
+as $$
+declare
+	saved   scan_batch;
+	claimed integer;
+begin
+	insert into scan_batch (
+		root_hash, scan_count, included_tracking_ids, note, hash_scheme,
+		scan_time_from, scan_time_to, anchor_status
+	)
+	select
+		root_hash, scan_count, included_tracking_ids, note, hash_scheme,
+		scan_time_from, scan_time_to, anchor_status
+	from jsonb_populate_record(null::scan_batch, batch)
+	returning * into saved;
+
+	update scan_log set batch_id = saved.id
+	where scan_hash in (select p ->> 'scan_hash' from jsonb_array_elements(proofs) p)
+		and batch_id is null;
+	get diagnostics claimed = row_count;
+	if claimed <> jsonb_array_length(proofs) then
+		raise exception 'scan already belongs to a batch' using errcode = 'PT409';
+	end if;
+
+	insert into scan_proof (batch_id, scan_hash, tracking_id, leaf_index, proof)
+	select saved.id, p ->> 'scan_hash', (p ->> 'tracking_id')::uuid, (p ->> 'leaf_index')::integer, p -> 'proof'
+	from jsonb_array_elements(proofs) p;
+
+	return next saved;
+end;
+$$;
@@ -0,0 +1,8 @@
+-- Every device signature accepted for a scan. Signatures are unique, so a
+-- captured signed scan cannot be submitted again while its signed_at is
+-- still within the allowed clock skew.
+create table if not exists device_signature (
+	signature  text primary key,
+	device_id  text not null references scanner_device (id),
+	used_at    timestamptz not null default now()
+);
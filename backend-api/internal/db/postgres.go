@@ -0,0 +1,809 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/galanafai/aroni-backend/internal/models"
+)
+
+// PostgresStore is a Store that talks to Postgres directly over a pgx pool.
+// Rows are written with jsonb_populate_record and read back with to_jsonb so
+// the handlers see the same JSON shapes the Supabase REST API returns.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// NewPostgresStore connects to DATABASE_URL (falling back to SUPABASE_DB_URL)
+// and applies any pending schema migrations.
+func NewPostgresStore(ctx context.Context) (*PostgresStore, error) {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		url = os.Getenv("SUPABASE_DB_URL")
+	}
+	if url == "" {
+		return nil, fmt.Errorf("DATABASE_URL or SUPABASE_DB_URL not set")
+	}
+
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to DB: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to DB: %w", err)
+	}
+
+	if err := migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &PostgresStore{pool: pool}, nil
+}
+
+func (p *PostgresStore) Close() {
+	p.pool.Close()
+}
+
+func (p *PostgresStore) PostMetadata(ctx context.Context, payload models.MetadataPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	_, err = p.pool.Exec(ctx, `
+		insert into metadata (
+			sku, quantity, weight_kg, dimensions_cm,
+			package_type, source_id, destination_id,
+			carrier_id, urgency_level, hs_code,
+			tracking_id, timestamp, nested_within
+		)
+		select
+			sku, quantity, weight_kg, dimensions_cm,
+			package_type, source_id, destination_id,
+			carrier_id, urgency_level, hs_code,
+			tracking_id, timestamp, nested_within
+		from jsonb_populate_record(null::metadata, $1::jsonb)
+	`, string(body))
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicateTrackingID
+	}
+	return err
+}
+
+func (p *PostgresStore) FetchMetadataByTrackingID(ctx context.Context, trackingID string) (*MetadataRecord, error) {
+	var row []byte
+	err := p.pool.QueryRow(ctx, `
+		select to_jsonb(m) from metadata m where m.tracking_id::text = $1
+	`, trackingID).Scan(&row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch metadata: %w", err)
+	}
+
+	var record MetadataRecord
+	if err := json.Unmarshal(row, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return &record, nil
+}
+
+// chainIndexes are the unique indexes that keep each tracking ID's scan
+// chain linear (see migrations/007_scan_chain.sql).
+var chainIndexes = map[string]bool{
+	"scan_log_chain_prev_idx":  true,
+	"scan_log_chain_start_idx": true,
+}
+
+func (p *PostgresStore) PostScanLog(ctx context.Context, scan *models.ScanLog) error {
+	body, err := json.Marshal(scan)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scan log: %w", err)
+	}
+
+	err = p.pool.QueryRow(ctx, `
+		insert into scan_log (
+			tracking_id, location, scanned_quantity, scanned_weight_kg,
+			scanned_dimensions, dimension_permutation, result, reasons, notes,
+			scan_hash, hash_version, prev_scan_hash, device_id, scan_time
+		)
+		select
+			tracking_id, location, scanned_quantity, scanned_weight_kg,
+			scanned_dimensions, dimension_permutation, result, coalesce(reasons, '[]'), notes,
+			scan_hash, hash_version, prev_scan_hash, device_id, scan_time
+		from jsonb_populate_record(null::scan_log, $1::jsonb)
+		returning id::text
+	`, string(body)).Scan(&scan.ID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && chainIndexes[pgErr.ConstraintName] {
+		return ErrChainConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert scan log: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgresStore) FetchLastScanHash(ctx context.Context, trackingID string) (string, error) {
+	var hash string
+	err := p.pool.QueryRow(ctx, `
+		select s.scan_hash from scan_log s
+		where s.tracking_id::text = $1
+			and coalesce(s.scan_hash, '') <> ''
+			and not exists (
+				select 1 from scan_log n
+				where n.tracking_id = s.tracking_id and n.prev_scan_hash = s.scan_hash
+			)
+		order by s.scan_time desc, s.id desc
+		limit 1
+	`, trackingID).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return hash, err
+}
+
+func (p *PostgresStore) FetchScanHistory(ctx context.Context, trackingID string) ([]models.ScanLog, error) {
+	return p.queryScans(ctx, `
+		select to_jsonb(s) from scan_log s
+		where s.tracking_id::text = $1
+		order by s.scan_time desc
+	`, trackingID)
+}
+
+func (p *PostgresStore) FetchAllScans(ctx context.Context) ([]models.ScanLog, error) {
+	return p.queryScans(ctx, `select to_jsonb(s) from scan_log s order by s.scan_time desc`)
+}
+
+func (p *PostgresStore) QueryScans(ctx context.Context, q ScanQuery) ([]models.ScanLog, error) {
+	where, args := scanConditions(q)
+	if q.After != nil {
+		args = append(args, q.After.ScanTime, q.After.ID)
+		where += fmt.Sprintf(" and (s.scan_time, s.id) < ($%d, $%d::uuid)", len(args)-1, len(args))
+	}
+	sql := `select to_jsonb(s) from scan_log s where ` + where + ` order by s.scan_time desc, s.id desc`
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		sql += fmt.Sprintf(" limit $%d", len(args))
+	}
+	return p.queryScans(ctx, sql, args...)
+}
+
+func (p *PostgresStore) CountScans(ctx context.Context, q ScanQuery) (int, error) {
+	where, args := scanConditions(q)
+	var n int
+	if err := p.pool.QueryRow(ctx, `select count(*) from scan_log s where `+where, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count scans: %w", err)
+	}
+	return n, nil
+}
+
+// scanConditions turns every ScanQuery filter except After into a where
+// clause over scan_log s and its arguments.
+func scanConditions(q ScanQuery) (string, []any) {
+	conds := []string{"true"}
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if q.Result != "" {
+		add("s.result = $%d", q.Result)
+	}
+	if q.TrackingID != "" {
+		add("s.tracking_id::text = $%d", q.TrackingID)
+	}
+	if q.SKU != "" {
+		add("s.tracking_id in (select tracking_id from metadata where sku = $%d)", q.SKU)
+	}
+	if q.Location != "" {
+		add("s.location = $%d", q.Location)
+	}
+	if q.DeviceID != "" {
+		add("s.device_id = $%d", q.DeviceID)
+	}
+	if q.Field != "" {
+		add("s.reasons @> jsonb_build_array(jsonb_build_object('field', $%d::text))", q.Field)
+	}
+	if !q.Since.IsZero() {
+		add("s.scan_time >= $%d", q.Since)
+	}
+	if !q.Until.IsZero() {
+		add("s.scan_time < $%d", q.Until)
+	}
+	return strings.Join(conds, " and "), args
+}
+
+func (p *PostgresStore) RegisterDevice(ctx context.Context, device *Device) error {
+	err := p.pool.QueryRow(ctx, `
+		insert into scanner_device (id, name, public_key)
+		values ($1, $2, $3)
+		returning to_jsonb(created_at) #>> '{}'
+	`, device.ID, device.Name, device.PublicKey).Scan(&device.CreatedAt)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicateDevice
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert device: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgresStore) FetchDevice(ctx context.Context, deviceID string) (*Device, error) {
+	var row []byte
+	err := p.pool.QueryRow(ctx, `
+		select to_jsonb(d) from scanner_device d where d.id = $1
+	`, deviceID).Scan(&row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch device: %w", err)
+	}
+
+	var device Device
+	if err := json.Unmarshal(row, &device); err != nil {
+		return nil, fmt.Errorf("failed to decode device: %w", err)
+	}
+	return &device, nil
+}
+
+func (p *PostgresStore) UseDeviceSignature(ctx context.Context, deviceID, signature string) error {
+	_, err := p.pool.Exec(ctx, `
+		insert into device_signature (signature, device_id) values ($1, $2)
+	`, signature, deviceID)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrSignatureReused
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record device signature: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgresStore) FetchUnbatchedScans(ctx context.Context, filter BatchFilter) ([]PendingScan, error) {
+	var since, until *time.Time
+	if !filter.Since.IsZero() {
+		since = &filter.Since
+	}
+	if !filter.Until.IsZero() {
+		until = &filter.Until
+	}
+	var limit *int
+	if filter.Limit > 0 {
+		limit = &filter.Limit
+	}
+
+	rows, err := p.pool.Query(ctx, `
+		select scan_hash, tracking_id::text, to_jsonb(scan_time) #>> '{}'
+		from scan_log
+		where batch_id is null
+			and coalesce(scan_hash, '') <> ''
+			and ($1::timestamptz is null or scan_time >= $1)
+			and ($2::timestamptz is null or scan_time < $2)
+		order by scan_time, id
+		limit $3
+	`, since, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []PendingScan
+	for rows.Next() {
+		var s PendingScan
+		if err := rows.Scan(&s.ScanHash, &s.TrackingID, &s.ScanTime); err != nil {
+			return nil, err
+		}
+		pending = append(pending, s)
+	}
+	return pending, rows.Err()
+}
+
+func (p *PostgresStore) CountUnbatchedScans(ctx context.Context) (int, error) {
+	var n int
+	err := p.pool.QueryRow(ctx, `
+		select count(*) from scan_log where batch_id is null and coalesce(scan_hash, '') <> ''
+	`).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unbatched scans: %w", err)
+	}
+	return n, nil
+}
+
+func (p *PostgresStore) SaveBatch(ctx context.Context, batch *Batch, proofs []ScanProof) error {
+	return withTx(ctx, p.pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			insert into scan_batch (
+				root_hash, scan_count, included_tracking_ids, note, hash_scheme,
+				scan_time_from, scan_time_to, anchor_status
+			)
+			values ($1, $2, $3, $4, $5, $6::timestamptz, $7::timestamptz, $8)
+			returning id::text, to_jsonb(created_at) #>> '{}'
+		`, batch.RootHash, batch.ScanCount, batch.IncludedTrackingIDs, batch.Note, batch.HashScheme,
+			nullIfEmpty(batch.ScanTimeFrom), nullIfEmpty(batch.ScanTimeTo), batch.AnchorStatus).Scan(&batch.ID, &batch.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert batch: %w", err)
+		}
+
+		hashes := make([]string, len(proofs))
+		for i, proof := range proofs {
+			hashes[i] = proof.ScanHash
+		}
+		tag, err := tx.Exec(ctx, `
+			update scan_log set batch_id = $1::uuid
+			where scan_hash = any($2) and batch_id is null
+		`, batch.ID, hashes)
+		if err != nil {
+			return fmt.Errorf("failed to assign scans to batch: %w", err)
+		}
+		if tag.RowsAffected() != int64(len(hashes)) {
+			return ErrBatchConflict
+		}
+
+		for _, proof := range proofs {
+			path, err := json.Marshal(proof.Proof)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `
+				insert into scan_proof (batch_id, scan_hash, tracking_id, leaf_index, proof)
+				values ($1::uuid, $2, $3::uuid, $4, $5::jsonb)
+			`, batch.ID, proof.ScanHash, proof.TrackingID, proof.LeafIndex, string(path))
+			if err != nil {
+				return fmt.Errorf("failed to insert proof: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (p *PostgresStore) SetBatchAnchorStatus(ctx context.Context, batchID string, status string) error {
+	tag, err := p.pool.Exec(ctx, `
+		update scan_batch
+		set anchor_status = $2,
+			anchored_at = case when $2 = 'submitted' then now() else anchored_at end
+		where id::text = $1
+	`, batchID, status)
+	if err != nil {
+		return fmt.Errorf("failed to update batch: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("batch %s not found", batchID)
+	}
+	return nil
+}
+
+func (p *PostgresStore) SaveBatchAnchor(ctx context.Context, anchor *BatchAnchor) error {
+	var height *int64
+	if anchor.BlockHeight > 0 {
+		height = &anchor.BlockHeight
+	}
+	var proof *string
+	if len(anchor.Proof) > 0 {
+		encoded := base64.StdEncoding.EncodeToString(anchor.Proof)
+		proof = &encoded
+	}
+
+	var createdAt, updatedAt time.Time
+	err := p.pool.QueryRow(ctx, `
+		insert into batch_anchor (batch_id, backend, status, reference, proof, error, block_height, block_time)
+		values ($1::uuid, $2, $3, $4, $5, $6, $7, $8::timestamptz)
+		on conflict (batch_id, backend) do update
+		set status = excluded.status,
+			reference = excluded.reference,
+			proof = excluded.proof,
+			error = excluded.error,
+			block_height = excluded.block_height,
+			block_time = excluded.block_time,
+			updated_at = now()
+		returning created_at, updated_at
+	`, anchor.BatchID, anchor.Backend, anchor.Status, anchor.Reference, proof, anchor.Error,
+		height, nullIfEmpty(anchor.BlockTime)).Scan(&createdAt, &updatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save batch anchor: %w", err)
+	}
+	anchor.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	anchor.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return nil
+}
+
+func (p *PostgresStore) FetchBatchAnchors(ctx context.Context, batchID string) ([]BatchAnchor, error) {
+	return p.queryAnchors(ctx, `
+		select to_jsonb(a) from batch_anchor a where a.batch_id::text = $1 order by a.backend
+	`, batchID)
+}
+
+func (p *PostgresStore) FetchAnchorsByStatus(ctx context.Context, backend string, statuses ...string) ([]BatchAnchor, error) {
+	return p.queryAnchors(ctx, `
+		select to_jsonb(a) from batch_anchor a
+		where a.backend = $1 and a.status = any($2)
+		order by a.created_at
+	`, backend, statuses)
+}
+
+func (p *PostgresStore) queryAnchors(ctx context.Context, sql string, args ...any) ([]BatchAnchor, error) {
+	var anchors []BatchAnchor
+	err := p.queryJSON(ctx, func(raw []byte) error {
+		var a BatchAnchor
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return err
+		}
+		anchors = append(anchors, a)
+		return nil
+	}, sql, args...)
+	return anchors, err
+}
+
+func (p *PostgresStore) FetchProof(ctx context.Context, scanHash string) (*ScanProof, *Batch, error) {
+	var rawProof, rawBatch []byte
+	err := p.pool.QueryRow(ctx, `
+		select to_jsonb(p), to_jsonb(b)
+		from scan_proof p
+		join scan_batch b on b.id = p.batch_id
+		where p.scan_hash = $1
+		order by b.created_at
+		limit 1
+	`, scanHash).Scan(&rawProof, &rawBatch)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch proof: %w", err)
+	}
+
+	var proof ScanProof
+	var batch Batch
+	if err := json.Unmarshal(rawProof, &proof); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode proof: %w", err)
+	}
+	if err := json.Unmarshal(rawBatch, &batch); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode batch: %w", err)
+	}
+	return &proof, &batch, nil
+}
+
+func (p *PostgresStore) FetchBatch(ctx context.Context, batchID string) (*Batch, error) {
+	var row []byte
+	err := p.pool.QueryRow(ctx, `
+		select to_jsonb(b) from scan_batch b where b.id::text = $1
+	`, batchID).Scan(&row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch batch: %w", err)
+	}
+
+	var batch Batch
+	if err := json.Unmarshal(row, &batch); err != nil {
+		return nil, fmt.Errorf("failed to decode batch: %w", err)
+	}
+	return &batch, nil
+}
+
+func (p *PostgresStore) FetchBatches(ctx context.Context) ([]Batch, error) {
+	var batches []Batch
+	err := p.queryJSON(ctx, func(raw []byte) error {
+		var b Batch
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return err
+		}
+		batches = append(batches, b)
+		return nil
+	}, `select to_jsonb(b) from scan_batch b order by b.created_at`)
+	return batches, err
+}
+
+func (p *PostgresStore) FetchBatchProofs(ctx context.Context, batchID string) ([]ScanProof, error) {
+	var proofs []ScanProof
+	err := p.queryJSON(ctx, func(raw []byte) error {
+		var proof ScanProof
+		if err := json.Unmarshal(raw, &proof); err != nil {
+			return err
+		}
+		proofs = append(proofs, proof)
+		return nil
+	}, `select to_jsonb(p) from scan_proof p where p.batch_id::text = $1 order by p.leaf_index`, batchID)
+	return proofs, err
+}
+
+func (p *PostgresStore) queryScans(ctx context.Context, sql string, args ...any) ([]models.ScanLog, error) {
+	out := []models.ScanLog{}
+	err := p.queryJSON(ctx, func(raw []byte) error {
+		var scan models.ScanLog
+		if err := json.Unmarshal(raw, &scan); err != nil {
+			return err
+		}
+		out = append(out, scan)
+		return nil
+	}, sql, args...)
+	return out, err
+}
+
+// CreateAnchorJob inserts the job and reads back the defaults the table
+// fills in.
+func (p *PostgresStore) CreateAnchorJob(ctx context.Context, job *AnchorJob) error {
+	return p.queryJob(ctx, job, `
+		insert into anchor_job (since, until, scan_limit, note, max_attempts)
+		values ($1::timestamptz, $2::timestamptz, $3, $4, $5)
+		returning to_jsonb(anchor_job.*)
+	`, nullIfEmpty(job.Since), nullIfEmpty(job.Until), job.ScanLimit, job.Note, job.MaxAttempts)
+}
+
+func (p *PostgresStore) FetchAnchorJob(ctx context.Context, jobID string) (*AnchorJob, error) {
+	var job AnchorJob
+	err := p.queryJob(ctx, &job, `select to_jsonb(j) from anchor_job j where j.id::text = $1`, jobID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (p *PostgresStore) ClaimAnchorJob(ctx context.Context, lease time.Duration) (*AnchorJob, error) {
+	var job AnchorJob
+	err := p.queryJob(ctx, &job, `select to_jsonb(j) from claim_anchor_job($1) j`, lease.Seconds())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (p *PostgresStore) UpdateAnchorJob(ctx context.Context, job *AnchorJob) error {
+	var updatedAt time.Time
+	err := p.pool.QueryRow(ctx, `
+		update anchor_job
+		set status = $2,
+			step = $3,
+			batch_id = $4::uuid,
+			error = $5,
+			run_after = $6::timestamptz,
+			updated_at = now()
+		where id::text = $1
+		returning updated_at
+	`, job.ID, job.Status, job.Step, nullIfEmpty(job.BatchID), job.Error, job.RunAfter).Scan(&updatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("anchor job %s not found", job.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update anchor job: %w", err)
+	}
+	job.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return nil
+}
+
+// queryJob runs a query returning one anchor_job row as JSON into job. It
+// returns pgx.ErrNoRows unwrapped when there is no row.
+func (p *PostgresStore) queryJob(ctx context.Context, job *AnchorJob, sql string, args ...any) error {
+	var row []byte
+	err := p.pool.QueryRow(ctx, sql, args...).Scan(&row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query anchor job: %w", err)
+	}
+	if err := json.Unmarshal(row, job); err != nil {
+		return fmt.Errorf("failed to decode anchor job: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgresStore) CreateWebhook(ctx context.Context, hook *Webhook) error {
+	var row []byte
+	err := p.pool.QueryRow(ctx, `
+		insert into webhook (url, events, secret)
+		values ($1, $2, $3)
+		returning to_jsonb(webhook.*)
+	`, hook.URL, hook.Events, hook.Secret).Scan(&row)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	if err := json.Unmarshal(row, hook); err != nil {
+		return fmt.Errorf("failed to decode webhook: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgresStore) FetchWebhook(ctx context.Context, webhookID string) (*Webhook, error) {
+	hooks, err := p.queryWebhooks(ctx, `select to_jsonb(w) from webhook w where w.id::text = $1`, webhookID)
+	if err != nil || len(hooks) == 0 {
+		return nil, err
+	}
+	return &hooks[0], nil
+}
+
+func (p *PostgresStore) FetchWebhooks(ctx context.Context) ([]Webhook, error) {
+	return p.queryWebhooks(ctx, `select to_jsonb(w) from webhook w order by w.created_at`)
+}
+
+func (p *PostgresStore) queryWebhooks(ctx context.Context, sql string, args ...any) ([]Webhook, error) {
+	hooks := []Webhook{}
+	err := p.queryJSON(ctx, func(raw []byte) error {
+		var w Webhook
+		if err := json.Unmarshal(raw, &w); err != nil {
+			return err
+		}
+		hooks = append(hooks, w)
+		return nil
+	}, sql, args...)
+	return hooks, err
+}
+
+func (p *PostgresStore) DeleteWebhook(ctx context.Context, webhookID string) (bool, error) {
+	tag, err := p.pool.Exec(ctx, `delete from webhook where id::text = $1`, webhookID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (p *PostgresStore) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	return p.queryDelivery(ctx, delivery, `
+		insert into webhook_delivery (webhook_id, event, payload, max_attempts, replay_of)
+		values ($1::uuid, $2, $3::jsonb, $4, $5::uuid)
+		returning to_jsonb(webhook_delivery.*)
+	`, delivery.WebhookID, delivery.Event, string(delivery.Payload), delivery.MaxAttempts, nullIfEmpty(delivery.ReplayOf))
+}
+
+func (p *PostgresStore) FetchWebhookDelivery(ctx context.Context, deliveryID string) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := p.queryDelivery(ctx, &delivery, `select to_jsonb(d) from webhook_delivery d where d.id::text = $1`, deliveryID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (p *PostgresStore) FetchWebhookDeliveries(ctx context.Context, q DeliveryQuery) ([]WebhookDelivery, error) {
+	conds := []string{"true"}
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if q.WebhookID != "" {
+		add("d.webhook_id::text = $%d", q.WebhookID)
+	}
+	if q.Event != "" {
+		add("d.event = $%d", q.Event)
+	}
+	if q.Status != "" {
+		add("d.status = $%d", q.Status)
+	}
+	sql := `select to_jsonb(d) from webhook_delivery d where ` + strings.Join(conds, " and ") + ` order by d.created_at desc, d.id desc`
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		sql += fmt.Sprintf(" limit $%d", len(args))
+	}
+
+	deliveries := []WebhookDelivery{}
+	err := p.queryJSON(ctx, func(raw []byte) error {
+		var d WebhookDelivery
+		if err := json.Unmarshal(raw, &d); err != nil {
+			return err
+		}
+		deliveries = append(deliveries, d)
+		return nil
+	}, sql, args...)
+	return deliveries, err
+}
+
+func (p *PostgresStore) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := p.queryDelivery(ctx, &delivery, `select to_jsonb(d) from claim_webhook_delivery($1) d`, lease.Seconds())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (p *PostgresStore) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	var updatedAt time.Time
+	err := p.pool.QueryRow(ctx, `
+		update webhook_delivery
+		set status = $2,
+			response_status = $3,
+			error = $4,
+			run_after = $5::timestamptz,
+			delivered_at = $6::timestamptz,
+			updated_at = now()
+		where id::text = $1
+		returning updated_at
+	`, delivery.ID, delivery.Status, delivery.ResponseStatus, delivery.Error, delivery.RunAfter, nullIfEmpty(delivery.DeliveredAt)).Scan(&updatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("webhook delivery %s not found", delivery.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	delivery.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return nil
+}
+
+// queryDelivery runs a query returning one webhook_delivery row as JSON into
+// delivery. It returns pgx.ErrNoRows unwrapped when there is no row.
+func (p *PostgresStore) queryDelivery(ctx context.Context, delivery *WebhookDelivery, sql string, args ...any) error {
+	var row []byte
+	err := p.pool.QueryRow(ctx, sql, args...).Scan(&row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query webhook delivery: %w", err)
+	}
+	if err := json.Unmarshal(row, delivery); err != nil {
+		return fmt.Errorf("failed to decode webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgresStore) AcquireLock(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	var acquired bool
+	err := p.pool.QueryRow(ctx, `select acquire_scheduler_lock($1, $2, $3)`, name, holder, ttl.Seconds()).Scan(&acquired)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	return acquired, nil
+}
+
+// queryJSON runs a query whose single column is a jsonb document and hands
+// each document to fn.
+func (p *PostgresStore) queryJSON(ctx context.Context, fn func(raw []byte) error, sql string, args ...any) error {
+	rows, err := p.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return err
+		}
+		if err := fn(raw); err != nil {
+			return fmt.Errorf("failed to decode row: %w", err)
+		}
+	}
+	return rows.Err()
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
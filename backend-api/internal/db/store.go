@@ -0,0 +1,351 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/crypto"
+	"github.com/galanafai/aroni-backend/internal/models"
+)
+
+// ErrDuplicateTrackingID is returned when metadata for a tracking ID already exists.
+var ErrDuplicateTrackingID = errors.New("tracking ID already exists")
+
+// ErrBatchConflict is returned by SaveBatch when one of the scans was claimed
+// by another batch in the meantime.
+var ErrBatchConflict = errors.New("scan already belongs to a batch")
+
+// ErrDuplicateDevice is returned when a scanner device ID is already registered.
+var ErrDuplicateDevice = errors.New("device already registered")
+
+// ErrSignatureReused is returned by UseDeviceSignature when the signature
+// was already accepted for a scan.
+var ErrSignatureReused = errors.New("device signature already used")
+
+// ErrChainConflict is returned by PostScanLog when the scan's prev_scan_hash
+// is no longer the latest entry for its tracking ID, i.e. another scan was
+// logged in the meantime.
+var ErrChainConflict = errors.New("scan chain has moved on")
+
+// Store is the persistence layer used by the HTTP handlers.
+type Store interface {
+	// Metadata
+	PostMetadata(ctx context.Context, payload models.MetadataPayload) error
+	FetchMetadataByTrackingID(ctx context.Context, trackingID string) (*MetadataRecord, error)
+
+	// Scan logs
+	// PostScanLog stores a scan and fills in its ID.
+	PostScanLog(ctx context.Context, scan *models.ScanLog) error
+	// FetchLastScanHash returns the scan_hash at the head of a tracking ID's
+	// scan chain, or "" if it has no scans yet.
+	FetchLastScanHash(ctx context.Context, trackingID string) (string, error)
+	FetchScanHistory(ctx context.Context, trackingID string) ([]models.ScanLog, error)
+	FetchAllScans(ctx context.Context) ([]models.ScanLog, error)
+	// QueryScans returns up to q.Limit scans matching q, newest first with
+	// ties broken by descending id, starting after q.After.
+	QueryScans(ctx context.Context, q ScanQuery) ([]models.ScanLog, error)
+	// CountScans returns how many scans match q, ignoring After and Limit.
+	CountScans(ctx context.Context, q ScanQuery) (int, error)
+
+	// Devices
+	// RegisterDevice stores a scanner device and fills in its CreatedAt.
+	RegisterDevice(ctx context.Context, device *Device) error
+	// FetchDevice returns a registered device, or nil if there is none.
+	FetchDevice(ctx context.Context, deviceID string) (*Device, error)
+	// UseDeviceSignature records a device's scan signature as accepted, or
+	// returns ErrSignatureReused if it already was.
+	UseDeviceSignature(ctx context.Context, deviceID, signature string) error
+
+	// Batches
+	// FetchUnbatchedScans returns scans that have a hash but no batch_id yet,
+	// oldest first.
+	FetchUnbatchedScans(ctx context.Context, filter BatchFilter) ([]PendingScan, error)
+	// CountUnbatchedScans returns how many scans FetchUnbatchedScans would
+	// return without a filter.
+	CountUnbatchedScans(ctx context.Context) (int, error)
+	// SaveBatch stores the batch together with the Merkle proof of every
+	// scan it covers, sets batch_id on those scans and fills in the batch's
+	// ID and CreatedAt.
+	SaveBatch(ctx context.Context, batch *Batch, proofs []ScanProof) error
+	// SetBatchAnchorStatus records the overall anchor status of a batch.
+	SetBatchAnchorStatus(ctx context.Context, batchID string, status string) error
+	// SaveBatchAnchor stores the state of a batch's root on one anchoring
+	// backend, replacing any earlier state for that backend, and fills in
+	// CreatedAt and UpdatedAt.
+	SaveBatchAnchor(ctx context.Context, anchor *BatchAnchor) error
+	// FetchBatchAnchors returns the anchors of a batch, by backend name.
+	FetchBatchAnchors(ctx context.Context, batchID string) ([]BatchAnchor, error)
+	// FetchAnchorsByStatus returns one backend's anchors in any of the
+	// given statuses, oldest first.
+	FetchAnchorsByStatus(ctx context.Context, backend string, statuses ...string) ([]BatchAnchor, error)
+	// FetchProof returns the stored proof for a scan and the batch that
+	// included it, or nils if the scan has not been batched.
+	FetchProof(ctx context.Context, scanHash string) (*ScanProof, *Batch, error)
+	// FetchBatch returns a batch by ID, or nil if there is none.
+	FetchBatch(ctx context.Context, batchID string) (*Batch, error)
+	// FetchBatches returns every batch, oldest first.
+	FetchBatches(ctx context.Context) ([]Batch, error)
+	// FetchBatchProofs returns the proofs stored for a batch, by leaf index.
+	FetchBatchProofs(ctx context.Context, batchID string) ([]ScanProof, error)
+
+	// Anchor jobs
+	// CreateAnchorJob queues a job and fills in its ID, Status, RunAfter,
+	// CreatedAt and UpdatedAt.
+	CreateAnchorJob(ctx context.Context, job *AnchorJob) error
+	// FetchAnchorJob returns a job by ID, or nil if there is none.
+	FetchAnchorJob(ctx context.Context, jobID string) (*AnchorJob, error)
+	// ClaimAnchorJob marks the oldest job that is due as JobRunning until
+	// lease from now, counts the attempt and returns it, or returns nil if no
+	// job is due. Running jobs whose lease has run out are due again.
+	ClaimAnchorJob(ctx context.Context, lease time.Duration) (*AnchorJob, error)
+	// UpdateAnchorJob stores a job's progress.
+	UpdateAnchorJob(ctx context.Context, job *AnchorJob) error
+
+	// Webhooks
+	// CreateWebhook stores a subscription and fills in its ID and CreatedAt.
+	CreateWebhook(ctx context.Context, hook *Webhook) error
+	// FetchWebhook returns a subscription by ID, or nil if there is none.
+	FetchWebhook(ctx context.Context, webhookID string) (*Webhook, error)
+	// FetchWebhooks returns every subscription, oldest first.
+	FetchWebhooks(ctx context.Context) ([]Webhook, error)
+	// DeleteWebhook removes a subscription and its deliveries. It reports
+	// false if there was no such subscription.
+	DeleteWebhook(ctx context.Context, webhookID string) (bool, error)
+	// CreateWebhookDelivery queues a delivery and fills in its ID, Status,
+	// RunAfter, CreatedAt and UpdatedAt.
+	CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	// FetchWebhookDelivery returns a delivery by ID, or nil if there is none.
+	FetchWebhookDelivery(ctx context.Context, deliveryID string) (*WebhookDelivery, error)
+	// FetchWebhookDeliveries returns up to q.Limit deliveries matching q,
+	// newest first.
+	FetchWebhookDeliveries(ctx context.Context, q DeliveryQuery) ([]WebhookDelivery, error)
+	// ClaimWebhookDelivery marks the oldest delivery that is due as
+	// DeliverySending until lease from now, counts the attempt and returns
+	// it, or returns nil if none is due. Sending deliveries whose lease has
+	// run out are due again.
+	ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*WebhookDelivery, error)
+	// UpdateWebhookDelivery stores the outcome of a delivery attempt.
+	UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+
+	// Locks
+	// AcquireLock takes or renews the named lease for holder until ttl from
+	// now. It reports false, without error, while another holder's lease
+	// has not expired.
+	AcquireLock(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+}
+
+// Anchor statuses, used both per backend and for a batch as a whole.
+const (
+	AnchorPending   = "pending"   // saved, root not yet submitted
+	AnchorSubmitted = "submitted" // root submitted for timestamping
+	AnchorFailed    = "failed"    // submission failed, or the proof did not verify
+	AnchorConfirmed = "confirmed" // proof upgraded with a block attestation
+	AnchorVerified  = "verified"  // attestation checked against the block header
+)
+
+// Anchor job statuses.
+const (
+	JobQueued    = "queued"    // waiting for a worker, possibly to retry
+	JobRunning   = "running"   // claimed by a worker
+	JobSucceeded = "succeeded" // batch saved and every backend anchored
+	JobFailed    = "failed"    // out of attempts, or nothing to batch
+)
+
+// Anchor job steps, recording how far a job has got.
+const (
+	StepBatching  = "batching"  // building and saving the batch
+	StepAnchoring = "anchoring" // submitting the root to the backends
+	StepDone      = "done"
+)
+
+// Webhook delivery statuses.
+const (
+	DeliveryQueued    = "queued"    // waiting to be sent, possibly to retry
+	DeliverySending   = "sending"   // claimed by a worker
+	DeliveryDelivered = "delivered" // the receiver answered 2xx
+	DeliveryFailed    = "failed"    // out of attempts
+)
+
+type MetadataRecord struct {
+	SKU           string    `json:"sku"`
+	Quantity      int       `json:"quantity"`
+	WeightKg      float64   `json:"weight_kg"`
+	DimensionsCm  []float64 `json:"dimensions_cm"`
+	PackageType   string    `json:"package_type"`
+	SourceID      string    `json:"source_id"`
+	DestinationID string    `json:"destination_id"`
+	CarrierID     string    `json:"carrier_id"`
+	UrgencyLevel  string    `json:"urgency_level"`
+	HSCode        string    `json:"hs_code"`
+	TrackingID    string    `json:"tracking_id"`
+	Timestamp     string    `json:"timestamp"`
+	NestedWithin  string    `json:"nested_within"`
+}
+
+// Device is a registered scanner. PublicKey is a base64 Ed25519 key used to
+// verify the scans it signs.
+type Device struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// Batch is an anchored set of scans, identified by its Merkle root.
+type Batch struct {
+	ID                  string   `json:"id,omitempty"`
+	RootHash            string   `json:"root_hash"`
+	ScanCount           int      `json:"scan_count"`
+	IncludedTrackingIDs []string `json:"included_tracking_ids"`
+	Note                string   `json:"note"`
+	HashScheme          string   `json:"hash_scheme"`
+	ScanTimeFrom        string   `json:"scan_time_from"`
+	ScanTimeTo          string   `json:"scan_time_to"`
+	AnchorStatus        string   `json:"anchor_status"`
+	AnchoredAt          string   `json:"anchored_at,omitempty"`
+	CreatedAt           string   `json:"created_at,omitempty"`
+}
+
+// BatchAnchor is a batch root's state on one anchoring backend. Reference
+// identifies the submission on the backend (a transaction hash, a file path)
+// and Proof holds whatever the backend returned to prove it later.
+type BatchAnchor struct {
+	BatchID     string `json:"batch_id"`
+	Backend     string `json:"backend"`
+	Status      string `json:"status"`
+	Reference   string `json:"reference,omitempty"`
+	Proof       []byte `json:"proof,omitempty"`
+	Error       string `json:"error,omitempty"`
+	BlockHeight int64  `json:"block_height,omitempty"` // 0 until a block attestation is found
+	BlockTime   string `json:"block_time,omitempty"`   // checked block time, or a TSA's signed genTime
+	CreatedAt   string `json:"created_at,omitempty"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+// AnchorJob is a request to batch and anchor pending scans, carried out by
+// a worker. Since, Until and ScanLimit are the BatchFilter the batch is built
+// with. BatchID is set once the batch has been saved; a retry after that only
+// re-anchors the backends that failed. RunAfter is when a queued job may next
+// be tried, or when a running job's lease runs out.
+type AnchorJob struct {
+	ID          string `json:"id,omitempty"`
+	Status      string `json:"status"`
+	Step        string `json:"step,omitempty"`
+	Since       string `json:"since,omitempty"`
+	Until       string `json:"until,omitempty"`
+	ScanLimit   int    `json:"scan_limit,omitempty"`
+	Note        string `json:"note"`
+	BatchID     string `json:"batch_id,omitempty"`
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"max_attempts"`
+	Error       string `json:"error,omitempty"`
+	RunAfter    string `json:"run_after,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+// Filter returns the BatchFilter the job's batch is built with.
+func (j *AnchorJob) Filter() (BatchFilter, error) {
+	filter := BatchFilter{Limit: j.ScanLimit}
+	var err error
+	if j.Since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, j.Since); err != nil {
+			return filter, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if j.Until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, j.Until); err != nil {
+			return filter, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	return filter, nil
+}
+
+// Webhook is a subscription: events of the listed types are POSTed to URL,
+// signed with Secret.
+type Webhook struct {
+	ID        string   `json:"id,omitempty"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"created_at,omitempty"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to one subscription.
+// Payload is the exact body POSTed. RunAfter is when a queued delivery may
+// next be tried, or when a sending delivery's lease runs out. ReplayOf is set
+// on deliveries queued by a replay, to the delivery they repeat.
+type WebhookDelivery struct {
+	ID             string          `json:"id,omitempty"`
+	WebhookID      string          `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	MaxAttempts    int             `json:"max_attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"` // of the last attempt
+	Error          string          `json:"error,omitempty"`
+	ReplayOf       string          `json:"replay_of,omitempty"`
+	RunAfter       string          `json:"run_after,omitempty"`
+	DeliveredAt    string          `json:"delivered_at,omitempty"`
+	CreatedAt      string          `json:"created_at,omitempty"`
+	UpdatedAt      string          `json:"updated_at,omitempty"`
+}
+
+// DeliveryQuery selects webhook deliveries for the delivery log. Empty
+// fields match everything.
+type DeliveryQuery struct {
+	WebhookID string
+	Event     string
+	Status    string
+	Limit     int
+}
+
+// ScanQuery selects scans for listing. Empty fields match everything.
+type ScanQuery struct {
+	Result     string
+	TrackingID string
+	SKU        string // matched through the scan's metadata
+	Location   string
+	DeviceID   string
+	Field      string    // a field named by one of the scan's reasons
+	Since      time.Time // scan_time >= Since
+	Until      time.Time // scan_time < Until
+	// After, when set, skips scans up to and including the one it points at
+	// in QueryScans order.
+	After *ScanCursor
+	Limit int
+}
+
+// ScanCursor is a position in QueryScans order.
+type ScanCursor struct {
+	ScanTime time.Time `json:"t"`
+	ID       string    `json:"id"`
+}
+
+// BatchFilter bounds which unbatched scans go into the next batch. Zero
+// values mean no bound.
+type BatchFilter struct {
+	Since time.Time // scan_time >= Since
+	Until time.Time // scan_time < Until
+	Limit int
+}
+
+// PendingScan is a scan waiting to be anchored.
+type PendingScan struct {
+	ScanHash   string `json:"scan_hash"`
+	TrackingID string `json:"tracking_id"`
+	ScanTime   string `json:"scan_time"`
+}
+
+// ScanProof is the Merkle proof of a scan's inclusion in a batch.
+type ScanProof struct {
+	BatchID    string             `json:"batch_id"`
+	ScanHash   string             `json:"scan_hash"`
+	TrackingID string             `json:"tracking_id"`
+	LeafIndex  int                `json:"leaf_index"`
+	Proof      []crypto.ProofStep `json:"proof"`
+}
@@ -4,48 +4,74 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/models"
 )
 
-var supabaseAPIURL string
-var supabaseKey string
+// SupabaseClient is a Store backed by the Supabase REST (PostgREST) API.
+type SupabaseClient struct {
+	apiURL string
+	key    string
+	http   *http.Client
+}
+
+var _ Store = (*SupabaseClient)(nil)
 
-func InitSupabaseClient() {
-	supabaseAPIURL = os.Getenv("SUPABASE_API_URL")
-	supabaseKey = os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-	if supabaseAPIURL == "" || supabaseKey == "" {
-		panic("Missing Supabase API URL or Service Key in .env")
+func NewSupabaseClient() (*SupabaseClient, error) {
+	apiURL := os.Getenv("SUPABASE_API_URL")
+	key := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	if apiURL == "" || key == "" {
+		return nil, fmt.Errorf("missing Supabase API URL or Service Key in .env")
 	}
+	return &SupabaseClient{apiURL: apiURL, key: key, http: &http.Client{}}, nil
 }
 
-func PostMetadata(payload any) error {
-	url := fmt.Sprintf("%s/metadata", supabaseAPIURL)
+func (s *SupabaseClient) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", s.apiURL, path), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
 
+	req.Header.Set("apikey", s.key)
+	req.Header.Set("Authorization", "Bearer "+s.key)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Prefer", "return=representation")
+	} else {
+		req.Header.Set("Accept", "application/json")
+	}
+	return req, nil
+}
+
+func (s *SupabaseClient) PostMetadata(ctx context.Context, payload models.MetadataPayload) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(body))
+	req, err := s.newRequest(ctx, "POST", "metadata", bytes.NewBuffer(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
-	req.Header.Set("apikey", supabaseKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Prefer", "return=representation")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.http.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusConflict {
+		return ErrDuplicateTrackingID
+	}
 	if resp.StatusCode >= 300 {
 		return fmt.Errorf("supabase responded with status %d", resp.StatusCode)
 	}
@@ -53,68 +79,61 @@ func PostMetadata(payload any) error {
 	return nil
 }
 
-func PostScanLog(payload any) error {
-	url := fmt.Sprintf("%s/scan_log", supabaseAPIURL)
-
-	body, err := json.Marshal(payload)
+func (s *SupabaseClient) PostScanLog(ctx context.Context, scan *models.ScanLog) error {
+	body, err := json.Marshal(scan)
 	if err != nil {
 		return fmt.Errorf("failed to marshal scan log: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(body))
+	req, err := s.newRequest(ctx, "POST", "scan_log", bytes.NewBuffer(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
-	req.Header.Set("apikey", supabaseKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Prefer", "return=representation")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.http.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("supabase responded with status %d", resp.StatusCode)
+		apiErr := readAPIError(resp)
+		if apiErr.Code == "23505" && chainIndexes[apiErr.constraint()] {
+			return ErrChainConflict
+		}
+		return apiErr
 	}
 
+	var created []models.ScanLog
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(created) > 0 {
+		scan.ID = created[0].ID
+	}
 	return nil
 }
 
-type MetadataRecord struct {
-	SKU           string    `json:"sku"`
-	Quantity      int       `json:"quantity"`
-	WeightKg      float64   `json:"weight_kg"`
-	DimensionsCm  []float64 `json:"dimensions_cm"`
-	PackageType   string    `json:"package_type"`
-	SourceID      string    `json:"source_id"`
-	DestinationID string    `json:"destination_id"`
-	CarrierID     string    `json:"carrier_id"`
-	UrgencyLevel  string    `json:"urgency_level"`
-	HSCode        string    `json:"hs_code"`
-	TrackingID    string    `json:"tracking_id"`
-	Timestamp     string    `json:"timestamp"`
-	NestedWithin  string    `json:"nested_within"`
-}
+func (s *SupabaseClient) FetchLastScanHash(ctx context.Context, trackingID string) (string, error) {
+	q := url.Values{}
+	q.Set("select", "scan_hash,prev_scan_hash,scan_time")
+	q.Set("tracking_id", "eq."+trackingID)
+	q.Set("order", "scan_time.asc,id.asc")
 
-func FetchMetadataByTrackingID(trackingID string) (*MetadataRecord, error) {
-	url := fmt.Sprintf("%s/metadata?tracking_id=eq.%s", supabaseAPIURL, trackingID)
+	var rows []models.ScanLog
+	if err := s.get(ctx, "scan_log?"+q.Encode(), &rows); err != nil {
+		return "", err
+	}
+	return chainHead(rows), nil
+}
 
-	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+func (s *SupabaseClient) FetchMetadataByTrackingID(ctx context.Context, trackingID string) (*MetadataRecord, error) {
+	req, err := s.newRequest(ctx, "GET", fmt.Sprintf("metadata?tracking_id=eq.%s", trackingID), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("apikey", supabaseKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseKey)
-	req.Header.Set("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.http.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -141,20 +160,13 @@ func FetchMetadataByTrackingID(trackingID string) (*MetadataRecord, error) {
 	return &records[0], nil
 }
 
-func FetchScanHistory(trackingID string) ([]map[string]interface{}, error) {
-	url := fmt.Sprintf("%s/scan_log?tracking_id=eq.%s&order=scan_time.desc", supabaseAPIURL, trackingID)
-
-	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+func (s *SupabaseClient) FetchScanHistory(ctx context.Context, trackingID string) ([]models.ScanLog, error) {
+	req, err := s.newRequest(ctx, "GET", fmt.Sprintf("scan_log?tracking_id=eq.%s&order=scan_time.desc", trackingID), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("apikey", supabaseKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseKey)
-	req.Header.Set("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.http.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -164,7 +176,7 @@ func FetchScanHistory(trackingID string) ([]map[string]interface{}, error) {
 		return nil, fmt.Errorf("supabase error %d", resp.StatusCode)
 	}
 
-	var history []map[string]interface{}
+	var history []models.ScanLog
 	err = json.NewDecoder(resp.Body).Decode(&history)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
@@ -173,88 +185,732 @@ func FetchScanHistory(trackingID string) ([]map[string]interface{}, error) {
 	return history, nil
 }
 
-func FetchRecentScanHashesForBatch() ([]string, []string, error) {
-	url := fmt.Sprintf("%s/scan_log?select=scan_hash,tracking_id", supabaseAPIURL)
+func (s *SupabaseClient) RegisterDevice(ctx context.Context, device *Device) error {
+	body, err := json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device: %w", err)
+	}
 
-	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+	req, err := s.newRequest(ctx, "POST", "scanner_device", bytes.NewBuffer(body))
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
 
-	req.Header.Set("apikey", supabaseKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseKey)
-	req.Header.Set("Accept", "application/json")
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	if resp.StatusCode == http.StatusConflict {
+		return ErrDuplicateDevice
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("supabase responded with status %d", resp.StatusCode)
+	}
+
+	var created []Device
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(created) > 0 {
+		device.CreatedAt = created[0].CreatedAt
+	}
+	return nil
+}
+
+func (s *SupabaseClient) FetchDevice(ctx context.Context, deviceID string) (*Device, error) {
+	var devices []Device
+	if err := s.get(ctx, "scanner_device?id=eq."+url.QueryEscape(deviceID), &devices); err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, nil
+	}
+	return &devices[0], nil
+}
+
+func (s *SupabaseClient) UseDeviceSignature(ctx context.Context, deviceID, signature string) error {
+	row := map[string]string{"signature": signature, "device_id": deviceID}
+	err := s.insert(ctx, "device_signature", row, nil)
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Code == "23505" {
+		return ErrSignatureReused
+	}
+	return err
+}
+
+func (s *SupabaseClient) FetchUnbatchedScans(ctx context.Context, filter BatchFilter) ([]PendingScan, error) {
+	q := url.Values{}
+	q.Set("select", "scan_hash,tracking_id,scan_time")
+	q.Set("batch_id", "is.null")
+	q.Set("scan_hash", "not.is.null")
+	q.Set("order", "scan_time.asc")
+	if !filter.Since.IsZero() {
+		q.Add("scan_time", "gte."+filter.Since.UTC().Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		q.Add("scan_time", "lt."+filter.Until.UTC().Format(time.RFC3339))
+	}
+	if filter.Limit > 0 {
+		q.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	req, err := s.newRequest(ctx, "GET", "scan_log?"+q.Encode(), nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
+	}
+
+	var pending []PendingScan
+	if err := json.NewDecoder(resp.Body).Decode(&pending); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return pending, nil
+}
+
+func (s *SupabaseClient) CountUnbatchedScans(ctx context.Context) (int, error) {
+	q := url.Values{}
+	q.Set("batch_id", "is.null")
+	q.Set("scan_hash", "not.is.null")
+	return s.count(ctx, "scan_log", q)
+}
+
+// SaveBatch saves the batch, claims its scans and stores the proofs through
+// rpc/save_batch, so a conflict leaves nothing behind.
+func (s *SupabaseClient) SaveBatch(ctx context.Context, batch *Batch, proofs []ScanProof) error {
+	if proofs == nil {
+		proofs = []ScanProof{}
+	}
+	var saved []Batch
+	err := s.insert(ctx, "rpc/save_batch", map[string]interface{}{"batch": batch, "proofs": proofs}, &saved)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Code == "PT409" {
+		return ErrBatchConflict
+	}
+	if err != nil {
+		return err
+	}
+	if len(saved) == 0 {
+		return fmt.Errorf("supabase returned no batch row")
+	}
+	batch.ID = saved[0].ID
+	batch.CreatedAt = saved[0].CreatedAt
+	return nil
+}
+
+func (s *SupabaseClient) SetBatchAnchorStatus(ctx context.Context, batchID string, status string) error {
+	update := map[string]interface{}{"anchor_status": status}
+	if status == AnchorSubmitted {
+		update["anchored_at"] = time.Now().UTC().Format(time.RFC3339)
+	}
+	return s.patchBatch(ctx, batchID, update)
+}
+
+func (s *SupabaseClient) SaveBatchAnchor(ctx context.Context, anchor *BatchAnchor) error {
+	// Every column is sent so an upsert clears values from an earlier attempt.
+	row := map[string]interface{}{
+		"batch_id":     anchor.BatchID,
+		"backend":      anchor.Backend,
+		"status":       anchor.Status,
+		"reference":    anchor.Reference,
+		"proof":        nil,
+		"error":        anchor.Error,
+		"block_height": nil,
+		"block_time":   nil,
+		"updated_at":   time.Now().UTC().Format(time.RFC3339),
+	}
+	if len(anchor.Proof) > 0 {
+		row["proof"] = anchor.Proof
+	}
+	if anchor.BlockHeight > 0 {
+		row["block_height"] = anchor.BlockHeight
+	}
+	if anchor.BlockTime != "" {
+		row["block_time"] = anchor.BlockTime
+	}
+	body, _ := json.Marshal(row)
+
+	req, err := s.newRequest(ctx, "POST", "batch_anchor?on_conflict=batch_id,backend", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", "return=representation,resolution=merge-duplicates")
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	var raw []map[string]string
-	err = json.NewDecoder(resp.Body).Decode(&raw)
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
+	}
+
+	var saved []BatchAnchor
+	if err := json.NewDecoder(resp.Body).Decode(&saved); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(saved) > 0 {
+		anchor.CreatedAt = saved[0].CreatedAt
+		anchor.UpdatedAt = saved[0].UpdatedAt
+	}
+	return nil
+}
+
+func (s *SupabaseClient) FetchBatchAnchors(ctx context.Context, batchID string) ([]BatchAnchor, error) {
+	var anchors []BatchAnchor
+	err := s.get(ctx, "batch_anchor?batch_id=eq."+url.QueryEscape(batchID)+"&order=backend.asc", &anchors)
+	return anchors, err
+}
+
+func (s *SupabaseClient) FetchAnchorsByStatus(ctx context.Context, backend string, statuses ...string) ([]BatchAnchor, error) {
+	q := url.Values{}
+	q.Set("backend", "eq."+backend)
+	q.Set("status", "in.("+strings.Join(statuses, ",")+")")
+	q.Set("order", "created_at.asc")
+
+	var anchors []BatchAnchor
+	err := s.get(ctx, "batch_anchor?"+q.Encode(), &anchors)
+	return anchors, err
+}
+
+// patchBatch applies a partial update to one scan_batch row.
+func (s *SupabaseClient) patchBatch(ctx context.Context, batchID string, update map[string]interface{}) error {
+	body, _ := json.Marshal(update)
+
+	req, err := s.newRequest(ctx, "PATCH", "scan_batch?id=eq."+url.QueryEscape(batchID), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (s *SupabaseClient) FetchProof(ctx context.Context, scanHash string) (*ScanProof, *Batch, error) {
+	q := url.Values{}
+	q.Set("scan_hash", "eq."+scanHash)
+	q.Set("select", "*,scan_batch(*)")
+
+	req, err := s.newRequest(ctx, "GET", "scan_proof?"+q.Encode(), nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	var hashes []string
-	var ids []string
-	for _, r := range raw {
-		if r["scan_hash"] != "" {
-			hashes = append(hashes, r["scan_hash"])
-			ids = append(ids, r["tracking_id"])
-		}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	return hashes, ids, nil
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, nil, fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
+	}
+
+	var rows []struct {
+		ScanProof
+		Batch *Batch `json:"scan_batch"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(rows) == 0 || rows[0].Batch == nil {
+		return nil, nil, nil
+	}
+	return &rows[0].ScanProof, rows[0].Batch, nil
 }
-func SaveBatchRoot(rootHash string, count int, trackingIDs []string, note string) error {
-	payload := map[string]interface{}{
-		"root_hash":             rootHash,
-		"scan_count":            count,
-		"included_tracking_ids": trackingIDs,
-		"note":                  note,
+
+func (s *SupabaseClient) FetchBatch(ctx context.Context, batchID string) (*Batch, error) {
+	var batches []Batch
+	if err := s.get(ctx, "scan_batch?id=eq."+url.QueryEscape(batchID), &batches); err != nil {
+		return nil, err
 	}
+	if len(batches) == 0 {
+		return nil, nil
+	}
+	return &batches[0], nil
+}
+
+func (s *SupabaseClient) FetchBatches(ctx context.Context) ([]Batch, error) {
+	var batches []Batch
+	err := s.get(ctx, "scan_batch?order=created_at.asc", &batches)
+	return batches, err
+}
+
+func (s *SupabaseClient) FetchBatchProofs(ctx context.Context, batchID string) ([]ScanProof, error) {
+	var proofs []ScanProof
+	err := s.get(ctx, "scan_proof?batch_id=eq."+url.QueryEscape(batchID)+"&order=leaf_index.asc", &proofs)
+	return proofs, err
+}
+
+func (s *SupabaseClient) CreateAnchorJob(ctx context.Context, job *AnchorJob) error {
+	row := map[string]interface{}{
+		"since":        nullIfEmpty(job.Since),
+		"until":        nullIfEmpty(job.Until),
+		"scan_limit":   job.ScanLimit,
+		"note":         job.Note,
+		"max_attempts": job.MaxAttempts,
+	}
+	var saved []AnchorJob
+	if err := s.insert(ctx, "anchor_job", row, &saved); err != nil {
+		return err
+	}
+	if len(saved) == 0 {
+		return fmt.Errorf("supabase returned no anchor job row")
+	}
+	*job = saved[0]
+	return nil
+}
 
-	body, _ := json.Marshal(payload)
-	url := fmt.Sprintf("%s/scan_batch", supabaseAPIURL)
+func (s *SupabaseClient) FetchAnchorJob(ctx context.Context, jobID string) (*AnchorJob, error) {
+	var jobs []AnchorJob
+	if err := s.get(ctx, "anchor_job?id=eq."+url.QueryEscape(jobID), &jobs); err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return &jobs[0], nil
+}
 
-	req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(body))
+func (s *SupabaseClient) ClaimAnchorJob(ctx context.Context, lease time.Duration) (*AnchorJob, error) {
+	var jobs []AnchorJob
+	if err := s.insert(ctx, "rpc/claim_anchor_job", map[string]interface{}{"lease_seconds": lease.Seconds()}, &jobs); err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return &jobs[0], nil
+}
+
+func (s *SupabaseClient) UpdateAnchorJob(ctx context.Context, job *AnchorJob) error {
+	job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	body, _ := json.Marshal(map[string]interface{}{
+		"status":     job.Status,
+		"step":       job.Step,
+		"batch_id":   nullIfEmpty(job.BatchID),
+		"error":      job.Error,
+		"run_after":  job.RunAfter,
+		"updated_at": job.UpdatedAt,
+	})
+
+	req, err := s.newRequest(ctx, "PATCH", "anchor_job?id=eq."+url.QueryEscape(job.ID), bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("apikey", supabaseKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseKey)
-	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (s *SupabaseClient) CreateWebhook(ctx context.Context, hook *Webhook) error {
+	row := map[string]interface{}{
+		"url":    hook.URL,
+		"events": hook.Events,
+		"secret": hook.Secret,
+	}
+	var saved []Webhook
+	if err := s.insert(ctx, "webhook", row, &saved); err != nil {
+		return err
+	}
+	if len(saved) == 0 {
+		return fmt.Errorf("supabase returned no webhook row")
+	}
+	*hook = saved[0]
+	return nil
+}
+
+func (s *SupabaseClient) FetchWebhook(ctx context.Context, webhookID string) (*Webhook, error) {
+	var hooks []Webhook
+	if err := s.get(ctx, "webhook?id=eq."+url.QueryEscape(webhookID), &hooks); err != nil {
+		return nil, err
+	}
+	if len(hooks) == 0 {
+		return nil, nil
+	}
+	return &hooks[0], nil
+}
+
+func (s *SupabaseClient) FetchWebhooks(ctx context.Context) ([]Webhook, error) {
+	hooks := []Webhook{}
+	err := s.get(ctx, "webhook?order=created_at.asc", &hooks)
+	return hooks, err
+}
+
+func (s *SupabaseClient) DeleteWebhook(ctx context.Context, webhookID string) (bool, error) {
+	req, err := s.newRequest(ctx, "DELETE", "webhook?id=eq."+url.QueryEscape(webhookID), nil)
+	if err != nil {
+		return false, err
+	}
+	// Ask for the deleted rows to learn whether there was one.
 	req.Header.Set("Prefer", "return=representation")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.http.Do(req)
 	if err != nil {
+		return false, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
+	}
+	var deleted []Webhook
+	if err := json.NewDecoder(resp.Body).Decode(&deleted); err != nil {
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return len(deleted) > 0, nil
+}
+
+func (s *SupabaseClient) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	row := map[string]interface{}{
+		"webhook_id":   delivery.WebhookID,
+		"event":        delivery.Event,
+		"payload":      delivery.Payload,
+		"max_attempts": delivery.MaxAttempts,
+		"replay_of":    nullIfEmpty(delivery.ReplayOf),
+	}
+	var saved []WebhookDelivery
+	if err := s.insert(ctx, "webhook_delivery", row, &saved); err != nil {
 		return err
 	}
+	if len(saved) == 0 {
+		return fmt.Errorf("supabase returned no webhook delivery row")
+	}
+	*delivery = saved[0]
+	return nil
+}
+
+func (s *SupabaseClient) FetchWebhookDelivery(ctx context.Context, deliveryID string) (*WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	if err := s.get(ctx, "webhook_delivery?id=eq."+url.QueryEscape(deliveryID), &deliveries); err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+	return &deliveries[0], nil
+}
+
+func (s *SupabaseClient) FetchWebhookDeliveries(ctx context.Context, q DeliveryQuery) ([]WebhookDelivery, error) {
+	params := url.Values{}
+	params.Set("order", "created_at.desc,id.desc")
+	if q.WebhookID != "" {
+		params.Set("webhook_id", "eq."+q.WebhookID)
+	}
+	if q.Event != "" {
+		params.Set("event", "eq."+q.Event)
+	}
+	if q.Status != "" {
+		params.Set("status", "eq."+q.Status)
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	deliveries := []WebhookDelivery{}
+	err := s.get(ctx, "webhook_delivery?"+params.Encode(), &deliveries)
+	return deliveries, err
+}
+
+func (s *SupabaseClient) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	if err := s.insert(ctx, "rpc/claim_webhook_delivery", map[string]interface{}{"lease_seconds": lease.Seconds()}, &deliveries); err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+	return &deliveries[0], nil
+}
+
+func (s *SupabaseClient) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	delivery.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	body, _ := json.Marshal(map[string]interface{}{
+		"status":          delivery.Status,
+		"response_status": delivery.ResponseStatus,
+		"error":           delivery.Error,
+		"run_after":       delivery.RunAfter,
+		"delivered_at":    nullIfEmpty(delivery.DeliveredAt),
+		"updated_at":      delivery.UpdatedAt,
+	})
+
+	req, err := s.newRequest(ctx, "PATCH", "webhook_delivery?id=eq."+url.QueryEscape(delivery.ID), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("supabase error %d", resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
 	}
 	return nil
 }
-func FetchAllScans() ([]map[string]interface{}, error) {
-	url := fmt.Sprintf("%s/scan_log?order=scan_time.desc", supabaseAPIURL)
 
-	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+func (s *SupabaseClient) AcquireLock(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"lock_name":   name,
+		"lock_holder": holder,
+		"ttl_seconds": ttl.Seconds(),
+	})
+
+	req, err := s.newRequest(ctx, "POST", "rpc/acquire_scheduler_lock", bytes.NewBuffer(body))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return false, err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
 	}
 
-	req.Header.Set("apikey", supabaseKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseKey)
-	req.Header.Set("Accept", "application/json")
+	var acquired bool
+	if err := json.NewDecoder(resp.Body).Decode(&acquired); err != nil {
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return acquired, nil
+}
+
+// count returns how many rows of table match the filters in q.
+func (s *SupabaseClient) count(ctx context.Context, table string, q url.Values) (int, error) {
+	q.Set("limit", "1")
+	if q.Get("select") == "" {
+		q.Set("select", "id")
+	}
+	req, err := s.newRequest(ctx, "GET", table+"?"+q.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Prefer", "count=exact")
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
+	}
+
+	// Content-Range is "<first>-<last>/<total>", or "*/0" when empty.
+	contentRange := resp.Header.Get("Content-Range")
+	slash := strings.LastIndex(contentRange, "/")
+	n, err := strconv.Atoi(contentRange[slash+1:])
+	if slash < 0 || err != nil {
+		return 0, fmt.Errorf("unexpected Content-Range %q", contentRange)
+	}
+	return n, nil
+}
+
+// get fetches path and decodes the JSON response into out.
+func (s *SupabaseClient) get(ctx context.Context, path string, out any) error {
+	req, err := s.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// insert POSTs rows to a table and, when out is non-nil, decodes the
+// returned representation into it.
+func (s *SupabaseClient) insert(ctx context.Context, table string, rows any, out any) error {
+	body, err := json.Marshal(rows)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", table, err)
+	}
+
+	req, err := s.newRequest(ctx, "POST", table, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return readAPIError(resp)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// apiError is an error response from PostgREST. Code is the SQLSTATE of a
+// database error, or PostgREST's own PGRST code.
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	body    []byte
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("supabase error %d: %s", e.Status, e.body)
+}
+
+// constraint returns the name of the constraint a unique violation names in
+// its message, or "" if there is none.
+func (e *apiError) constraint() string {
+	_, rest, ok := strings.Cut(e.Message, `constraint "`)
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, `"`)
+	return name
+}
+
+// readAPIError reads the error response resp carries.
+func readAPIError(resp *http.Response) *apiError {
+	body, _ := io.ReadAll(resp.Body)
+	e := &apiError{Status: resp.StatusCode, body: body}
+	_ = json.Unmarshal(body, e)
+	return e
+}
+
+func (s *SupabaseClient) QueryScans(ctx context.Context, q ScanQuery) ([]models.ScanLog, error) {
+	params := scanParams(q)
+	if a := q.After; a != nil {
+		t := a.ScanTime.UTC().Format(time.RFC3339Nano)
+		params.Set("or", fmt.Sprintf("(scan_time.lt.%s,and(scan_time.eq.%s,id.lt.%s))", t, t, a.ID))
+	}
+	params.Set("order", "scan_time.desc,id.desc")
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	scans := []models.ScanLog{}
+	if err := s.get(ctx, "scan_log?"+params.Encode(), &scans); err != nil {
+		return nil, err
+	}
+	return scans, nil
+}
+
+func (s *SupabaseClient) CountScans(ctx context.Context, q ScanQuery) (int, error) {
+	params := scanParams(q)
+	if q.SKU == "" {
+		params.Set("select", "id")
+	} else {
+		params.Set("select", "id,metadata!inner(sku)")
+	}
+	return s.count(ctx, "scan_log", params)
+}
+
+// scanParams turns every ScanQuery filter except After into PostgREST
+// filters on scan_log. The SKU is matched through an inner join on the
+// scan's metadata, embedded through the metadata(scan_log) computed
+// relationship; the metadata column it adds is dropped when the rows are
+// decoded.
+func scanParams(q ScanQuery) url.Values {
+	params := url.Values{}
+	params.Set("select", "*")
+	if q.Result != "" {
+		params.Set("result", "eq."+q.Result)
+	}
+	if q.TrackingID != "" {
+		params.Set("tracking_id", "eq."+q.TrackingID)
+	}
+	if q.SKU != "" {
+		params.Set("select", "*,metadata!inner(sku)")
+		params.Set("metadata.sku", "eq."+q.SKU)
+	}
+	if q.Location != "" {
+		params.Set("location", "eq."+q.Location)
+	}
+	if q.DeviceID != "" {
+		params.Set("device_id", "eq."+q.DeviceID)
+	}
+	if q.Field != "" {
+		field, _ := json.Marshal([]map[string]string{{"field": q.Field}})
+		params.Set("reasons", "cs."+string(field))
+	}
+	var times []string
+	if !q.Since.IsZero() {
+		times = append(times, "scan_time.gte."+q.Since.UTC().Format(time.RFC3339Nano))
+	}
+	if !q.Until.IsZero() {
+		times = append(times, "scan_time.lt."+q.Until.UTC().Format(time.RFC3339Nano))
+	}
+	if len(times) > 0 {
+		params.Set("and", "("+strings.Join(times, ",")+")")
+	}
+	return params
+}
+
+func (s *SupabaseClient) FetchAllScans(ctx context.Context) ([]models.ScanLog, error) {
+	req, err := s.newRequest(ctx, "GET", "scan_log?order=scan_time.desc", nil)
+	if err != nil {
+		return nil, err
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.http.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch scans: %w", err)
 	}
@@ -265,7 +921,7 @@ func FetchAllScans() ([]map[string]interface{}, error) {
 		return nil, fmt.Errorf("supabase error %d: %s", resp.StatusCode, body)
 	}
 
-	var scans []map[string]interface{}
+	var scans []models.ScanLog
 	if err := json.NewDecoder(resp.Body).Decode(&scans); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
@@ -0,0 +1,98 @@
+// Package device verifies scans signed by registered scanner devices.
+//
+// A device signs, with its Ed25519 key, the RFC 8785 canonical JSON of an
+// object holding exactly these fields of the scan payload:
+//
+//	tracking_id, scanned_quantity, scanned_weight_kg, scanned_dimensions_cm,
+//	location, device_id, signed_at
+//
+// tracking_id is the lower-case UUID and signed_at an RFC 3339 time. The
+// base64 signature is sent in the payload's signature field. The store
+// accepts each signature once; a device re-signs, with a new signed_at, to
+// submit the same scan again.
+package device
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/crypto"
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/models"
+)
+
+// MaxClockSkew bounds how far signed_at may be from the server's clock. A
+// signature is accepted once, and only within this window, so a captured
+// signed scan cannot be replayed.
+const MaxClockSkew = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature is returned when the signature does not match the
+	// payload and the device's key.
+	ErrInvalidSignature = errors.New("device signature is invalid")
+	// ErrStaleSignature is returned when signed_at is outside MaxClockSkew.
+	ErrStaleSignature = errors.New("signed_at is too far from server time")
+)
+
+// ParsePublicKey decodes a base64 Ed25519 public key.
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// SigningPayload returns the exact bytes a device signs for a scan.
+func SigningPayload(p models.ScanPayload) ([]byte, error) {
+	return crypto.CanonicalJSON(map[string]interface{}{
+		"tracking_id":           strings.ToLower(p.TrackingID.String()),
+		"scanned_quantity":      p.ScannedQuantity,
+		"scanned_weight_kg":     p.ScannedWeightKg,
+		"scanned_dimensions_cm": p.ScannedDimensions,
+		"location":              p.Location,
+		"device_id":             p.DeviceID,
+		"signed_at":             p.SignedAt,
+	})
+}
+
+// Verify checks that p was signed by dev within MaxClockSkew of now.
+func Verify(dev *db.Device, p models.ScanPayload, now time.Time) error {
+	key, err := ParsePublicKey(dev.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	signedAt, err := time.Parse(time.RFC3339, p.SignedAt)
+	if err != nil {
+		return fmt.Errorf("invalid signed_at %q: %w", p.SignedAt, err)
+	}
+	if d := now.Sub(signedAt); d > MaxClockSkew || d < -MaxClockSkew {
+		return ErrStaleSignature
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(p.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	// Replays are caught by the signature string, so it must be the one
+	// encoding of the signature bytes, without line breaks or stray bits.
+	if base64.StdEncoding.EncodeToString(sig) != p.Signature {
+		return ErrInvalidSignature
+	}
+	msg, err := SigningPayload(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	if !ed25519.Verify(key, msg, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
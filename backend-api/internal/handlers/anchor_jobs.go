@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/labstack/echo/v4"
+)
+
+// GetAnchorJob reports how far an anchor job has got: its status and step,
+// its attempts and last error, and once its batch is saved, the batch's
+// anchor status and its state on every anchoring backend.
+func (h *Handler) GetAnchorJob(c echo.Context) error {
+	job, err := h.Store.FetchAnchorJob(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch anchor job: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch anchor job"})
+	}
+	if job == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "anchor job not found"})
+	}
+
+	out := echo.Map{
+		"job_id":       job.ID,
+		"status":       job.Status,
+		"step":         job.Step,
+		"attempts":     job.Attempts,
+		"max_attempts": job.MaxAttempts,
+		"error":        job.Error,
+		"note":         job.Note,
+		"created_at":   job.CreatedAt,
+		"updated_at":   job.UpdatedAt,
+	}
+	if job.Status == db.JobQueued && job.Attempts > 0 {
+		out["retry_at"] = job.RunAfter
+	}
+	if job.BatchID == "" {
+		return c.JSON(http.StatusOK, out)
+	}
+
+	out["batch_id"] = job.BatchID
+	batch, err := h.Store.FetchBatch(c.Request().Context(), job.BatchID)
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch batch: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch batch"})
+	}
+	if batch != nil {
+		out["batch"] = batchStatus(*batch)
+	}
+	anchors, err := h.Store.FetchBatchAnchors(c.Request().Context(), job.BatchID)
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch batch anchors: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch batch anchors"})
+	}
+	out["anchors"] = anchorSummaries(anchors)
+	return c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/galanafai/aroni-backend/internal/audit"
+	"github.com/labstack/echo/v4"
+)
+
+// RunAudit recomputes every scan hash and checks it against the batch roots.
+func (h *Handler) RunAudit(c echo.Context) error {
+	report, err := audit.Run(c.Request().Context(), h.Store)
+	if err != nil {
+		c.Logger().Errorf("❌ Audit failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "audit failed"})
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
@@ -1,59 +1,120 @@
 package handlers
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"net/http"
-	"sort"
-	"strings"
+	"strconv"
 	"time"
 
+	"github.com/galanafai/aroni-backend/internal/anchor"
 	"github.com/galanafai/aroni-backend/internal/db"
-	"github.com/galanafai/aroni-backend/internal/utils"
+	"github.com/galanafai/aroni-backend/internal/ots"
 	"github.com/labstack/echo/v4"
 )
 
-// BuildMerkleRoot generates a simple root hash by sorting and hashing the concatenated hashes.
-func BuildMerkleRoot(hashes []string) string {
-	sort.Strings(hashes)
-	combined := strings.Join(hashes, "")
-	hash := sha256.Sum256([]byte(combined))
-	return hex.EncodeToString(hash[:])
-}
-
-// AnchorBatch handles batch creation, Merkle root calculation, and saving to scan_batch.
-func AnchorBatch(c echo.Context) error {
-	hashes, ids, err := db.FetchRecentScanHashesForBatch()
+// AnchorBatch queues a job that builds a Merkle tree over the scans not
+// yet in a batch, saves the root together with every scan's inclusion
+// proof, and anchors the root. It answers straight away with the job's ID;
+// GetAnchorJob reports how the job is going. The optional since/until
+// (RFC 3339) and limit parameters bound which pending scans are taken.
+func (h *Handler) AnchorBatch(c echo.Context) error {
+	filter, err := parseBatchFilter(c)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch scan hashes"})
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	if h.AnchorJobs == nil {
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "anchoring is not available"})
 	}
 
-	if len(hashes) == 0 {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "no scan hashes found"})
+	job := &db.AnchorJob{ScanLimit: filter.Limit, Note: c.FormValue("note")}
+	if !filter.Since.IsZero() {
+		job.Since = filter.Since.UTC().Format(time.RFC3339)
+	}
+	if !filter.Until.IsZero() {
+		job.Until = filter.Until.UTC().Format(time.RFC3339)
+	}
+	if err := h.AnchorJobs.Enqueue(c.Request().Context(), job); err != nil {
+		c.Logger().Errorf("❌ Failed to queue anchor job: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to queue anchor job"})
 	}
 
-	root := BuildMerkleRoot(hashes)
-	note := c.FormValue("note")
-	if note == "" {
-		note = "Batch anchored at " + time.Now().UTC().Format(time.RFC3339)
+	return c.JSON(http.StatusAccepted, echo.Map{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"status_url": "/api/anchor-jobs/" + job.ID,
+	})
+}
+
+// GetBatchOTSProof serves a batch's .ots proof for use with any
+// OpenTimestamps client.
+func (h *Handler) GetBatchOTSProof(c echo.Context) error {
+	batch, err := h.Store.FetchBatch(c.Request().Context(), c.Param("batch_id"))
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch batch: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch batch"})
+	}
+	if batch == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "batch not found"})
+	}
+	a, err := h.findAnchor(c, batch.ID, anchor.OTSBackend)
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch batch anchors: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch batch anchors"})
+	}
+	if a == nil || len(a.Proof) == 0 {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "batch has no OpenTimestamps proof"})
 	}
+	if _, err := ots.ParseDetached(a.Proof); err != nil {
+		c.Logger().Errorf("❌ Stored proof for batch %s is invalid: %v", batch.ID, err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "stored proof is invalid"})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", batch.RootHash+".txt.ots"))
+	return c.Blob(http.StatusOK, "application/vnd.opentimestamps.v1", a.Proof)
+}
 
-	err = db.SaveBatchRoot(root, len(hashes), ids, note)
+// GetBatchTimestampToken serves a batch's RFC 3161 timestamp token, which
+// `openssl ts -verify -token_in -digest <root>` checks directly.
+func (h *Handler) GetBatchTimestampToken(c echo.Context) error {
+	batch, err := h.Store.FetchBatch(c.Request().Context(), c.Param("batch_id"))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to save batch root"})
+		c.Logger().Errorf("❌ Failed to fetch batch: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch batch"})
 	}
-	err = utils.AnchorRootHashOTS(root, fmt.Sprintf("anchored/%s", root))
+	if batch == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "batch not found"})
+	}
+	a, err := h.findAnchor(c, batch.ID, anchor.RFC3161Backend)
 	if err != nil {
-		c.Logger().Errorf("❌ Failed to anchor root hash to Bitcoin: %v", err)
-	} else {
-		c.Logger().Infof("🔗 Root hash %s anchored to Bitcoin via OTS", root)
+		c.Logger().Errorf("❌ Failed to fetch batch anchors: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch batch anchors"})
+	}
+	if a == nil || len(a.Proof) == 0 {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "batch has no RFC 3161 timestamp token"})
 	}
 
-	return c.JSON(http.StatusOK, echo.Map{
-		"root_hash":    root,
-		"scan_count":   len(hashes),
-		"tracking_ids": ids,
-		"note":         note,
-	})
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", batch.RootHash+".tst"))
+	return c.Blob(http.StatusOK, echo.MIMEOctetStream, a.Proof)
+}
+
+func parseBatchFilter(c echo.Context) (db.BatchFilter, error) {
+	var filter db.BatchFilter
+	var err error
+
+	if v := c.FormValue("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if v := c.FormValue("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	if v := c.FormValue("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			return filter, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+	return filter, nil
 }
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"net/http"
+
+	"github.com/galanafai/aroni-backend/internal/anchor"
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/ots"
+	"github.com/labstack/echo/v4"
+)
+
+// ListBatches returns the anchor status of every batch, oldest first.
+func (h *Handler) ListBatches(c echo.Context) error {
+	batches, err := h.Store.FetchBatches(c.Request().Context())
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch batches: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch batches"})
+	}
+
+	out := make([]echo.Map, 0, len(batches))
+	for _, b := range batches {
+		out = append(out, batchStatus(b))
+	}
+	return c.JSON(http.StatusOK, echo.Map{"batches": out})
+}
+
+// GetBatchStatus returns a batch's anchor status together with its state
+// on every anchoring backend and the attestations currently in its
+// OpenTimestamps proof.
+func (h *Handler) GetBatchStatus(c echo.Context) error {
+	batch, err := h.Store.FetchBatch(c.Request().Context(), c.Param("batch_id"))
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch batch: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch batch"})
+	}
+	if batch == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "batch not found"})
+	}
+	anchors, err := h.Store.FetchBatchAnchors(c.Request().Context(), batch.ID)
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch batch anchors: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch batch anchors"})
+	}
+
+	status := batchStatus(*batch)
+	status["anchors"] = anchorSummaries(anchors)
+	attestations := []echo.Map{}
+	for _, a := range anchors {
+		if a.Backend != anchor.OTSBackend || len(a.Proof) == 0 {
+			continue
+		}
+		proof, err := ots.ParseDetached(a.Proof)
+		if err != nil {
+			c.Logger().Errorf("❌ Stored proof for batch %s is invalid: %v", batch.ID, err)
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "stored proof is invalid"})
+		}
+		for _, at := range proof.Timestamp.AllAttestations() {
+			attestations = append(attestations, echo.Map{
+				"commitment":  hex.EncodeToString(at.Msg),
+				"attestation": at.Attestation.String(),
+			})
+		}
+	}
+	status["attestations"] = attestations
+
+	return c.JSON(http.StatusOK, status)
+}
+
+// findAnchor returns a batch's anchor on one backend, or nil if it has none.
+func (h *Handler) findAnchor(c echo.Context, batchID, backend string) (*db.BatchAnchor, error) {
+	anchors, err := h.Store.FetchBatchAnchors(c.Request().Context(), batchID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range anchors {
+		if anchors[i].Backend == backend {
+			return &anchors[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func batchStatus(b db.Batch) echo.Map {
+	return echo.Map{
+		"batch_id":      b.ID,
+		"root_hash":     b.RootHash,
+		"scan_count":    b.ScanCount,
+		"created_at":    b.CreatedAt,
+		"anchor_status": b.AnchorStatus,
+		"anchored_at":   b.AnchoredAt,
+	}
+}
+
+// anchorSummaries describes each backend's anchor without its proof, which
+// is served separately.
+func anchorSummaries(anchors []db.BatchAnchor) []echo.Map {
+	out := make([]echo.Map, 0, len(anchors))
+	for _, a := range anchors {
+		out = append(out, echo.Map{
+			"backend":      a.Backend,
+			"status":       a.Status,
+			"reference":    a.Reference,
+			"error":        a.Error,
+			"has_proof":    len(a.Proof) > 0,
+			"block_height": a.BlockHeight,
+			"block_time":   a.BlockTime,
+			"created_at":   a.CreatedAt,
+			"updated_at":   a.UpdatedAt,
+		})
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/device"
+	"github.com/galanafai/aroni-backend/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterDevice registers a scanner and the public key its scans are
+// signed with. When DeviceRegistrationToken is set the request must carry it
+// as a bearer token.
+func (h *Handler) RegisterDevice(c echo.Context) error {
+	if h.DeviceRegistrationToken != "" {
+		token := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.DeviceRegistrationToken)) != 1 {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid registration token"})
+		}
+	}
+
+	var payload models.DevicePayload
+	if err := c.Bind(&payload); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid JSON"})
+	}
+	if err := validate.Struct(payload); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "validation failed", "details": err.Error()})
+	}
+	if _, err := device.ParsePublicKey(payload.PublicKey); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid public key", "details": err.Error()})
+	}
+
+	dev := &db.Device{ID: payload.DeviceID, Name: payload.Name, PublicKey: payload.PublicKey}
+	if err := h.Store.RegisterDevice(c.Request().Context(), dev); err != nil {
+		if errors.Is(err, db.ErrDuplicateDevice) {
+			return c.JSON(http.StatusConflict, echo.Map{"error": "device already registered"})
+		}
+		c.Logger().Errorf("❌ Failed to register device: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to register device"})
+	}
+
+	c.Logger().Infof("📟 Registered device %s", dev.ID)
+	return c.JSON(http.StatusCreated, dev)
+}
+
+// GetDevice returns a registered scanner.
+func (h *Handler) GetDevice(c echo.Context) error {
+	dev, err := h.Store.FetchDevice(c.Request().Context(), c.Param("device_id"))
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch device: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch device"})
+	}
+	if dev == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "device not found"})
+	}
+	return c.JSON(http.StatusOK, dev)
+}
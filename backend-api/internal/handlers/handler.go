@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"github.com/galanafai/aroni-backend/internal/anchor"
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/matching"
+	"github.com/galanafai/aroni-backend/internal/ots"
+	"github.com/galanafai/aroni-backend/internal/outbox"
+	"github.com/galanafai/aroni-backend/internal/receipt"
+	"github.com/galanafai/aroni-backend/internal/webhook"
+)
+
+// Handler holds the dependencies shared by the HTTP handlers.
+type Handler struct {
+	Store db.Store
+	Rules *matching.Rules
+	// Anchorers receive every batch root; each one's result is stored as a
+	// separate batch anchor.
+	Anchorers []anchor.Anchorer
+	// AnchorJobs carries out the jobs queued by AnchorBatch; nil rejects
+	// anchoring requests.
+	AnchorJobs *anchor.Worker
+	// Outbox queues scans the store could not take, for replay by
+	// ReplayScan; nil makes such scans fail.
+	Outbox *outbox.Outbox
+	// Receipts signs the receipt returned for every logged scan; nil
+	// disables receipts.
+	Receipts *receipt.Signer
+	// RequireDeviceSignatures rejects scans not signed by a registered device.
+	RequireDeviceSignatures bool
+	// DeviceRegistrationToken, when set, must be presented to register devices.
+	DeviceRegistrationToken string
+	// Webhooks sends event notifications to subscribers; nil rejects
+	// webhook requests. Events are published by wrapping Store in a
+	// webhook.Notifier.
+	Webhooks *webhook.Dispatcher
+	// WebhookAdminToken must be presented to manage webhooks and read their
+	// delivery log; webhook requests are rejected while it is empty.
+	WebhookAdminToken string
+	// WebhookAllowPrivateURLs lets subscriptions point at loopback,
+	// link-local and private addresses, for local receivers.
+	WebhookAllowPrivateURLs bool
+}
+
+func New(store db.Store) *Handler {
+	return &Handler{
+		Store:     store,
+		Rules:     matching.DefaultRules(),
+		Anchorers: []anchor.Anchorer{&anchor.OTS{Client: ots.NewClient(ots.DefaultCalendars)}},
+	}
+}
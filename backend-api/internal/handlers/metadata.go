@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"strings"
+	"errors"
 	"github.com/go-playground/validator/v10"
 	"github.com/galanafai/aroni-backend/internal/models"
 	"github.com/galanafai/aroni-backend/internal/db"
@@ -11,7 +11,7 @@ import (
 
 var validate = validator.New()
 
-func HandleMetadata(c echo.Context) error {
+func (h *Handler) HandleMetadata(c echo.Context) error {
 	var payload models.MetadataPayload
 
 	if err := c.Bind(&payload); err != nil {
@@ -22,9 +22,9 @@ func HandleMetadata(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "validation failed", "details": err.Error()})
 	}
 
-	err := db.PostMetadata(payload)
+	err := h.Store.PostMetadata(c.Request().Context(), payload)
 	if err != nil {
-		if strings.Contains(err.Error(), "409") {
+		if errors.Is(err, db.ErrDuplicateTrackingID) {
 			return c.JSON(http.StatusConflict, echo.Map{"error": "Tracking ID already exists"})
 		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to save metadata", "details": err.Error()})
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/galanafai/aroni-backend/internal/models"
+	"github.com/galanafai/aroni-backend/internal/outbox"
+	"github.com/labstack/echo/v4"
+)
+
+// ReplayScan stores a scan taken from the outbox, linking it to whatever
+// now heads its package's chain.
+func (h *Handler) ReplayScan(ctx context.Context, payload json.RawMessage) error {
+	var scan models.ScanLog
+	if err := json.Unmarshal(payload, &scan); err != nil {
+		return err
+	}
+	return h.logScan(ctx, &scan)
+}
+
+// GetOutbox reports how many scans are waiting in the outbox and why, and
+// which ones it gave up on.
+func (h *Handler) GetOutbox(c echo.Context) error {
+	if h.Outbox == nil {
+		return c.JSON(http.StatusOK, echo.Map{"enabled": false, "depth": 0, "entries": []echo.Map{}, "dead_letter_count": 0, "dead_letters": []echo.Map{}})
+	}
+
+	entries, dead := h.Outbox.Entries(), h.Outbox.DeadLetters()
+	status := echo.Map{
+		"enabled":           true,
+		"depth":             len(entries),
+		"entries":           outboxEntries(entries, true),
+		"dead_letter_count": len(dead),
+		"dead_letters":      outboxEntries(dead, false),
+	}
+	if len(entries) > 0 {
+		status["oldest_queued_at"] = entries[0].QueuedAt
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+func outboxEntries(entries []outbox.Entry, queued bool) []echo.Map {
+	out := make([]echo.Map, 0, len(entries))
+	for _, e := range entries {
+		entry := echo.Map{
+			"id":          e.ID,
+			"tracking_id": e.Key,
+			"attempts":    e.Attempts,
+			"last_error":  e.LastError,
+			"queued_at":   e.QueuedAt,
+		}
+		if queued {
+			entry["next_attempt"] = e.NextAttempt
+		}
+		out = append(out, entry)
+	}
+	return out
+}
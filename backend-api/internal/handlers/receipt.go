@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/galanafai/aroni-backend/internal/receipt"
+	"github.com/labstack/echo/v4"
+)
+
+// GetReceiptKey returns the public key that scan receipts are signed with.
+func (h *Handler) GetReceiptKey(c echo.Context) error {
+	if h.Receipts == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "receipt signing is not configured"})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"algorithm":  receipt.Algorithm,
+		"key_id":     h.Receipts.KeyID(),
+		"public_key": base64.StdEncoding.EncodeToString(h.Receipts.PublicKey()),
+		"version":    receipt.Version,
+	})
+}
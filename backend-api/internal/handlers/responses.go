@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/models"
+	"github.com/galanafai/aroni-backend/internal/receipt"
+	"github.com/galanafai/aroni-backend/internal/scanhash"
+	"github.com/galanafai/aroni-backend/internal/schema"
+	"github.com/galanafai/aroni-backend/internal/webhook"
+	"github.com/labstack/echo/v4"
+)
+
+// ScanResponse is the body returned by POST /api/scan.
+type ScanResponse struct {
+	TrackingID string                  `json:"tracking_id"`
+	Result     models.ScanResult       `json:"result"`
+	Reasons    []models.MismatchReason `json:"reasons"`
+	// Receipt is omitted when receipts are disabled or the scan was queued.
+	Receipt *receipt.Signed `json:"receipt,omitempty"`
+	// Queued is set when the scan went to the outbox instead of the store.
+	Queued        bool           `json:"queued,omitempty"`
+	OutboxReceipt *OutboxReceipt `json:"outbox_receipt,omitempty"`
+}
+
+// OutboxReceipt identifies a scan waiting in the outbox.
+type OutboxReceipt struct {
+	ID       string    `json:"id"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// ScanPage is the body returned by GET /api/scans.
+type ScanPage struct {
+	Data  []models.ScanLog `json:"data"`
+	Total int              `json:"total"`
+	Limit int              `json:"limit"`
+	// NextCursor is omitted on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ScanHistory is the body returned by GET /api/history/:tracking_id.
+type ScanHistory struct {
+	TrackingID string               `json:"tracking_id"`
+	History    []models.ScanLog     `json:"history"`
+	Chain      scanhash.ChainReport `json:"chain"`
+}
+
+// Schemas are the response types whose JSON Schemas GetSchema serves, by
+// name.
+var Schemas = map[string]any{
+	"scan-log":      models.ScanLog{},
+	"scan":          ScanResponse{},
+	"scan-page":     ScanPage{},
+	"scan-history":  ScanHistory{},
+	"webhook-event": webhook.Event{},
+}
+
+// SchemaNames returns the keys of Schemas, sorted.
+func SchemaNames() []string {
+	names := make([]string, 0, len(Schemas))
+	for name := range Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ListSchemas returns the names of the available response schemas.
+func (h *Handler) ListSchemas(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"schemas": SchemaNames()})
+}
+
+// GetSchema returns the JSON Schema of one response type.
+func (h *Handler) GetSchema(c echo.Context) error {
+	v, ok := Schemas[c.Param("name")]
+	if !ok {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "unknown schema", "schemas": SchemaNames()})
+	}
+	return c.JSON(http.StatusOK, schema.Generate(c.Param("name"), v))
+}
@@ -1,22 +1,30 @@
 package handlers
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/device"
+	"github.com/galanafai/aroni-backend/internal/matching"
 	"github.com/galanafai/aroni-backend/internal/models"
+	"github.com/galanafai/aroni-backend/internal/outbox"
+	"github.com/galanafai/aroni-backend/internal/receipt"
+	"github.com/galanafai/aroni-backend/internal/scanhash"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 )
 
 var scanValidator = validator.New()
 
-func HandleScan(c echo.Context) error {
+// maxChainRetries bounds how often a scan is re-linked when another scan of
+// the same package is logged between reading the chain head and inserting.
+const maxChainRetries = 3
+
+func (h *Handler) HandleScan(c echo.Context) error {
 	var payload models.ScanPayload
 	scanTime := time.Now().UTC()
 
@@ -28,79 +36,137 @@ func HandleScan(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "validation failed", "details": err.Error()})
 	}
 
+	// 📟 Check the device signature
+	var deviceID string
+	switch {
+	case payload.DeviceID != "" || payload.Signature != "":
+		dev, err := h.Store.FetchDevice(c.Request().Context(), payload.DeviceID)
+		if err != nil {
+			c.Logger().Errorf("❌ Failed to fetch device: %v", err)
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch device"})
+		}
+		if dev == nil {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unknown device"})
+		}
+		if err := device.Verify(dev, payload, scanTime); err != nil {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid device signature", "details": err.Error()})
+		}
+		err = h.Store.UseDeviceSignature(c.Request().Context(), dev.ID, payload.Signature)
+		if errors.Is(err, db.ErrSignatureReused) {
+			return c.JSON(http.StatusConflict, echo.Map{"error": "device signature already used"})
+		}
+		if err != nil {
+			c.Logger().Errorf("❌ Failed to record device signature: %v", err)
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to record device signature"})
+		}
+		deviceID = dev.ID
+	case h.RequireDeviceSignatures:
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "scan must be signed by a registered device"})
+	}
+
 	// ✅ Fetch stored metadata
-	stored, err := db.FetchMetadataByTrackingID(payload.TrackingID.String())
+	stored, err := h.Store.FetchMetadataByTrackingID(c.Request().Context(), payload.TrackingID.String())
 	if err != nil {
 		c.Logger().Errorf("❌ Failed to fetch metadata: %v", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch metadata"})
 	}
-	if stored == nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "tracking ID not found"})
-	}
-
-	// ✅ Compare fields
-	result := "match"
-	reasons := []string{}
 
-	if stored.Quantity != payload.ScannedQuantity {
-		result = "mismatch"
-		reasons = append(reasons, "quantity mismatch")
-	}
-	if stored.WeightKg != payload.ScannedWeightKg {
-		result = "mismatch"
-		reasons = append(reasons, "weight mismatch")
-	}
-	if len(stored.DimensionsCm) == 3 && len(payload.ScannedDimensions) == 3 {
-		for i := range stored.DimensionsCm {
-			if stored.DimensionsCm[i] != payload.ScannedDimensions[i] {
-				result = "mismatch"
-				reasons = append(reasons, "dimensions mismatch")
-				break
-			}
-		}
-	} else {
-		result = "mismatch"
-		reasons = append(reasons, "dimensions format mismatch")
+	// ✅ Compare fields against the configured tolerances. A package without
+	// metadata is still logged, as unknown_package.
+	outcome := matching.UnknownPackage()
+	if stored != nil {
+		outcome = matching.Compare(h.Rules, stored, payload)
 	}
+	result := outcome.Result
+	reasons := outcome.Reasons
 
 	// ✅ Log the scan result
-	scanLog := map[string]interface{}{
-		"tracking_id":        payload.TrackingID,
-		"location":           payload.Location,
-		"scanned_quantity":   payload.ScannedQuantity,
-		"scanned_weight_kg":  payload.ScannedWeightKg,
-		"scanned_dimensions": payload.ScannedDimensions,
-		"result":             result,
-		"notes":              reasonsToString(reasons),
-		"scan_time":          scanTime.Format(time.RFC3339),
+	scanLog := &models.ScanLog{
+		TrackingID:           payload.TrackingID.String(),
+		Location:             payload.Location,
+		ScannedQuantity:      payload.ScannedQuantity,
+		ScannedWeightKg:      payload.ScannedWeightKg,
+		ScannedDimensions:    payload.ScannedDimensions,
+		DimensionPermutation: outcome.DimensionPermutation,
+		Result:               result,
+		Reasons:              reasons,
+		Notes:                outcome.Notes(),
+		ScanTime:             scanTime.Format(time.RFC3339),
+		DeviceID:             deviceID,
 	}
 
-	// 🔐 Compute scan hash
-	scanLog["scan_hash"] = computeScanHash(scanLog)
-
-	// ✅ Now log the scan
-	err = db.PostScanLog(scanLog)
-
-	if err != nil {
+	// 🔗 Link to the previous scan of this package, hash and log it. Scans
+	// the store cannot take now go to the outbox, as do later scans of the
+	// same package so that its chain keeps its order.
+	var queued *outbox.Entry
+	trackingID := payload.TrackingID.String()
+	if h.Outbox != nil && h.Outbox.Has(trackingID) {
+		queued, err = h.Outbox.Enqueue(trackingID, scanLog)
+	} else if err = h.logScan(c.Request().Context(), scanLog); err != nil {
 		c.Logger().Errorf("❌ Failed to log scan: %v", err)
+		if h.Outbox == nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to log scan"})
+		}
+		scanLog.PrevScanHash, scanLog.ScanHash = "", ""
+		queued, err = h.Outbox.Enqueue(trackingID, scanLog)
+	}
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to queue scan: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to log scan"})
 	}
+	logged := queued == nil
 
-	return c.JSON(http.StatusOK, echo.Map{
-		"tracking_id": payload.TrackingID,
-		"result":      result,
-		"reasons":     reasons,
-	})
-}
+	response := ScanResponse{
+		TrackingID: scanLog.TrackingID,
+		Result:     result,
+		Reasons:    reasons,
+	}
 
-func reasonsToString(reasons []string) string {
-	if len(reasons) == 0 {
-		return ""
+	// 🧾 Sign a receipt for the logged scan
+	if logged && h.Receipts != nil {
+		signed, err := h.Receipts.Sign(receipt.Receipt{
+			TrackingID:  payload.TrackingID.String(),
+			ScanHash:    scanLog.ScanHash,
+			HashVersion: scanLog.HashVersion,
+			ScanTime:    scanLog.ScanTime,
+			Result:      string(result),
+		})
+		if err != nil {
+			c.Logger().Errorf("❌ Failed to sign receipt: %v", err)
+		} else {
+			response.Receipt = signed
+		}
 	}
-	return strings.Join(reasons, ", ")
+
+	if queued != nil {
+		response.Queued = true
+		response.OutboxReceipt = &OutboxReceipt{ID: queued.ID, QueuedAt: queued.QueuedAt}
+		return c.JSON(http.StatusAccepted, response)
+	}
+	return c.JSON(http.StatusOK, response)
 }
 
-func computeScanHash(payload map[string]interface{}) string {
-	jsonBytes, _ := json.Marshal(payload)
-	hash := sha256.Sum256(jsonBytes)
-	return hex.EncodeToString(hash[:])
+// logScan links a scan to the head of its package's chain, hashes it and
+// stores it, relinking if another scan of the package is stored meanwhile.
+// It sets PrevScanHash, ScanHash, HashVersion and ID on scan.
+func (h *Handler) logScan(ctx context.Context, scan *models.ScanLog) error {
+	for attempt := 1; ; attempt++ {
+		prev, err := h.Store.FetchLastScanHash(ctx, scan.TrackingID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch previous scan: %w", err)
+		}
+		scan.PrevScanHash = prev
+
+		scanHash, err := scanhash.Compute(scan)
+		if err != nil {
+			return fmt.Errorf("failed to hash scan: %w", err)
+		}
+		scan.ScanHash = scanHash
+
+		err = h.Store.PostScanLog(ctx, scan)
+		if errors.Is(err, db.ErrChainConflict) && attempt < maxChainRetries {
+			continue
+		}
+		return err
+	}
 }
@@ -1,19 +1,121 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/models"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
-func GetAllScanLogs(c echo.Context) error {
-	scans, err := db.FetchAllScans()
+// Page sizes for GetAllScanLogs.
+const (
+	defaultScanPageSize = 50
+	maxScanPageSize     = 500
+)
+
+// GetAllScanLogs returns one page of the scan log, newest first. It takes
+// the filters result, tracking_id, sku, location, device_id, field (named by
+// one of the scan's reasons) and since/until (RFC 3339), a limit, and the
+// cursor returned as next_cursor by the page before. total counts every
+// scan matching the filters.
+func (h *Handler) GetAllScanLogs(c echo.Context) error {
+	q, err := parseScanQuery(c)
 	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	scans, err := h.Store.QueryScans(c.Request().Context(), q)
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch scan logs: %v", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch scan logs"})
 	}
+	total, err := h.Store.CountScans(c.Request().Context(), q)
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to count scan logs: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to count scan logs"})
+	}
+
+	response := ScanPage{Data: scans, Total: total, Limit: q.Limit}
+	if len(scans) == q.Limit {
+		next, err := encodeScanCursor(scans[len(scans)-1])
+		if err != nil {
+			c.Logger().Errorf("❌ Failed to build scan cursor: %v", err)
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch scan logs"})
+		}
+		response.NextCursor = next
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func parseScanQuery(c echo.Context) (db.ScanQuery, error) {
+	q := db.ScanQuery{
+		Result:     c.QueryParam("result"),
+		TrackingID: c.QueryParam("tracking_id"),
+		SKU:        c.QueryParam("sku"),
+		Location:   c.QueryParam("location"),
+		DeviceID:   c.QueryParam("device_id"),
+		Field:      c.QueryParam("field"),
+		Limit:      defaultScanPageSize,
+	}
+	var err error
+
+	if v := c.QueryParam("since"); v != "" {
+		if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if v := c.QueryParam("until"); v != "" {
+		if q.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > maxScanPageSize {
+			return q, fmt.Errorf("invalid limit %q (want 1 to %d)", v, maxScanPageSize)
+		}
+	}
+	if v := c.QueryParam("cursor"); v != "" {
+		if q.After, err = decodeScanCursor(v); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// encodeScanCursor returns an opaque cursor pointing at a scan.
+func encodeScanCursor(scan models.ScanLog) (string, error) {
+	t, err := time.Parse(time.RFC3339, scan.ScanTime)
+	if err != nil || scan.ID == "" {
+		return "", fmt.Errorf("scan row has no usable scan_time and id")
+	}
+	raw, err := json.Marshal(db.ScanCursor{ScanTime: t, ID: scan.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
 
-	return c.JSON(http.StatusOK, echo.Map{
-		"data": scans,
-	})
+func decodeScanCursor(cursor string) (*db.ScanCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var after db.ScanCursor
+	if err := json.Unmarshal(raw, &after); err != nil || after.ScanTime.IsZero() {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	// The ID goes into store filters as is, so only a UUID is accepted.
+	id, err := uuid.Parse(after.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	after.ID = id.String()
+	return &after, nil
 }
@@ -8,24 +8,31 @@ import (
 )
 
 type VerifyScanPayload struct {
-	ScanHash string   `json:"scan_hash"`
-	Proof    []string `json:"proof"`
-	RootHash string   `json:"root_hash"`
+	ScanHash   string             `json:"scan_hash"`
+	Proof      []crypto.ProofStep `json:"proof"`
+	RootHash   string             `json:"root_hash"`
+	HashScheme string             `json:"hash_scheme"` // defaults to crypto.CurrentScheme
 }
 
 // VerifyScan handles Merkle proof verification
-func VerifyScan(c echo.Context) error {
+func (h *Handler) VerifyScan(c echo.Context) error {
 	var payload VerifyScanPayload
 	if err := c.Bind(&payload); err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
 	}
 
-	valid, err := crypto.VerifyProof(payload.ScanHash, payload.Proof, payload.RootHash)
+	scheme := payload.HashScheme
+	if scheme == "" {
+		scheme = crypto.CurrentScheme
+	}
+
+	valid, err := crypto.VerifyProofWithScheme(scheme, payload.ScanHash, payload.Proof, payload.RootHash)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
-		"valid": valid,
+		"valid":       valid,
+		"hash_scheme": scheme,
 	})
 }
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/models"
+	"github.com/galanafai/aroni-backend/internal/webhook"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultDeliveryPageSize = 50
+	maxDeliveryPageSize     = 500
+)
+
+// webhooksAllowed reports whether webhook requests can go ahead, writing
+// the error response when they cannot: webhooks must be enabled with a
+// WebhookAdminToken, and the request must carry it as a bearer token.
+func (h *Handler) webhooksAllowed(c echo.Context) (bool, error) {
+	if h.Webhooks == nil || h.WebhookAdminToken == "" {
+		return false, c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "webhooks are not available"})
+	}
+	token := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.WebhookAdminToken)) != 1 {
+		return false, c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid webhook admin token"})
+	}
+	return true, nil
+}
+
+// CreateWebhook subscribes a URL to one or more event types. The response is
+// the only place the subscription's signing secret is returned.
+func (h *Handler) CreateWebhook(c echo.Context) error {
+	if ok, err := h.webhooksAllowed(c); !ok {
+		return err
+	}
+
+	var payload models.WebhookPayload
+	if err := c.Bind(&payload); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid JSON"})
+	}
+	if err := validate.Struct(payload); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "validation failed", "details": err.Error()})
+	}
+	for _, event := range payload.Events {
+		if !webhook.Known(event) {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("unknown event %q", event), "events": webhook.EventType("").Enum()})
+		}
+	}
+
+	if !h.WebhookAllowPrivateURLs {
+		if err := webhook.CheckURL(c.Request().Context(), payload.URL); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid webhook URL", "details": err.Error()})
+		}
+	}
+
+	hook := &db.Webhook{URL: payload.URL, Events: payload.Events, Secret: payload.Secret}
+	if hook.Secret == "" {
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			c.Logger().Errorf("❌ Failed to generate webhook secret: %v", err)
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to create webhook"})
+		}
+		hook.Secret = secret
+	}
+	if err := h.Store.CreateWebhook(c.Request().Context(), hook); err != nil {
+		c.Logger().Errorf("❌ Failed to create webhook: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to create webhook"})
+	}
+
+	c.Logger().Infof("🪝 Webhook %s subscribed %s to %s", hook.ID, hook.URL, strings.Join(hook.Events, ", "))
+	return c.JSON(http.StatusCreated, hook)
+}
+
+// ListWebhooks returns every subscription, without secrets.
+func (h *Handler) ListWebhooks(c echo.Context) error {
+	if ok, err := h.webhooksAllowed(c); !ok {
+		return err
+	}
+
+	hooks, err := h.Store.FetchWebhooks(c.Request().Context())
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch webhooks: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch webhooks"})
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return c.JSON(http.StatusOK, echo.Map{"data": hooks})
+}
+
+// DeleteWebhook removes a subscription together with its delivery log.
+func (h *Handler) DeleteWebhook(c echo.Context) error {
+	if ok, err := h.webhooksAllowed(c); !ok {
+		return err
+	}
+
+	found, err := h.Store.DeleteWebhook(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to delete webhook: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to delete webhook"})
+	}
+	if !found {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "webhook not found"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries returns the delivery log, newest first. It takes
+// webhook_id, event and status filters and a limit.
+func (h *Handler) ListWebhookDeliveries(c echo.Context) error {
+	if ok, err := h.webhooksAllowed(c); !ok {
+		return err
+	}
+
+	q := db.DeliveryQuery{
+		WebhookID: c.QueryParam("webhook_id"),
+		Event:     c.QueryParam("event"),
+		Status:    c.QueryParam("status"),
+		Limit:     defaultDeliveryPageSize,
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		var err error
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > maxDeliveryPageSize {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("invalid limit %q (want 1 to %d)", v, maxDeliveryPageSize)})
+		}
+	}
+
+	deliveries, err := h.Store.FetchWebhookDeliveries(c.Request().Context(), q)
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch webhook deliveries: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch webhook deliveries"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"data": deliveries, "limit": q.Limit})
+}
+
+// GetWebhookDelivery returns one delivery with its payload, attempts and
+// the outcome of its last attempt.
+func (h *Handler) GetWebhookDelivery(c echo.Context) error {
+	if ok, err := h.webhooksAllowed(c); !ok {
+		return err
+	}
+
+	delivery, err := h.Store.FetchWebhookDelivery(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to fetch webhook delivery: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch webhook delivery"})
+	}
+	if delivery == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "webhook delivery not found"})
+	}
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// ReplayWebhookDelivery sends a delivery's payload again as a new delivery,
+// whatever became of the original.
+func (h *Handler) ReplayWebhookDelivery(c echo.Context) error {
+	if ok, err := h.webhooksAllowed(c); !ok {
+		return err
+	}
+
+	delivery, err := h.Webhooks.Replay(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		c.Logger().Errorf("❌ Failed to replay webhook delivery: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to replay webhook delivery"})
+	}
+	if delivery == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "webhook delivery not found"})
+	}
+	return c.JSON(http.StatusAccepted, delivery)
+}
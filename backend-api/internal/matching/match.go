@@ -0,0 +1,253 @@
+package matching
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/models"
+)
+
+// Mismatch describes a single field whose observed value fell outside its
+// tolerance, or came close enough to it for a warning.
+type Mismatch struct {
+	Field     string
+	Axis      *int // of a dimensionsField mismatch about one axis
+	Expected  float64
+	Observed  float64
+	Delta     float64
+	Allowed   float64
+	Tolerance Tolerance
+	Severity  models.Severity
+}
+
+// dimensionsField is the field of per-axis dimension mismatches, which set
+// Axis, and of the critical mismatch recorded when either side lacks three
+// axes, so no axis can be compared.
+const dimensionsField = "dimensions_cm"
+
+func (m Mismatch) String() string {
+	name := m.Field
+	if m.Axis != nil {
+		name = fmt.Sprintf("%s[%d]", m.Field, *m.Axis)
+	} else if m.Field == dimensionsField {
+		return fmt.Sprintf("%s mismatch: cannot compare %s stored axes with %s scanned axes (3 needed)",
+			m.Field, formatNum(m.Expected), formatNum(m.Observed))
+	}
+	if m.Severity == models.SeverityWarning {
+		return fmt.Sprintf("%s warning: expected %s, observed %s, delta %s is close to tolerance %s (allowed %s)",
+			name, formatNum(m.Expected), formatNum(m.Observed), formatDelta(m.Delta), m.Tolerance, formatNum(m.Allowed))
+	}
+	return fmt.Sprintf("%s mismatch: expected %s, observed %s, delta %s exceeds tolerance %s (allowed %s)",
+		name, formatNum(m.Expected), formatNum(m.Observed), formatDelta(m.Delta), m.Tolerance, formatNum(m.Allowed))
+}
+
+// criticalFactor is how many times its allowed deviation a field must be off
+// for the mismatch to be critical when its grade sets no Critical threshold.
+const criticalFactor = 2
+
+// Reason returns the mismatch as stored with the scan.
+func (m Mismatch) Reason() models.MismatchReason {
+	return models.MismatchReason{
+		Field:     m.Field,
+		Axis:      m.Axis,
+		Expected:  m.Expected,
+		Observed:  m.Observed,
+		Delta:     round(m.Delta),
+		Tolerance: m.Tolerance.String(),
+		Allowed:   round(m.Allowed),
+		Severity:  m.Severity,
+	}
+}
+
+// Outcome is the result of comparing a scan against the stored metadata.
+type Outcome struct {
+	Result models.ScanResult
+	// Mismatches lists every flagged field, warnings included.
+	Mismatches []Mismatch
+	Reasons    []models.MismatchReason
+
+	// DimensionPermutation maps each stored axis to the index of the scanned
+	// axis it was compared with. Nil when the dimensions could not be compared.
+	DimensionPermutation []int
+}
+
+// UnknownPackage is the outcome of scanning a tracking ID without metadata.
+func UnknownPackage() Outcome {
+	return Outcome{Result: models.ResultUnknownPackage, Reasons: []models.MismatchReason{}}
+}
+
+// Compare checks a scan against the stored metadata using the tolerances
+// that apply to the package's SKU and package type, and grades the outcome
+// by the grades for its urgency level.
+func Compare(rules *Rules, stored *db.MetadataRecord, payload models.ScanPayload) Outcome {
+	tol := rules.Resolve(stored.SKU, stored.PackageType)
+	grades := rules.ResolveGrades(stored.UrgencyLevel)
+	out := Outcome{Result: models.ResultMatch, Reasons: []models.MismatchReason{}}
+
+	out.check("quantity", nil, float64(stored.Quantity), float64(payload.ScannedQuantity), *tol.Quantity, *grades.Quantity)
+	out.check("weight_kg", nil, stored.WeightKg, payload.ScannedWeightKg, *tol.WeightKg, *grades.WeightKg)
+
+	if len(stored.DimensionsCm) == 3 && len(payload.ScannedDimensions) == 3 {
+		perm := []int{0, 1, 2}
+		if tol.DimensionMode == DimensionsAnyOrientation {
+			perm = sortedPermutation(stored.DimensionsCm, payload.ScannedDimensions)
+		}
+		out.DimensionPermutation = perm
+
+		for i := range stored.DimensionsCm {
+			axis := i
+			out.check(dimensionsField, &axis, stored.DimensionsCm[i], payload.ScannedDimensions[perm[i]], *tol.DimensionsCm, *grades.DimensionsCm)
+		}
+		if tol.VolumeCm3 != nil {
+			out.check("volume_cm3", nil, volume(stored.DimensionsCm), volume(payload.ScannedDimensions), *tol.VolumeCm3, *grades.VolumeCm3)
+		}
+	} else {
+		// Without three axes on both sides nothing can be compared, so the
+		// dimensions are a critical mismatch whatever the axis counts.
+		expected, observed := float64(len(stored.DimensionsCm)), float64(len(payload.ScannedDimensions))
+		out.add(Mismatch{
+			Field:    dimensionsField,
+			Expected: expected,
+			Observed: observed,
+			Delta:    observed - expected,
+			Severity: models.SeverityCritical,
+		})
+	}
+
+	return out
+}
+
+// Notes describes the mismatches in words, joined by "; ".
+func (o Outcome) Notes() string {
+	notes := make([]string, len(o.Mismatches))
+	for i, m := range o.Mismatches {
+		notes[i] = m.String()
+	}
+	return strings.Join(notes, "; ")
+}
+
+// resultBySeverity is the outcome of a scan whose most severe reason has the
+// given severity.
+var resultBySeverity = map[models.Severity]models.ScanResult{
+	models.SeverityWarning:  models.ResultWarning,
+	models.SeverityMinor:    models.ResultMinorMismatch,
+	models.SeverityCritical: models.ResultCriticalMismatch,
+}
+
+func (o *Outcome) check(field string, axis *int, expected, observed float64, tol Tolerance, grade Grade) {
+	delta := observed - expected
+	allowed := tol.Allowed(expected)
+
+	var severity models.Severity
+	switch {
+	case math.Abs(delta) <= allowed+epsilon:
+		if grade.Warn == nil || math.Abs(delta) <= grade.Warn.Allowed(expected)+epsilon {
+			return
+		}
+		severity = models.SeverityWarning
+	default:
+		critical := criticalFactor * allowed
+		if grade.Critical != nil {
+			critical = grade.Critical.Allowed(expected)
+		}
+		severity = models.SeverityMinor
+		if math.Abs(delta) > critical+epsilon {
+			severity = models.SeverityCritical
+		}
+	}
+
+	o.add(Mismatch{
+		Field:     field,
+		Axis:      axis,
+		Expected:  expected,
+		Observed:  observed,
+		Delta:     delta,
+		Allowed:   allowed,
+		Tolerance: tol,
+		Severity:  severity,
+	})
+}
+
+// add records m, raising the result to its severity.
+func (o *Outcome) add(m Mismatch) {
+	if rank(m.Severity) > rank(o.worst()) {
+		o.Result = resultBySeverity[m.Severity]
+	}
+	o.Mismatches = append(o.Mismatches, m)
+	o.Reasons = append(o.Reasons, m.Reason())
+}
+
+// worst returns the most severe severity among the mismatches so far, or ""
+// for none.
+func (o *Outcome) worst() models.Severity {
+	var worst models.Severity
+	for _, m := range o.Mismatches {
+		if rank(m.Severity) > rank(worst) {
+			worst = m.Severity
+		}
+	}
+	return worst
+}
+
+// rank orders severities as models.Severities does; "" ranks lowest.
+func rank(s models.Severity) int {
+	for i, v := range models.Severities {
+		if v == s {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// sortedPermutation pairs the axes of expected and observed by rank, so the
+// smallest stored axis is compared with the smallest scanned axis and so on.
+func sortedPermutation(expected, observed []float64) []int {
+	e := rankOrder(expected)
+	o := rankOrder(observed)
+	perm := make([]int, len(expected))
+	for k := range e {
+		perm[e[k]] = o[k]
+	}
+	return perm
+}
+
+// rankOrder returns the indices of v ordered by ascending value.
+func rankOrder(v []float64) []int {
+	idx := make([]int, len(v))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return v[idx[a]] < v[idx[b]] })
+	return idx
+}
+
+func volume(dims []float64) float64 {
+	v := 1.0
+	for _, d := range dims {
+		v *= d
+	}
+	return v
+}
+
+// epsilon absorbs float rounding so a delta of exactly the tolerance is accepted.
+const epsilon = 1e-9
+
+// round drops float noise below a millionth, e.g. from 12.4 - 12.5.
+func round(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+func formatNum(v float64) string {
+	return strconv.FormatFloat(round(v), 'f', -1, 64)
+}
+
+func formatDelta(v float64) string {
+	if v > 0 {
+		return "+" + formatNum(v)
+	}
+	return formatNum(v)
+}
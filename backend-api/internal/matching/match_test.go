@@ -0,0 +1,415 @@
+package matching
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/models"
+)
+
+func tol(abs, pct float64) *Tolerance { return &Tolerance{Abs: abs, Pct: pct} }
+
+// box is the stored metadata most tests compare against.
+func box() *db.MetadataRecord {
+	return &db.MetadataRecord{
+		SKU:          "ARONI-1001",
+		Quantity:     48,
+		WeightKg:     12.5,
+		DimensionsCm: []float64{40, 30, 20},
+		PackageType:  "case",
+		UrgencyLevel: "normal",
+	}
+}
+
+func scanOf(quantity int, weight float64, dims ...float64) models.ScanPayload {
+	return models.ScanPayload{ScannedQuantity: quantity, ScannedWeightKg: weight, ScannedDimensions: dims}
+}
+
+func TestToleranceAllowed(t *testing.T) {
+	tests := []struct {
+		tol      Tolerance
+		expected float64
+		want     float64
+		text     string
+	}{
+		{Tolerance{}, 10, 0, "±0"},
+		{Tolerance{Abs: 1}, 10, 1, "±1"},
+		{Tolerance{Pct: 2}, 12.5, 0.25, "±2%"},
+		{Tolerance{Pct: 2}, -12.5, 0.25, "±2%"},
+		{Tolerance{Abs: 0.05, Pct: 2}, 1, 0.05, "±0.05 or ±2%"},
+		{Tolerance{Abs: 0.05, Pct: 2}, 10, 0.2, "±0.05 or ±2%"},
+	}
+	for _, tt := range tests {
+		if got := tt.tol.Allowed(tt.expected); got != tt.want {
+			t.Errorf("%+v.Allowed(%g) = %g, want %g", tt.tol, tt.expected, got, tt.want)
+		}
+		if got := tt.tol.String(); got != tt.text {
+			t.Errorf("%+v.String() = %q, want %q", tt.tol, got, tt.text)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	rules := &Rules{
+		Default: FieldTolerances{
+			Quantity:      tol(0, 0),
+			WeightKg:      tol(0.05, 2),
+			DimensionsCm:  tol(1, 0),
+			DimensionMode: DimensionsOrdered,
+		},
+		PackageTypes: map[string]FieldTolerances{
+			"case": {WeightKg: tol(0.2, 0), DimensionMode: DimensionsAnyOrientation},
+		},
+		SKUs: map[string]FieldTolerances{
+			"ARONI-1001": {DimensionsCm: tol(3, 0), VolumeCm3: tol(0, 5)},
+			"ARONI-2002": {Quantity: tol(1, 0)},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		sku, pkg   string
+		quantity   Tolerance
+		weight     Tolerance
+		dimensions Tolerance
+		mode       string
+		volume     *Tolerance
+	}{
+		{"default", "OTHER", "pallet", Tolerance{}, *tol(0.05, 2), *tol(1, 0), DimensionsOrdered, nil},
+		{"package type", "OTHER", "case", Tolerance{}, *tol(0.2, 0), *tol(1, 0), DimensionsAnyOrientation, nil},
+		{"SKU over package type", "ARONI-1001", "case", Tolerance{}, *tol(0.2, 0), *tol(3, 0), DimensionsAnyOrientation, tol(0, 5)},
+		{"SKU alone", "ARONI-1001", "pallet", Tolerance{}, *tol(0.05, 2), *tol(3, 0), DimensionsOrdered, tol(0, 5)},
+		{"SKU keeps other fields", "ARONI-2002", "case", *tol(1, 0), *tol(0.2, 0), *tol(1, 0), DimensionsAnyOrientation, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rules.Resolve(tt.sku, tt.pkg)
+			if *got.Quantity != tt.quantity || *got.WeightKg != tt.weight || *got.DimensionsCm != tt.dimensions || got.DimensionMode != tt.mode {
+				t.Errorf("resolved quantity %v, weight %v, dimensions %v, mode %q", *got.Quantity, *got.WeightKg, *got.DimensionsCm, got.DimensionMode)
+			}
+			if (got.VolumeCm3 == nil) != (tt.volume == nil) || (tt.volume != nil && *got.VolumeCm3 != *tt.volume) {
+				t.Errorf("resolved volume %v, want %v", got.VolumeCm3, tt.volume)
+			}
+		})
+	}
+
+	empty := (&Rules{}).Resolve("ARONI-1001", "case")
+	if *empty.Quantity != (Tolerance{}) || *empty.WeightKg != (Tolerance{}) || *empty.DimensionsCm != (Tolerance{}) || empty.DimensionMode != DimensionsOrdered {
+		t.Errorf("empty rules resolved to %+v", empty)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	load := func(t *testing.T, content string) (*Rules, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "rules.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return LoadRules(path)
+	}
+
+	rules, err := load(t, `{"default": {"weight_kg": {"pct": 5}}, "skus": {"ARONI-1001": {"dimension_mode": "any_orientation"}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := DefaultRules()
+	if *rules.Default.WeightKg != *tol(0, 5) {
+		t.Errorf("weight_kg is %v, want the file's", *rules.Default.WeightKg)
+	}
+	if *rules.Default.Quantity != *defaults.Default.Quantity || *rules.Default.DimensionsCm != *defaults.Default.DimensionsCm || rules.Default.DimensionMode != DimensionsOrdered {
+		t.Errorf("missing default fields were not filled in: %+v", rules.Default)
+	}
+	if rules.UrgencyLevels["critical"].Quantity == nil {
+		t.Error("a file without grades lost the default grading")
+	}
+
+	for _, bad := range []string{
+		`{"package_types": {"case": {"dimension_mode": "sideways"}}}`,
+		`{"urgency_levels": {"whenever": {}}}`,
+		`{"default": `,
+	} {
+		if _, err := load(t, bad); err == nil {
+			t.Errorf("%s was accepted", bad)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// No grades: a mismatch is minor up to twice its tolerance.
+	rules := &Rules{Default: FieldTolerances{
+		Quantity:     tol(1, 0),
+		WeightKg:     tol(0, 2),
+		DimensionsCm: tol(1, 0),
+	}}
+
+	tests := []struct {
+		name    string
+		scan    models.ScanPayload
+		result  models.ScanResult
+		reasons []models.MismatchReason
+		notes   string
+	}{
+		{
+			name:    "exact",
+			scan:    scanOf(48, 12.5, 40, 30, 20),
+			result:  models.ResultMatch,
+			reasons: []models.MismatchReason{},
+		},
+		{
+			name:    "at every tolerance",
+			scan:    scanOf(47, 12.75, 41, 29, 21),
+			result:  models.ResultMatch,
+			reasons: []models.MismatchReason{},
+		},
+		{
+			name:   "weight just over",
+			scan:   scanOf(48, 12.8, 40, 30, 20),
+			result: models.ResultMinorMismatch,
+			reasons: []models.MismatchReason{
+				{Field: "weight_kg", Expected: 12.5, Observed: 12.8, Delta: 0.3, Tolerance: "±2%", Allowed: 0.25, Severity: models.SeverityMinor},
+			},
+			notes: "weight_kg mismatch: expected 12.5, observed 12.8, delta +0.3 exceeds tolerance ±2% (allowed 0.25)",
+		},
+		{
+			name:   "quantity and an axis",
+			scan:   scanOf(45, 12.5, 40, 30, 21.5),
+			result: models.ResultCriticalMismatch,
+			reasons: []models.MismatchReason{
+				{Field: "quantity", Expected: 48, Observed: 45, Delta: -3, Tolerance: "±1", Allowed: 1, Severity: models.SeverityCritical},
+				{Field: "dimensions_cm", Axis: axis(2), Expected: 20, Observed: 21.5, Delta: 1.5, Tolerance: "±1", Allowed: 1, Severity: models.SeverityMinor},
+			},
+			notes: "quantity mismatch: expected 48, observed 45, delta -3 exceeds tolerance ±1 (allowed 1); " +
+				"dimensions_cm[2] mismatch: expected 20, observed 21.5, delta +1.5 exceeds tolerance ±1 (allowed 1)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := Compare(rules, box(), tt.scan)
+			if out.Result != tt.result {
+				t.Errorf("result is %s, want %s", out.Result, tt.result)
+			}
+			checkReasons(t, out.Reasons, tt.reasons)
+			if got := out.Notes(); got != tt.notes {
+				t.Errorf("notes are %q, want %q", got, tt.notes)
+			}
+		})
+	}
+}
+
+func axis(i int) *int { return &i }
+
+func checkReasons(t *testing.T, got, want []models.MismatchReason) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d reasons %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if (g.Axis == nil) != (w.Axis == nil) || (g.Axis != nil && *g.Axis != *w.Axis) {
+			t.Errorf("reason %d has axis %v, want %v", i, g.Axis, w.Axis)
+		}
+		g.Axis, w.Axis = nil, nil
+		if g != w {
+			t.Errorf("reason %d is %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestSortedPermutation(t *testing.T) {
+	tests := []struct {
+		name               string
+		expected, observed []float64
+		want               []int
+	}{
+		{"same order", []float64{40, 30, 20}, []float64{41, 29, 20}, []int{0, 1, 2}},
+		{"rotated", []float64{40, 30, 20}, []float64{20, 40, 30}, []int{1, 2, 0}},
+		{"reversed", []float64{20, 30, 40}, []float64{40, 30, 20}, []int{2, 1, 0}},
+		// Equal axes keep their order on both sides.
+		{"tie", []float64{30, 30, 20}, []float64{30, 20, 30}, []int{0, 2, 1}},
+		{"cube", []float64{10, 10, 10}, []float64{10, 10, 10}, []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sortedPermutation(tt.expected, tt.observed)
+			if !equalInts(got, tt.want) {
+				t.Errorf("sortedPermutation(%v, %v) = %v, want %v", tt.expected, tt.observed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareDimensions(t *testing.T) {
+	ordered := FieldTolerances{Quantity: tol(0, 0), WeightKg: tol(0, 0), DimensionsCm: tol(1, 0), VolumeCm3: tol(0, 5)}
+	anyOrientation := ordered
+	anyOrientation.DimensionMode = DimensionsAnyOrientation
+
+	tests := []struct {
+		name    string
+		tol     FieldTolerances
+		dims    []float64
+		result  models.ScanResult
+		perm    []int
+		reasons []models.MismatchReason
+	}{
+		{
+			name:    "ordered",
+			tol:     ordered,
+			dims:    []float64{40, 30, 20.5},
+			result:  models.ResultMatch,
+			perm:    []int{0, 1, 2},
+			reasons: []models.MismatchReason{},
+		},
+		{
+			name:   "rotated but ordered",
+			tol:    ordered,
+			dims:   []float64{20, 40, 30},
+			result: models.ResultCriticalMismatch,
+			perm:   []int{0, 1, 2},
+			reasons: []models.MismatchReason{
+				{Field: "dimensions_cm", Axis: axis(0), Expected: 40, Observed: 20, Delta: -20, Tolerance: "±1", Allowed: 1, Severity: models.SeverityCritical},
+				{Field: "dimensions_cm", Axis: axis(1), Expected: 30, Observed: 40, Delta: 10, Tolerance: "±1", Allowed: 1, Severity: models.SeverityCritical},
+				{Field: "dimensions_cm", Axis: axis(2), Expected: 20, Observed: 30, Delta: 10, Tolerance: "±1", Allowed: 1, Severity: models.SeverityCritical},
+			},
+		},
+		{
+			name:    "rotated in any orientation",
+			tol:     anyOrientation,
+			dims:    []float64{20, 40.5, 29.5},
+			result:  models.ResultMatch,
+			perm:    []int{1, 2, 0},
+			reasons: []models.MismatchReason{},
+		},
+		{
+			// Every axis is within 1cm but together they add 5.5% volume.
+			name:   "volume",
+			tol:    anyOrientation,
+			dims:   []float64{20.5, 40.5, 30.5},
+			result: models.ResultMinorMismatch,
+			perm:   []int{1, 2, 0},
+			reasons: []models.MismatchReason{
+				{Field: "volume_cm3", Expected: 24000, Observed: 25322.625, Delta: 1322.625, Tolerance: "±5%", Allowed: 1200, Severity: models.SeverityMinor},
+			},
+		},
+		{
+			name:   "too few axes",
+			tol:    ordered,
+			dims:   []float64{40, 30},
+			result: models.ResultCriticalMismatch,
+			reasons: []models.MismatchReason{
+				{Field: "dimensions_cm", Expected: 3, Observed: 2, Delta: -1, Tolerance: "±0", Severity: models.SeverityCritical},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := &Rules{Default: tt.tol}
+			out := Compare(rules, box(), scanOf(48, 12.5, tt.dims...))
+			if out.Result != tt.result {
+				t.Errorf("result is %s, want %s", out.Result, tt.result)
+			}
+			if !equalInts(out.DimensionPermutation, tt.perm) {
+				t.Errorf("permutation is %v, want %v", out.DimensionPermutation, tt.perm)
+			}
+			checkReasons(t, out.Reasons, tt.reasons)
+		})
+	}
+
+	// Without a volume tolerance the volume is not checked.
+	noVolume := ordered
+	noVolume.VolumeCm3 = nil
+	if out := Compare(&Rules{Default: noVolume}, box(), scanOf(48, 12.5, 40.5, 30.5, 20.5)); out.Result != models.ResultMatch {
+		t.Errorf("result is %s with notes %q, want a match", out.Result, out.Notes())
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) || (a == nil) != (b == nil) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGrading(t *testing.T) {
+	defaults := DefaultRules()
+	// custom sets an explicit critical threshold and a warning band on
+	// weight_kg, and leaves the other fields on the default critical factor.
+	custom := &Rules{
+		Default: FieldTolerances{Quantity: tol(0, 0), WeightKg: tol(0, 2), DimensionsCm: tol(1, 0)},
+		Grades:  FieldGrades{WeightKg: &Grade{Warn: tol(0, 1), Critical: tol(0, 10)}},
+	}
+
+	// box weighs 12.5kg, so the default weight tolerance allows 0.25 and
+	// the critical urgency level warns beyond 0.125.
+	tests := []struct {
+		name       string
+		rules      *Rules
+		urgency    string
+		scan       models.ScanPayload
+		result     models.ScanResult
+		severities []models.Severity
+	}{
+		{"quantity off by the critical threshold", defaults, "normal", scanOf(47, 12.5, 40, 30, 20), models.ResultMinorMismatch, []models.Severity{models.SeverityMinor}},
+		{"quantity past the critical threshold", defaults, "normal", scanOf(46, 12.5, 40, 30, 20), models.ResultCriticalMismatch, []models.Severity{models.SeverityCritical}},
+		{"weight at twice its tolerance", defaults, "normal", scanOf(48, 13, 40, 30, 20), models.ResultMinorMismatch, []models.Severity{models.SeverityMinor}},
+		{"weight past twice its tolerance", defaults, "normal", scanOf(48, 13.01, 40, 30, 20), models.ResultCriticalMismatch, []models.Severity{models.SeverityCritical}},
+		{"axis at twice its tolerance", defaults, "normal", scanOf(48, 12.5, 40, 30, 22), models.ResultMinorMismatch, []models.Severity{models.SeverityMinor}},
+		{"axis past twice its tolerance", defaults, "normal", scanOf(48, 12.5, 40, 30, 22.5), models.ResultCriticalMismatch, []models.Severity{models.SeverityCritical}},
+		{"no warnings outside the critical level", defaults, "normal", scanOf(48, 12.7, 40, 30, 20.8), models.ResultMatch, nil},
+		{"unknown level uses the base grades", defaults, "whenever", scanOf(47, 12.5, 40, 30, 20), models.ResultMinorMismatch, []models.Severity{models.SeverityMinor}},
+
+		{"critical: quantity off by one", defaults, "critical", scanOf(47, 12.5, 40, 30, 20), models.ResultCriticalMismatch, []models.Severity{models.SeverityCritical}},
+		{"critical: inside the warning band", defaults, "critical", scanOf(48, 12.6, 40, 30, 20.5), models.ResultMatch, nil},
+		{"critical: weight warning", defaults, "critical", scanOf(48, 12.7, 40, 30, 20), models.ResultWarning, []models.Severity{models.SeverityWarning}},
+		{"critical: axis warning", defaults, "critical", scanOf(48, 12.5, 40, 30, 20.8), models.ResultWarning, []models.Severity{models.SeverityWarning}},
+		{"critical: weight out of tolerance", defaults, "critical", scanOf(48, 12.76, 40, 30, 20), models.ResultCriticalMismatch, []models.Severity{models.SeverityCritical}},
+		{"critical: axis out of tolerance", defaults, "critical", scanOf(48, 12.5, 40, 30, 21.5), models.ResultCriticalMismatch, []models.Severity{models.SeverityCritical}},
+
+		{"explicit threshold: minor", custom, "normal", scanOf(48, 13.75, 40, 30, 20), models.ResultMinorMismatch, []models.Severity{models.SeverityMinor}},
+		{"explicit threshold: critical", custom, "normal", scanOf(48, 13.8, 40, 30, 20), models.ResultCriticalMismatch, []models.Severity{models.SeverityCritical}},
+		{"exact tolerance is always critical", custom, "normal", scanOf(47, 12.5, 40, 30, 20), models.ResultCriticalMismatch, []models.Severity{models.SeverityCritical}},
+		{"worst of warning and minor", custom, "normal", scanOf(48, 12.7, 40, 30, 21.5), models.ResultMinorMismatch, []models.Severity{models.SeverityWarning, models.SeverityMinor}},
+		{"worst of all three", custom, "normal", scanOf(47, 12.7, 40, 30, 21.5), models.ResultCriticalMismatch, []models.Severity{models.SeverityCritical, models.SeverityWarning, models.SeverityMinor}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := box()
+			stored.UrgencyLevel = tt.urgency
+			out := Compare(tt.rules, stored, tt.scan)
+			if out.Result != tt.result {
+				t.Errorf("result is %s, want %s (notes %q)", out.Result, tt.result, out.Notes())
+			}
+			if len(out.Reasons) != len(tt.severities) {
+				t.Fatalf("got reasons %+v, want severities %v", out.Reasons, tt.severities)
+			}
+			for i, s := range tt.severities {
+				if out.Reasons[i].Severity != s {
+					t.Errorf("reason %d (%s) is %s, want %s", i, out.Reasons[i].Field, out.Reasons[i].Severity, s)
+				}
+			}
+		})
+	}
+}
+
+func TestGradingDimensionCount(t *testing.T) {
+	// Missing axes are critical even where a field would only warn.
+	stored := box()
+	stored.UrgencyLevel = "critical"
+	for _, dims := range [][]float64{nil, {40, 30}, {40, 30, 20, 10}} {
+		out := Compare(DefaultRules(), stored, scanOf(48, 12.5, dims...))
+		if out.Result != models.ResultCriticalMismatch || len(out.Reasons) != 1 {
+			t.Fatalf("%v: result %s with reasons %+v", dims, out.Result, out.Reasons)
+		}
+		r := out.Reasons[0]
+		if r.Field != "dimensions_cm" || r.Axis != nil || r.Observed != float64(len(dims)) || r.Severity != models.SeverityCritical {
+			t.Errorf("%v: reason is %+v", dims, r)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package matching
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Tolerance is the allowed deviation for a single field. A reading is
+// accepted when |observed - expected| is within Abs or within Pct percent of
+// the expected value, whichever is larger.
+type Tolerance struct {
+	Abs float64 `json:"abs"`
+	Pct float64 `json:"pct"`
+}
+
+// Allowed returns the largest deviation accepted for the given expected value.
+func (t Tolerance) Allowed(expected float64) float64 {
+	return math.Max(t.Abs, math.Abs(expected)*t.Pct/100)
+}
+
+func (t Tolerance) String() string {
+	switch {
+	case t.Abs > 0 && t.Pct > 0:
+		return fmt.Sprintf("±%g or ±%g%%", t.Abs, t.Pct)
+	case t.Pct > 0:
+		return fmt.Sprintf("±%g%%", t.Pct)
+	default:
+		return fmt.Sprintf("±%g", t.Abs)
+	}
+}
+
+// Dimension comparison modes.
+const (
+	// DimensionsOrdered compares each scanned axis with the stored axis at the same index.
+	DimensionsOrdered = "ordered"
+	// DimensionsAnyOrientation sorts both sets of axes before comparing, so a
+	// box measured lying on a different side still matches.
+	DimensionsAnyOrientation = "any_orientation"
+)
+
+// FieldTolerances holds per-field tolerances. Nil or empty fields fall
+// through to the next, less specific rule set.
+type FieldTolerances struct {
+	Quantity     *Tolerance `json:"quantity,omitempty"`
+	WeightKg     *Tolerance `json:"weight_kg,omitempty"`
+	DimensionsCm *Tolerance `json:"dimensions_cm,omitempty"`
+
+	// DimensionMode is DimensionsOrdered or DimensionsAnyOrientation.
+	DimensionMode string `json:"dimension_mode,omitempty"`
+	// VolumeCm3, when set, additionally compares the product of the axes.
+	VolumeCm3 *Tolerance `json:"volume_cm3,omitempty"`
+}
+
+// Grade sets how a field's deviation is graded. A deviation within the
+// field's tolerance but beyond Warn is a warning. One beyond the tolerance
+// is a minor mismatch up to Critical and a critical mismatch past it.
+// Without Warn nothing within tolerance is flagged; without Critical a
+// mismatch is critical past twice the tolerance.
+type Grade struct {
+	Warn     *Tolerance `json:"warn,omitempty"`
+	Critical *Tolerance `json:"critical,omitempty"`
+}
+
+// FieldGrades holds per-field grades. Nil fields fall through to the grades
+// of all urgency levels, then to the built-in grading.
+type FieldGrades struct {
+	Quantity     *Grade `json:"quantity,omitempty"`
+	WeightKg     *Grade `json:"weight_kg,omitempty"`
+	DimensionsCm *Grade `json:"dimensions_cm,omitempty"`
+	VolumeCm3    *Grade `json:"volume_cm3,omitempty"`
+}
+
+// urgencyLevels are the values of MetadataPayload.UrgencyLevel.
+var urgencyLevels = map[string]bool{"normal": true, "priority": true, "critical": true}
+
+// Rules configures scan matching. Tolerances are resolved per field, with a
+// SKU rule taking precedence over a package type rule, which takes precedence
+// over the default. Grades are resolved per field too, with the rule for the
+// package's urgency level taking precedence over Grades.
+type Rules struct {
+	Default      FieldTolerances            `json:"default"`
+	PackageTypes map[string]FieldTolerances `json:"package_types"`
+	SKUs         map[string]FieldTolerances `json:"skus"`
+
+	Grades        FieldGrades            `json:"grades"`
+	UrgencyLevels map[string]FieldGrades `json:"urgency_levels"`
+}
+
+// DefaultRules requires exact quantities and allows for ordinary scale and
+// tape-measure error on weight and dimensions. A single missing or extra
+// item is a minor mismatch; on critical shipments every mismatch is
+// critical and readings close to the tolerance are warnings.
+func DefaultRules() *Rules {
+	return &Rules{
+		Default: FieldTolerances{
+			Quantity:      &Tolerance{},
+			WeightKg:      &Tolerance{Abs: 0.05, Pct: 2},
+			DimensionsCm:  &Tolerance{Abs: 1},
+			DimensionMode: DimensionsOrdered,
+		},
+		Grades: FieldGrades{
+			Quantity: &Grade{Critical: &Tolerance{Abs: 1}},
+		},
+		UrgencyLevels: map[string]FieldGrades{
+			"critical": {
+				Quantity:     &Grade{Critical: &Tolerance{}},
+				WeightKg:     &Grade{Warn: &Tolerance{Abs: 0.025, Pct: 1}, Critical: &Tolerance{}},
+				DimensionsCm: &Grade{Warn: &Tolerance{Abs: 0.5}, Critical: &Tolerance{}},
+				VolumeCm3:    &Grade{Critical: &Tolerance{}},
+			},
+		},
+	}
+}
+
+// LoadRules reads rules from a JSON file. Fields missing from the file's
+// default section keep the values from DefaultRules, and a file without
+// grades or urgency_levels keeps the default grading.
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	rules := &Rules{}
+	if err := json.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file: %w", err)
+	}
+
+	defaults := DefaultRules().Default
+	if rules.Default.Quantity == nil {
+		rules.Default.Quantity = defaults.Quantity
+	}
+	if rules.Default.WeightKg == nil {
+		rules.Default.WeightKg = defaults.WeightKg
+	}
+	if rules.Default.DimensionsCm == nil {
+		rules.Default.DimensionsCm = defaults.DimensionsCm
+	}
+	if rules.Default.DimensionMode == "" {
+		rules.Default.DimensionMode = defaults.DimensionMode
+	}
+	if rules.Grades == (FieldGrades{}) && rules.UrgencyLevels == nil {
+		rules.Grades = DefaultRules().Grades
+		rules.UrgencyLevels = DefaultRules().UrgencyLevels
+	}
+
+	if err := rules.validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (r *Rules) validate() error {
+	check := func(scope string, f FieldTolerances) error {
+		switch f.DimensionMode {
+		case "", DimensionsOrdered, DimensionsAnyOrientation:
+			return nil
+		}
+		return fmt.Errorf("%s: unknown dimension_mode %q", scope, f.DimensionMode)
+	}
+
+	if err := check("default", r.Default); err != nil {
+		return err
+	}
+	for name, f := range r.PackageTypes {
+		if err := check("package_types."+name, f); err != nil {
+			return err
+		}
+	}
+	for name, f := range r.SKUs {
+		if err := check("skus."+name, f); err != nil {
+			return err
+		}
+	}
+	for level := range r.UrgencyLevels {
+		if !urgencyLevels[level] {
+			return fmt.Errorf("urgency_levels: unknown urgency level %q", level)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the effective tolerances for a package.
+func (r *Rules) Resolve(sku, packageType string) FieldTolerances {
+	out := r.Default
+	if t, ok := r.PackageTypes[packageType]; ok {
+		out = out.overlay(t)
+	}
+	if t, ok := r.SKUs[sku]; ok {
+		out = out.overlay(t)
+	}
+	if out.Quantity == nil {
+		out.Quantity = &Tolerance{}
+	}
+	if out.WeightKg == nil {
+		out.WeightKg = &Tolerance{}
+	}
+	if out.DimensionsCm == nil {
+		out.DimensionsCm = &Tolerance{}
+	}
+	if out.DimensionMode == "" {
+		out.DimensionMode = DimensionsOrdered
+	}
+	return out
+}
+
+// ResolveGrades returns the effective grades for a package of the given
+// urgency level. Fields without a grade get an empty one.
+func (r *Rules) ResolveGrades(urgencyLevel string) FieldGrades {
+	out := r.Grades
+	if g, ok := r.UrgencyLevels[urgencyLevel]; ok {
+		out = out.overlay(g)
+	}
+	if out.Quantity == nil {
+		out.Quantity = &Grade{}
+	}
+	if out.WeightKg == nil {
+		out.WeightKg = &Grade{}
+	}
+	if out.DimensionsCm == nil {
+		out.DimensionsCm = &Grade{}
+	}
+	if out.VolumeCm3 == nil {
+		out.VolumeCm3 = &Grade{}
+	}
+	return out
+}
+
+func (f FieldGrades) overlay(o FieldGrades) FieldGrades {
+	if o.Quantity != nil {
+		f.Quantity = o.Quantity
+	}
+	if o.WeightKg != nil {
+		f.WeightKg = o.WeightKg
+	}
+	if o.DimensionsCm != nil {
+		f.DimensionsCm = o.DimensionsCm
+	}
+	if o.VolumeCm3 != nil {
+		f.VolumeCm3 = o.VolumeCm3
+	}
+	return f
+}
+
+func (f FieldTolerances) overlay(o FieldTolerances) FieldTolerances {
+	if o.Quantity != nil {
+		f.Quantity = o.Quantity
+	}
+	if o.WeightKg != nil {
+		f.WeightKg = o.WeightKg
+	}
+	if o.DimensionsCm != nil {
+		f.DimensionsCm = o.DimensionsCm
+	}
+	if o.DimensionMode != "" {
+		f.DimensionMode = o.DimensionMode
+	}
+	if o.VolumeCm3 != nil {
+		f.VolumeCm3 = o.VolumeCm3
+	}
+	return f
+}
@@ -0,0 +1,9 @@
+package models
+
+// DevicePayload registers a scanner device. PublicKey is the base64 encoded
+// 32-byte Ed25519 public key the device signs scans with.
+type DevicePayload struct {
+	DeviceID  string `json:"device_id" validate:"required,max=64,printascii"`
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key" validate:"required,base64"`
+}
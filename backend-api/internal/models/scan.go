@@ -9,4 +9,9 @@ type ScanPayload struct {
 	ScannedWeightKg    float64   `json:"scanned_weight_kg" validate:"required,gte=0"`
 	ScannedDimensions  []float64 `json:"scanned_dimensions_cm" validate:"required,dive,gte=0"`
 	Location           string    `json:"location"` // optional
+
+	// Set by registered scanners; see internal/device for what is signed.
+	DeviceID           string    `json:"device_id,omitempty"`
+	SignedAt           string    `json:"signed_at,omitempty"`
+	Signature          string    `json:"signature,omitempty"`
 }
@@ -0,0 +1,105 @@
+package models
+
+// ScanResult is the outcome of comparing a scan against its package's
+// metadata, graded by the most severe of its reasons.
+type ScanResult string
+
+const (
+	ResultMatch            ScanResult = "match"
+	ResultWarning          ScanResult = "warning"
+	ResultMinorMismatch    ScanResult = "minor_mismatch"
+	ResultCriticalMismatch ScanResult = "critical_mismatch"
+	// ResultUnknownPackage is a scan of a tracking ID with no metadata.
+	ResultUnknownPackage ScanResult = "unknown_package"
+	// ResultMismatch is the ungraded mismatch recorded before outcomes were
+	// graded. It is part of those scans' hashes and is never rewritten.
+	ResultMismatch ScanResult = "mismatch"
+)
+
+// ScanResults lists every ScanResult.
+var ScanResults = []ScanResult{
+	ResultMatch, ResultWarning, ResultMinorMismatch, ResultCriticalMismatch, ResultUnknownPackage, ResultMismatch,
+}
+
+// IsMismatch reports whether r records fields outside their tolerances.
+func (r ScanResult) IsMismatch() bool {
+	return r == ResultMinorMismatch || r == ResultCriticalMismatch || r == ResultMismatch
+}
+
+// Enum lists the values a ScanResult can take, for JSON schemas.
+func (ScanResult) Enum() []string {
+	values := make([]string, len(ScanResults))
+	for i, r := range ScanResults {
+		values[i] = string(r)
+	}
+	return values
+}
+
+// Severity grades how far a field is off; see matching.Grade.
+type Severity string
+
+const (
+	// SeverityWarning is within the tolerance but past its warning threshold.
+	SeverityWarning Severity = "warning"
+	// SeverityMinor is outside the tolerance but not critically.
+	SeverityMinor Severity = "minor"
+	// SeverityCritical is past the field's critical threshold.
+	SeverityCritical Severity = "critical"
+)
+
+// Severities lists every Severity, least severe first.
+var Severities = []Severity{SeverityWarning, SeverityMinor, SeverityCritical}
+
+// Enum lists the values a Severity can take, for JSON schemas.
+func (Severity) Enum() []string {
+	values := make([]string, len(Severities))
+	for i, s := range Severities {
+		values[i] = string(s)
+	}
+	return values
+}
+
+// MismatchReason records one field of a scan that fell outside its
+// tolerance, or, with SeverityWarning, came close to it. Delta is Observed -
+// Expected; Allowed is the largest |Delta| the tolerance accepted for
+// Expected. Axis is the stored axis (0 to 2) of a dimensions_cm reason about
+// a single axis.
+type MismatchReason struct {
+	Field     string   `json:"field"`
+	Axis      *int     `json:"axis,omitempty"`
+	Expected  float64  `json:"expected"`
+	Observed  float64  `json:"observed"`
+	Delta     float64  `json:"delta"`
+	Tolerance string   `json:"tolerance"`
+	Allowed   float64  `json:"allowed"`
+	Severity  Severity `json:"severity"`
+}
+
+// ScanLog is one entry of the scan log. Empty optional fields are omitted
+// from JSON, and so stored as null. The fields covered by ScanHash depend on
+// HashVersion; see internal/scanhash.
+type ScanLog struct {
+	ID                string    `json:"id,omitempty"`
+	TrackingID        string    `json:"tracking_id"`
+	Location          string    `json:"location"`
+	ScannedQuantity   int       `json:"scanned_quantity"`
+	ScannedWeightKg   float64   `json:"scanned_weight_kg"`
+	ScannedDimensions []float64 `json:"scanned_dimensions"`
+	// DimensionPermutation maps each stored axis to the scanned axis it was
+	// compared with; null when the dimensions could not be compared.
+	DimensionPermutation []int      `json:"dimension_permutation"`
+	Result               ScanResult `json:"result"`
+	// Reasons lists every flagged field; empty for a match.
+	Reasons []MismatchReason `json:"reasons"`
+	// Notes describes Reasons in words, one sentence per reason joined by
+	// "; ".
+	Notes    string `json:"notes"`
+	ScanTime string `json:"scan_time"`
+	// DeviceID is the registered scanner that signed the scan.
+	DeviceID     string `json:"device_id,omitempty"`
+	ScanHash     string `json:"scan_hash,omitempty"`
+	HashVersion  string `json:"hash_version,omitempty"`
+	PrevScanHash string `json:"prev_scan_hash,omitempty"`
+	// BatchID is set once the scan has been anchored in a batch.
+	BatchID string `json:"batch_id,omitempty"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// WebhookPayload subscribes a URL to webhook events. Secret is generated
+// when omitted; it is only ever returned in the response to this request.
+type WebhookPayload struct {
+	URL    string   `json:"url" validate:"required,http_url"`
+	Events []string `json:"events" validate:"required,min=1,dive,required"`
+	Secret string   `json:"secret" validate:"omitempty,min=16"`
+}
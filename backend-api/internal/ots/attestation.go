@@ -0,0 +1,97 @@
+package ots
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Attestation tags.
+var (
+	TagPending  = [8]byte{0x83, 0xdf, 0xe3, 0x0d, 0x2e, 0xf9, 0x0c, 0x8e}
+	TagBitcoin  = [8]byte{0x05, 0x88, 0x96, 0x0d, 0x73, 0xd7, 0x19, 0x01}
+	TagLitecoin = [8]byte{0x06, 0x86, 0x9a, 0x0d, 0x73, 0xd7, 0x1b, 0x45}
+)
+
+// Attestation is a claim that a message existed at some time. Payload is
+// kept in serialized form, so attestation types this package does not know
+// survive a parse/serialize round trip.
+type Attestation struct {
+	Tag     [8]byte
+	Payload []byte
+}
+
+// PendingAttestation says the calendar at uri will later provide a complete
+// attestation for the message.
+func PendingAttestation(uri string) Attestation {
+	var w writer
+	w.varBytes([]byte(uri))
+	return Attestation{Tag: TagPending, Payload: w.Bytes()}
+}
+
+// BitcoinAttestation says the message is the Merkle root of the Bitcoin block
+// at height.
+func BitcoinAttestation(height uint64) Attestation {
+	var w writer
+	w.varUint(height)
+	return Attestation{Tag: TagBitcoin, Payload: w.Bytes()}
+}
+
+// URI returns the calendar URI of a pending attestation.
+func (a Attestation) URI() (string, bool) {
+	if a.Tag != TagPending {
+		return "", false
+	}
+	r := newReader(a.Payload)
+	uri := r.varBytes(maxURILength)
+	if r.err != nil {
+		return "", false
+	}
+	return string(uri), true
+}
+
+// BitcoinHeight returns the block height of a Bitcoin attestation.
+func (a Attestation) BitcoinHeight() (uint64, bool) {
+	if a.Tag != TagBitcoin {
+		return 0, false
+	}
+	r := newReader(a.Payload)
+	height := r.varUint()
+	if r.err != nil {
+		return 0, false
+	}
+	return height, true
+}
+
+// String describes the attestation for logs and API responses.
+func (a Attestation) String() string {
+	if uri, ok := a.URI(); ok {
+		return "pending at " + uri
+	}
+	if height, ok := a.BitcoinHeight(); ok {
+		return fmt.Sprintf("bitcoin block %d", height)
+	}
+	if a.Tag == TagLitecoin {
+		return "litecoin block"
+	}
+	return fmt.Sprintf("unknown attestation %x", a.Tag)
+}
+
+// less orders attestations by tag, then by URI or height, then by payload.
+func (a Attestation) less(other Attestation) bool {
+	if c := bytes.Compare(a.Tag[:], other.Tag[:]); c != 0 {
+		return c < 0
+	}
+	if h1, ok := a.BitcoinHeight(); ok {
+		h2, _ := other.BitcoinHeight()
+		return h1 < h2
+	}
+	if u1, ok := a.URI(); ok {
+		u2, _ := other.URI()
+		return u1 < u2
+	}
+	return bytes.Compare(a.Payload, other.Payload) < 0
+}
+
+func (a Attestation) equal(other Attestation) bool {
+	return a.Tag == other.Tag && bytes.Equal(a.Payload, other.Payload)
+}
@@ -0,0 +1,132 @@
+package ots
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrAttestationMismatch is returned by Verify when a Bitcoin attestation
+// does not match the Merkle root of the block it names.
+var ErrAttestationMismatch = errors.New("ots: attestation does not match block header")
+
+// BlockHeader is the part of a Bitcoin block header a timestamp is checked
+// against. MerkleRoot is in internal byte order, as committed to by proofs.
+type BlockHeader struct {
+	MerkleRoot []byte
+	Time       time.Time
+}
+
+// BlockSource looks up Bitcoin block headers by height.
+type BlockSource interface {
+	BlockHeader(ctx context.Context, height uint64) (*BlockHeader, error)
+}
+
+// Esplora is a BlockSource backed by an Esplora HTTP API, such as
+// https://blockstream.info/api or a self-hosted instance.
+type Esplora struct {
+	URL  string
+	HTTP *http.Client
+}
+
+func (e *Esplora) BlockHeader(ctx context.Context, height uint64) (*BlockHeader, error) {
+	hash, err := e.get(ctx, fmt.Sprintf("/block-height/%d", height))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := e.get(ctx, "/block/"+strings.TrimSpace(string(hash)))
+	if err != nil {
+		return nil, err
+	}
+
+	var block struct {
+		MerkleRoot string `json:"merkle_root"`
+		Timestamp  int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(raw, &block); err != nil {
+		return nil, fmt.Errorf("failed to decode block %d: %w", height, err)
+	}
+	root, err := hex.DecodeString(block.MerkleRoot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merkle root for block %d: %w", height, err)
+	}
+	// Explorers display the root byte-reversed.
+	for i, j := 0, len(root)-1; i < j; i, j = i+1, j-1 {
+		root[i], root[j] = root[j], root[i]
+	}
+	return &BlockHeader{MerkleRoot: root, Time: time.Unix(block.Timestamp, 0).UTC()}, nil
+}
+
+func (e *Esplora) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(e.URL, "/")+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	client := e.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach block explorer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("block explorer responded with status %d for %s", resp.StatusCode, path)
+	}
+	return body, nil
+}
+
+// BitcoinHeight returns the lowest block height attested in d, or false if
+// d has no Bitcoin attestation yet.
+func (d *DetachedTimestamp) BitcoinHeight() (uint64, bool) {
+	var best uint64
+	found := false
+	for _, a := range d.Timestamp.AllAttestations() {
+		if h, ok := a.Attestation.BitcoinHeight(); ok && (!found || h < best) {
+			best, found = h, true
+		}
+	}
+	return best, found
+}
+
+// Verify checks every Bitcoin attestation in d against the block headers from
+// src and returns the earliest verified block.
+func Verify(ctx context.Context, d *DetachedTimestamp, src BlockSource) (uint64, *BlockHeader, error) {
+	var (
+		bestHeight uint64
+		best       *BlockHeader
+	)
+	for _, a := range d.Timestamp.AllAttestations() {
+		height, ok := a.Attestation.BitcoinHeight()
+		if !ok {
+			continue
+		}
+		header, err := src.BlockHeader(ctx, height)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !bytes.Equal(a.Msg, header.MerkleRoot) {
+			return 0, nil, fmt.Errorf("%w at height %d", ErrAttestationMismatch, height)
+		}
+		if best == nil || height < bestHeight {
+			bestHeight, best = height, header
+		}
+	}
+	if best == nil {
+		return 0, nil, errors.New("ots: timestamp has no bitcoin attestation")
+	}
+	return bestHeight, best, nil
+}
@@ -0,0 +1,184 @@
+package ots
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCalendars are the public calendars used by the reference client.
+var DefaultCalendars = []string{
+	"https://a.pool.opentimestamps.org",
+	"https://b.pool.opentimestamps.org",
+	"https://a.pool.eternitywall.com",
+	"https://ots.btc.catallaxy.com",
+}
+
+// ErrCommitmentNotFound is returned by Calendar.Timestamp while the calendar
+// has no completed timestamp for a commitment yet.
+var ErrCommitmentNotFound = errors.New("ots: commitment not found")
+
+const (
+	acceptHeader     = "application/vnd.opentimestamps.v1"
+	maxResponseBytes = 10000
+)
+
+// Calendar is a single OpenTimestamps calendar server.
+type Calendar struct {
+	URL  string
+	HTTP *http.Client
+}
+
+// Submit sends a digest to the calendar and returns its (pending) timestamp.
+func (c *Calendar) Submit(ctx context.Context, digest []byte) (*Timestamp, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(c.URL, "/")+"/digest", bytes.NewReader(digest))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", acceptHeader)
+
+	body, status, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("calendar %s responded with status %d", c.URL, status)
+	}
+	return ParseTimestamp(digest, body)
+}
+
+// Timestamp fetches the calendar's current timestamp for a commitment, as
+// listed in one of its pending attestations.
+func (c *Calendar) Timestamp(ctx context.Context, commitment []byte) (*Timestamp, error) {
+	url := strings.TrimRight(c.URL, "/") + "/timestamp/" + hex.EncodeToString(commitment)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", acceptHeader)
+
+	body, status, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case http.StatusOK:
+		return ParseTimestamp(commitment, body)
+	case http.StatusNotFound:
+		return nil, ErrCommitmentNotFound
+	default:
+		return nil, fmt.Errorf("calendar %s responded with status %d", c.URL, status)
+	}
+}
+
+func (c *Calendar) do(req *http.Request) ([]byte, int, error) {
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to reach calendar %s: %w", c.URL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read calendar response: %w", err)
+	}
+	return body, resp.StatusCode, nil
+}
+
+// Client stamps digests on a set of calendars.
+type Client struct {
+	Calendars []string
+	// MinResponses is how many calendars must accept a stamp; 0 means
+	// min(2, len(Calendars)), the reference client's default.
+	MinResponses int
+	HTTP         *http.Client
+}
+
+// NewClient returns a client for the given calendar URLs.
+func NewClient(calendars []string) *Client {
+	return &Client{Calendars: calendars, HTTP: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Stamp timestamps a SHA-256 file digest the way `ots stamp` does: a random
+// nonce is appended and hashed so calendars never see the digest itself,
+// and the result is submitted to every calendar.
+func (c *Client) Stamp(ctx context.Context, digest []byte) (*DetachedTimestamp, error) {
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("ots: digest must be %d bytes, got %d", sha256.Size, len(digest))
+	}
+	if len(c.Calendars) == 0 {
+		return nil, errors.New("ots: no calendars configured")
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	root := NewTimestamp(digest)
+	nonced, err := root.Add(Append(nonce))
+	if err != nil {
+		return nil, err
+	}
+	tip, err := nonced.Add(SHA256())
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		url   string
+		stamp *Timestamp
+		err   error
+	}
+	results := make(chan result, len(c.Calendars))
+	var wg sync.WaitGroup
+	for _, url := range c.Calendars {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			cal := &Calendar{URL: url, HTTP: c.HTTP}
+			stamp, err := cal.Submit(ctx, tip.Msg)
+			results <- result{url: url, stamp: stamp, err: err}
+		}(url)
+	}
+	wg.Wait()
+	close(results)
+
+	var errs []error
+	accepted := 0
+	for r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		if err := tip.Merge(r.stamp); err != nil {
+			errs = append(errs, fmt.Errorf("calendar %s: %w", r.url, err))
+			continue
+		}
+		accepted++
+	}
+
+	min := c.MinResponses
+	if min == 0 {
+		min = 2
+		if len(c.Calendars) < min {
+			min = len(c.Calendars)
+		}
+	}
+	if accepted < min {
+		return nil, fmt.Errorf("ots: %d of %d calendars accepted the stamp, need %d: %w", accepted, len(c.Calendars), min, errors.Join(errs...))
+	}
+	return &DetachedTimestamp{FileHashOp: SHA256(), Timestamp: root}, nil
+}
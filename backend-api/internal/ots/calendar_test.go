@@ -0,0 +1,174 @@
+package ots_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/ots"
+	"github.com/galanafai/aroni-backend/internal/ots/otstest"
+)
+
+// newCalendar serves cal on a local test server.
+func newCalendar(t *testing.T, cal http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(cal)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// malformed answers every request with 200 and bytes that are not a
+// timestamp.
+var malformed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/vnd.opentimestamps.v1")
+	w.Write([]byte{0xff, 0x00, 0x13, 0x37})
+})
+
+func pendingURIs(d *ots.DetachedTimestamp) []string {
+	var uris []string
+	for _, a := range d.Timestamp.AllAttestations() {
+		if uri, ok := a.Attestation.URI(); ok {
+			uris = append(uris, uri)
+		}
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+func TestStamp(t *testing.T) {
+	a := newCalendar(t, &otstest.Calendar{ConfirmAfter: time.Hour})
+	b := newCalendar(t, &otstest.Calendar{ConfirmAfter: time.Hour})
+	digest := sha256.Sum256([]byte("batch root"))
+
+	d, err := ots.NewClient([]string{a.URL, b.URL}).Stamp(context.Background(), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d.Digest(), digest[:]) {
+		t.Errorf("digest is %x, want %x", d.Digest(), digest)
+	}
+	want := []string{a.URL, b.URL}
+	sort.Strings(want)
+	if got := pendingURIs(d); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("pending attestations are %v, want %v", got, want)
+	}
+	if _, ok := d.BitcoinHeight(); ok {
+		t.Error("fresh stamp already has a Bitcoin attestation")
+	}
+
+	raw, err := d.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ots.ParseDetached(raw)
+	if err != nil {
+		t.Fatalf("stamp does not parse back: %v", err)
+	}
+	if got := pendingURIs(parsed); len(got) != 2 {
+		t.Errorf("parsed stamp has pending attestations %v", got)
+	}
+}
+
+func TestStampMalformedResponse(t *testing.T) {
+	good := newCalendar(t, &otstest.Calendar{ConfirmAfter: time.Hour})
+	bad := newCalendar(t, malformed)
+	digest := sha256.Sum256([]byte("batch root"))
+
+	if _, err := ots.NewClient([]string{bad.URL}).Stamp(context.Background(), digest[:]); err == nil {
+		t.Error("stamp accepted a malformed calendar response")
+	}
+
+	// The default needs two calendars, so one malformed answer fails the
+	// stamp; with MinResponses 1 the good calendar is enough.
+	c := ots.NewClient([]string{good.URL, bad.URL})
+	if _, err := c.Stamp(context.Background(), digest[:]); err == nil {
+		t.Error("stamp succeeded with one of two calendars")
+	}
+	c.MinResponses = 1
+	d, err := c.Stamp(context.Background(), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingURIs(d); len(got) != 1 || got[0] != good.URL {
+		t.Errorf("pending attestations are %v, want only %s", got, good.URL)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	cal := &otstest.Calendar{ConfirmAfter: time.Hour, BlockHeight: 840000}
+	srv := newCalendar(t, cal)
+	c := ots.NewClient([]string{srv.URL})
+	digest := sha256.Sum256([]byte("batch root"))
+
+	d, err := c.Stamp(context.Background(), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := c.Upgrade(context.Background(), d)
+	if err != nil || changed {
+		t.Fatalf("upgrade before confirmation: changed %v, err %v", changed, err)
+	}
+
+	cal.ConfirmAfter = 0
+	changed, err = c.Upgrade(context.Background(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("upgrade after confirmation changed nothing")
+	}
+	if height, ok := d.BitcoinHeight(); !ok || height != 840000 {
+		t.Errorf("Bitcoin height is %d (found %v), want 840000", height, ok)
+	}
+
+	changed, err = c.Upgrade(context.Background(), d)
+	if err != nil || changed {
+		t.Errorf("upgrade of a complete proof: changed %v, err %v", changed, err)
+	}
+}
+
+func TestUpgradeMalformedResponse(t *testing.T) {
+	bad := newCalendar(t, malformed)
+	// The fake accepts the stamp but points its pending attestation at the
+	// malformed calendar.
+	good := newCalendar(t, &otstest.Calendar{URL: bad.URL})
+	c := ots.NewClient([]string{good.URL, bad.URL})
+	c.MinResponses = 1
+	digest := sha256.Sum256([]byte("batch root"))
+
+	d, err := ots.NewClient([]string{good.URL}).Stamp(context.Background(), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := c.Upgrade(context.Background(), d)
+	if err == nil {
+		t.Error("upgrade accepted a malformed calendar response")
+	}
+	if changed {
+		t.Error("upgrade changed the proof from a malformed response")
+	}
+	if _, ok := d.BitcoinHeight(); ok {
+		t.Error("proof gained a Bitcoin attestation")
+	}
+}
+
+func TestUpgradeSkipsUnknownCalendars(t *testing.T) {
+	srv := newCalendar(t, &otstest.Calendar{BlockHeight: 1})
+	digest := sha256.Sum256([]byte("batch root"))
+
+	d, err := ots.NewClient([]string{srv.URL}).Stamp(context.Background(), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A client that does not list the calendar must not contact it.
+	changed, err := ots.NewClient([]string{"https://calendar.example"}).Upgrade(context.Background(), d)
+	if err != nil || changed {
+		t.Errorf("upgrade through an unlisted calendar: changed %v, err %v", changed, err)
+	}
+}
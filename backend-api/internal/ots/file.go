@@ -0,0 +1,66 @@
+package ots
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// headerMagic starts every detached .ots file.
+var headerMagic = []byte("\x00OpenTimestamps\x00\x00Proof\x00\xbf\x89\xe2\xe8\x84\xe8\x92\x94")
+
+const majorVersion = 1
+
+// DetachedTimestamp is the content of a .ots file: a timestamp for the
+// digest of a file, together with the hash operation that produced it.
+type DetachedTimestamp struct {
+	FileHashOp Op
+	Timestamp  *Timestamp
+}
+
+// Digest returns the file digest the timestamp commits to.
+func (d *DetachedTimestamp) Digest() []byte {
+	return d.Timestamp.Msg
+}
+
+// Serialize encodes d in the .ots file format.
+func (d *DetachedTimestamp) Serialize() ([]byte, error) {
+	if digestLength(d.FileHashOp.Tag) != len(d.Timestamp.Msg) {
+		return nil, errors.New("ots: digest does not match the file hash operation")
+	}
+
+	var w writer
+	w.Write(headerMagic)
+	w.varUint(majorVersion)
+	w.op(d.FileHashOp)
+	w.Write(d.Timestamp.Msg)
+	if err := w.timestamp(d.Timestamp); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// ParseDetached decodes a .ots file.
+func ParseDetached(data []byte) (*DetachedTimestamp, error) {
+	if !bytes.HasPrefix(data, headerMagic) {
+		return nil, errors.New("ots: not an OpenTimestamps proof")
+	}
+	r := newReader(data[len(headerMagic):])
+
+	if v := r.varUint(); r.err == nil && v != majorVersion {
+		return nil, fmt.Errorf("ots: unsupported proof version %d", v)
+	}
+	tag := r.byte()
+	if r.err == nil && digestLength(tag) == 0 {
+		return nil, fmt.Errorf("ots: 0x%02x is not a file hash operation", tag)
+	}
+	digest := append([]byte{}, r.bytes(digestLength(tag))...)
+	t := r.timestamp(digest, recursionLimit)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.buf) != 0 {
+		return nil, errors.New("ots: trailing data after proof")
+	}
+	return &DetachedTimestamp{FileHashOp: Op{Tag: tag}, Timestamp: t}, nil
+}
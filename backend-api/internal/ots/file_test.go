@@ -0,0 +1,63 @@
+package ots
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// vectorProof is a proof produced by the reference `ots stamp` for a file
+// holding the hex root fcb6ec3c…1973, with four pending calendar
+// attestations. It is kept in backend-api/anchored as well.
+const vectorProof = "" +
+	"004f70656e54696d657374616d7073000050726f6f6600bf89e2e884e8929401" +
+	"082fbf955feea2ad40703f0637f0ae7ee1e12141b6b0908c026582bc2935a375" +
+	"1bf010c7209b4412031c9c946d25b7ecd885ca08fff0100234f30ec7445f7b14" +
+	"723921b08caa9b08f104681535b6f00894eee24edb0312e80083dfe30d2ef90c" +
+	"8e232268747470733a2f2f6274632e63616c656e6461722e636174616c6c6178" +
+	"792e636f6dfff00825a90e58310632b108f0106cb623371fcdf78b7c9a431af6" +
+	"ec059308f1204483e08ff3220c7f202f5048bc4d278a075a55b08aa58a94c262" +
+	"9d1e1c81de5208f104681535b6f00862279d2115a697af0083dfe30d2ef90c8e" +
+	"2c2b68747470733a2f2f626f622e6274632e63616c656e6461722e6f70656e74" +
+	"696d657374616d70732e6f7267fff010a2007bd9b7e9a7172aeefd3712dbf48f" +
+	"08f120686f4304d099195d0df5003b6d83936575006a747f530140b7f67dc171" +
+	"efd6b708f104681535b7f008b3c5c70253b993540083dfe30d2ef90c8e292868" +
+	"747470733a2f2f66696e6e65792e63616c656e6461722e657465726e69747977" +
+	"616c6c2e636f6df008fa9b07b09c93d14708f010dcbdddb5dabd23914f571860" +
+	"395d7d8a08f120074f7f08ba022361813fed95c171500e4763a1d0f02bd3d4cc" +
+	"10d8fbaf87221208f020a5b2cb758edfa652a96a3dd6d390be9c423ceea478d3" +
+	"37d4d24d4f97c0730f7508f104681535b7f008c62365e664edeb230083dfe30d" +
+	"2ef90c8e2e2d68747470733a2f2f616c6963652e6274632e63616c656e646172" +
+	"2e6f70656e74696d657374616d70732e6f7267"
+
+const vectorRoot = "fcb6ec3c80433c00c16c31e86cfb03f25efd855279e350cf08d94158e3cf1973"
+
+// TestReferenceProof parses vectorProof and checks that re-serializing it
+// is byte-identical to the reference client's output.
+func TestReferenceProof(t *testing.T) {
+	raw, err := hex.DecodeString(vectorProof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := ParseDetached(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte(vectorRoot))
+	if !bytes.Equal(proof.Digest(), digest[:]) {
+		t.Errorf("digest is %x, want %x", proof.Digest(), digest)
+	}
+	if n := len(proof.Timestamp.AllAttestations()); n != 4 {
+		t.Errorf("found %d attestations, want 4", n)
+	}
+
+	out, err := proof.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, raw) {
+		t.Error("re-serialized proof differs from the original")
+	}
+}
@@ -0,0 +1,213 @@
+// Package ots is an in-process OpenTimestamps client: it builds and parses
+// .ots proofs and talks to calendar servers over HTTP, so batch roots can be
+// timestamped without the Python `ots` tool.
+//
+// The serialization follows python-opentimestamps byte for byte; a proof
+// written here can be upgraded and verified with the reference client.
+package ots
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/sha3"
+)
+
+// Operation tags.
+const (
+	OpSHA1      byte = 0x02
+	OpRIPEMD160 byte = 0x03
+	OpSHA256    byte = 0x08
+	OpKECCAK256 byte = 0x67
+	OpAppend    byte = 0xf0
+	OpPrepend   byte = 0xf1
+	OpReverse   byte = 0xf2
+	OpHexlify   byte = 0xf3
+)
+
+// Limits from the reference implementation.
+const (
+	maxMsgLength     = 4096
+	maxPayloadLength = 8192
+	maxURILength     = 1000
+	recursionLimit   = 256
+)
+
+// Op is one commitment operation. Arg is only set for OpAppend and OpPrepend.
+type Op struct {
+	Tag byte
+	Arg []byte
+}
+
+// Append returns an OpAppend with the given argument.
+func Append(arg []byte) Op { return Op{Tag: OpAppend, Arg: arg} }
+
+// Prepend returns an OpPrepend with the given argument.
+func Prepend(arg []byte) Op { return Op{Tag: OpPrepend, Arg: arg} }
+
+// SHA256 returns an OpSHA256.
+func SHA256() Op { return Op{Tag: OpSHA256} }
+
+func isBinary(tag byte) bool {
+	return tag == OpAppend || tag == OpPrepend
+}
+
+// digestLength returns the output size of a crypto op, or 0 for other ops.
+func digestLength(tag byte) int {
+	switch tag {
+	case OpSHA1, OpRIPEMD160:
+		return 20
+	case OpSHA256, OpKECCAK256:
+		return 32
+	}
+	return 0
+}
+
+// Apply runs the operation on msg.
+func (o Op) Apply(msg []byte) ([]byte, error) {
+	var out []byte
+	switch o.Tag {
+	case OpAppend:
+		out = append(append([]byte{}, msg...), o.Arg...)
+	case OpPrepend:
+		out = append(append([]byte{}, o.Arg...), msg...)
+	case OpReverse:
+		if len(msg) == 0 {
+			return nil, errors.New("ots: cannot reverse an empty message")
+		}
+		out = make([]byte, len(msg))
+		for i, b := range msg {
+			out[len(msg)-1-i] = b
+		}
+	case OpHexlify:
+		if len(msg) == 0 {
+			return nil, errors.New("ots: cannot hexlify an empty message")
+		}
+		out = []byte(hex.EncodeToString(msg))
+	case OpSHA1:
+		sum := sha1.Sum(msg)
+		out = sum[:]
+	case OpRIPEMD160:
+		h := ripemd160.New()
+		h.Write(msg)
+		out = h.Sum(nil)
+	case OpSHA256:
+		sum := sha256.Sum256(msg)
+		out = sum[:]
+	case OpKECCAK256:
+		h := sha3.NewLegacyKeccak256()
+		h.Write(msg)
+		out = h.Sum(nil)
+	default:
+		return nil, fmt.Errorf("ots: unknown operation 0x%02x", o.Tag)
+	}
+	if len(out) > maxMsgLength {
+		return nil, errors.New("ots: operation result too long")
+	}
+	return out, nil
+}
+
+func (o Op) less(other Op) bool {
+	if o.Tag != other.Tag {
+		return o.Tag < other.Tag
+	}
+	return bytes.Compare(o.Arg, other.Arg) < 0
+}
+
+func (o Op) equal(other Op) bool {
+	return o.Tag == other.Tag && bytes.Equal(o.Arg, other.Arg)
+}
+
+// Branch is an operation applied to a timestamp's message and the timestamp
+// of the result.
+type Branch struct {
+	Op        Op
+	Timestamp *Timestamp
+}
+
+// Timestamp proves that Msg existed at the times given by its attestations,
+// directly or through any of its branches.
+type Timestamp struct {
+	Msg          []byte
+	Attestations []Attestation
+	Branches     []Branch
+}
+
+// NewTimestamp returns an empty timestamp for msg.
+func NewTimestamp(msg []byte) *Timestamp {
+	return &Timestamp{Msg: msg}
+}
+
+// Add returns the timestamp reached by applying op to t's message, creating
+// the branch if it does not exist yet.
+func (t *Timestamp) Add(op Op) (*Timestamp, error) {
+	for _, b := range t.Branches {
+		if b.Op.equal(op) {
+			return b.Timestamp, nil
+		}
+	}
+	result, err := op.Apply(t.Msg)
+	if err != nil {
+		return nil, err
+	}
+	child := NewTimestamp(result)
+	t.Branches = append(t.Branches, Branch{Op: op, Timestamp: child})
+	sort.Slice(t.Branches, func(i, j int) bool { return t.Branches[i].Op.less(t.Branches[j].Op) })
+	return child, nil
+}
+
+// Attest adds an attestation to t unless it is already present.
+func (t *Timestamp) Attest(a Attestation) {
+	for _, existing := range t.Attestations {
+		if existing.equal(a) {
+			return
+		}
+	}
+	t.Attestations = append(t.Attestations, a)
+	sort.Slice(t.Attestations, func(i, j int) bool { return t.Attestations[i].less(t.Attestations[j]) })
+}
+
+// Merge adds the attestations and branches of other, which must be a
+// timestamp for the same message.
+func (t *Timestamp) Merge(other *Timestamp) error {
+	if !bytes.Equal(t.Msg, other.Msg) {
+		return errors.New("ots: cannot merge timestamps for different messages")
+	}
+	for _, a := range other.Attestations {
+		t.Attest(a)
+	}
+	for _, b := range other.Branches {
+		child, err := t.Add(b.Op)
+		if err != nil {
+			return err
+		}
+		if err := child.Merge(b.Timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Attested is an attestation together with the message it commits to.
+type Attested struct {
+	Msg         []byte
+	Attestation Attestation
+}
+
+// AllAttestations returns every attestation reachable from t.
+func (t *Timestamp) AllAttestations() []Attested {
+	var out []Attested
+	for _, a := range t.Attestations {
+		out = append(out, Attested{Msg: t.Msg, Attestation: a})
+	}
+	for _, b := range t.Branches {
+		out = append(out, b.Timestamp.AllAttestations()...)
+	}
+	return out
+}
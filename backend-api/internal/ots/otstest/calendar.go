@@ -0,0 +1,121 @@
+// Package otstest provides a fake OpenTimestamps calendar for tests and
+// local runs.
+package otstest
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/ots"
+)
+
+// contentType is what calendars answer with, as in package ots.
+const contentType = "application/vnd.opentimestamps.v1"
+
+// Calendar is a minimal calendar server. It accepts digests like a real
+// calendar and answers with a pending attestation pointing back at itself. Once ConfirmAfter has passed, a
+// commitment is upgraded with a Bitcoin attestation at BlockHeight; the
+// attestation is not backed by a real block.
+type Calendar struct {
+	// URL is put in pending attestations; it defaults to http://<Host>.
+	URL          string
+	ConfirmAfter time.Duration
+	BlockHeight  uint64
+
+	mu          sync.Mutex
+	commitments map[string]time.Time
+}
+
+func (c *Calendar) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/digest":
+		c.submit(w, r)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/timestamp/"):
+		c.timestamp(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (c *Calendar) submit(w http.ResponseWriter, r *http.Request) {
+	digest, err := io.ReadAll(io.LimitReader(r.Body, 65))
+	if err != nil || len(digest) == 0 || len(digest) > 64 {
+		http.Error(w, "invalid digest", http.StatusBadRequest)
+		return
+	}
+
+	// Like a real calendar: commit to the submission time and a server
+	// nonce, then promise a Bitcoin attestation for the result later.
+	var when [4]byte
+	binary.BigEndian.PutUint32(when[:], uint32(time.Now().Unix()))
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t := ots.NewTimestamp(digest)
+	prepended, _ := t.Add(ots.Prepend(when[:]))
+	appended, _ := prepended.Add(ots.Append(nonce))
+	commitment, _ := appended.Add(ots.SHA256())
+	commitment.Attest(ots.PendingAttestation(c.url(r)))
+
+	body, err := t.Serialize()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.mu.Lock()
+	if c.commitments == nil {
+		c.commitments = map[string]time.Time{}
+	}
+	c.commitments[hex.EncodeToString(commitment.Msg)] = time.Now()
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+func (c *Calendar) timestamp(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/timestamp/")
+	c.mu.Lock()
+	submitted, ok := c.commitments[key]
+	c.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if time.Since(submitted) < c.ConfirmAfter {
+		http.Error(w, "Pending confirmation in Bitcoin blockchain", http.StatusNotFound)
+		return
+	}
+
+	commitment, _ := hex.DecodeString(key)
+	t := ots.NewTimestamp(commitment)
+	appended, _ := t.Add(ots.Append([]byte("fake block")))
+	root, _ := appended.Add(ots.SHA256())
+	root.Attest(ots.BitcoinAttestation(c.BlockHeight))
+
+	body, err := t.Serialize()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+func (c *Calendar) url(r *http.Request) string {
+	if c.URL != "" {
+		return c.URL
+	}
+	return "http://" + r.Host
+}
@@ -0,0 +1,228 @@
+package ots
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is returned when a proof ends before it is complete.
+var ErrTruncated = errors.New("ots: truncated proof")
+
+type writer struct {
+	bytes.Buffer
+}
+
+func (w *writer) varUint(v uint64) {
+	for v >= 0x80 {
+		w.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	w.WriteByte(byte(v))
+}
+
+func (w *writer) varBytes(b []byte) {
+	w.varUint(uint64(len(b)))
+	w.Write(b)
+}
+
+func (w *writer) op(o Op) {
+	w.WriteByte(o.Tag)
+	if isBinary(o.Tag) {
+		w.varBytes(o.Arg)
+	}
+}
+
+func (w *writer) attestation(a Attestation) {
+	w.Write(a.Tag[:])
+	w.varBytes(a.Payload)
+}
+
+// timestamp writes t in the reference encoding: every attestation and
+// branch but the last is prefixed with 0xff, attestations with 0x00 and
+// come before the branches.
+func (w *writer) timestamp(t *Timestamp) error {
+	if len(t.Attestations) == 0 && len(t.Branches) == 0 {
+		return errors.New("ots: cannot serialize an empty timestamp")
+	}
+
+	for i, a := range t.Attestations {
+		if i < len(t.Attestations)-1 || len(t.Branches) > 0 {
+			w.WriteByte(0xff)
+		}
+		w.WriteByte(0x00)
+		w.attestation(a)
+	}
+	for i, b := range t.Branches {
+		if i < len(t.Branches)-1 {
+			w.WriteByte(0xff)
+		}
+		w.op(b.Op)
+		if err := w.timestamp(b.Timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type reader struct {
+	buf []byte
+	err error
+}
+
+func newReader(b []byte) *reader {
+	return &reader{buf: b}
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.buf) {
+		r.fail(ErrTruncated)
+		return nil
+	}
+	out := r.buf[:n]
+	r.buf = r.buf[n:]
+	return out
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) varUint() uint64 {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		if shift > 63 {
+			r.fail(errors.New("ots: varuint overflow"))
+			return 0
+		}
+		b := r.byte()
+		if r.err != nil {
+			return 0
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+func (r *reader) varBytes(max int) []byte {
+	n := r.varUint()
+	if r.err == nil && n > uint64(max) {
+		r.fail(fmt.Errorf("ots: %d bytes exceeds limit of %d", n, max))
+	}
+	return r.bytes(int(n))
+}
+
+func (r *reader) op(tag byte) Op {
+	switch {
+	case isBinary(tag):
+		arg := r.varBytes(maxMsgLength)
+		if r.err == nil && len(arg) == 0 {
+			r.fail(errors.New("ots: empty operation argument"))
+		}
+		return Op{Tag: tag, Arg: append([]byte{}, arg...)}
+	case digestLength(tag) > 0, tag == OpReverse, tag == OpHexlify:
+		return Op{Tag: tag}
+	default:
+		r.fail(fmt.Errorf("ots: unknown operation 0x%02x", tag))
+		return Op{}
+	}
+}
+
+func (r *reader) attestation() Attestation {
+	var a Attestation
+	copy(a.Tag[:], r.bytes(8))
+	a.Payload = append([]byte{}, r.varBytes(maxPayloadLength)...)
+	if r.err != nil {
+		return a
+	}
+	if a.Tag == TagPending {
+		if _, ok := a.URI(); !ok {
+			r.fail(errors.New("ots: invalid pending attestation"))
+		}
+	}
+	if a.Tag == TagBitcoin {
+		if _, ok := a.BitcoinHeight(); !ok {
+			r.fail(errors.New("ots: invalid bitcoin attestation"))
+		}
+	}
+	return a
+}
+
+func (r *reader) timestamp(msg []byte, depth int) *Timestamp {
+	if depth == 0 {
+		r.fail(errors.New("ots: proof nested too deeply"))
+		return nil
+	}
+	t := NewTimestamp(msg)
+
+	entry := func(tag byte) {
+		if tag == 0x00 {
+			t.Attest(r.attestation())
+			return
+		}
+		op := r.op(tag)
+		if r.err != nil {
+			return
+		}
+		result, err := op.Apply(msg)
+		if err != nil {
+			r.fail(err)
+			return
+		}
+		child := r.timestamp(result, depth-1)
+		if r.err != nil {
+			return
+		}
+		branch, _ := t.Add(op)
+		if err := branch.Merge(child); err != nil {
+			r.fail(err)
+		}
+	}
+
+	tag := r.byte()
+	for r.err == nil && tag == 0xff {
+		entry(r.byte())
+		tag = r.byte()
+	}
+	if r.err == nil {
+		entry(tag)
+	}
+	return t
+}
+
+// Serialize encodes t without a file header, as calendars return it.
+func (t *Timestamp) Serialize() ([]byte, error) {
+	var w writer
+	if err := w.timestamp(t); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// ParseTimestamp decodes a timestamp for msg, as returned by a calendar.
+func ParseTimestamp(msg, data []byte) (*Timestamp, error) {
+	r := newReader(data)
+	t := r.timestamp(msg, recursionLimit)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.buf) != 0 {
+		return nil, errors.New("ots: trailing data after timestamp")
+	}
+	return t, nil
+}
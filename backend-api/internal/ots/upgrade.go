@@ -0,0 +1,83 @@
+package ots
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+)
+
+// DefaultUpgradeWhitelist lists the calendars the reference client trusts to
+// upgrade pending attestations. A proof names the calendars to contact, so
+// only URIs matching these patterns or one of Client.Calendars are fetched.
+var DefaultUpgradeWhitelist = []string{
+	"https://*.calendar.opentimestamps.org",
+	"https://*.calendar.eternitywall.com",
+	"https://*.calendar.catallaxy.com",
+}
+
+// Upgrade asks the calendars named in d's pending attestations for their
+// completed timestamps and merges any they return. It reports whether d
+// changed; commitments a calendar has not confirmed yet are not an error.
+func (c *Client) Upgrade(ctx context.Context, d *DetachedTimestamp) (bool, error) {
+	changed := false
+	var errs []error
+
+	var walk func(t *Timestamp)
+	walk = func(t *Timestamp) {
+		if complete(t) {
+			return
+		}
+		for _, a := range t.Attestations {
+			uri, ok := a.URI()
+			if !ok || !c.allowed(uri) {
+				continue
+			}
+			cal := &Calendar{URL: uri, HTTP: c.HTTP}
+			upgraded, err := cal.Timestamp(ctx, t.Msg)
+			if errors.Is(err, ErrCommitmentNotFound) {
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := t.Merge(upgraded); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			changed = true
+		}
+		for _, b := range t.Branches {
+			walk(b.Timestamp)
+		}
+	}
+	walk(d.Timestamp)
+
+	return changed, errors.Join(errs...)
+}
+
+// complete reports whether t already has a Bitcoin attestation.
+func complete(t *Timestamp) bool {
+	for _, a := range t.AllAttestations() {
+		if a.Attestation.Tag == TagBitcoin {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) allowed(uri string) bool {
+	uri = strings.TrimRight(uri, "/")
+	for _, cal := range c.Calendars {
+		if strings.TrimRight(cal, "/") == uri {
+			return true
+		}
+	}
+	for _, pattern := range DefaultUpgradeWhitelist {
+		if ok, _ := path.Match(pattern, uri); ok {
+			return true
+		}
+	}
+	return false
+}
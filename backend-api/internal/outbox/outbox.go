@@ -0,0 +1,362 @@
+// Package outbox is a file-backed write-ahead queue for writes the store
+// refused. Each entry is one JSON file, written and synced before Enqueue
+// returns, so an accepted write survives a crash or restart until Replay
+// hands it to the store.
+//
+// Entries are replayed oldest first. Entries share a key when their order
+// matters (scans of one package, which are hash-chained): while one is
+// waiting for a retry, later entries with its key are held back. An entry
+// that still fails after MaxAttempts is moved to the dead letters in
+// Dir/dead, so it cannot hold its key back for good.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Entry is one queued write.
+type Entry struct {
+	ID          string          `json:"id"`
+	Key         string          `json:"key"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	QueuedAt    time.Time       `json:"queued_at"`
+	NextAttempt time.Time       `json:"next_attempt"`
+}
+
+// Outbox is a queue of entries kept in Dir. Failed entries are retried after
+// RetryDelay, doubling with every attempt up to MaxRetryDelay, for
+// MaxAttempts attempts in all; then they become dead letters, which are kept
+// but not retried.
+type Outbox struct {
+	Dir           string
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	MaxAttempts   int
+
+	mu       sync.Mutex
+	replayMu sync.Mutex
+	entries  map[string]*Entry
+	dead     map[string]*Entry
+	wake     chan struct{}
+}
+
+// Open opens the outbox in dir, creating the directory if needed, and loads
+// the entries and dead letters left in it.
+func Open(dir string, retryDelay, maxRetryDelay time.Duration, maxAttempts int) (*Outbox, error) {
+	o := &Outbox{
+		Dir:           dir,
+		RetryDelay:    retryDelay,
+		MaxRetryDelay: maxRetryDelay,
+		MaxAttempts:   maxAttempts,
+		wake:          make(chan struct{}, 1),
+	}
+	var err error
+	if o.entries, err = load(dir); err != nil {
+		return nil, err
+	}
+	if o.dead, err = load(o.deadDir()); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// load reads the entries in dir, creating it if needed.
+func load(dir string) (map[string]*Entry, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	entries := map[string]*Entry{}
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			// A write interrupted before its rename; Enqueue never returned.
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, fmt.Errorf("outbox entry %s is corrupt: %w", name, err)
+		}
+		entries[e.ID] = &e
+	}
+	return entries, nil
+}
+
+// Enqueue durably stores payload under key. The first attempt to replay it
+// is made after RetryDelay.
+func (o *Outbox) Enqueue(key string, payload any) (*Entry, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode outbox entry: %w", err)
+	}
+	now := time.Now().UTC()
+	e := &Entry{
+		// IDs sort in queue order, which keeps the directory readable.
+		ID:          fmt.Sprintf("%d-%s", now.UnixNano(), uuid.NewString()[:8]),
+		Key:         key,
+		Payload:     raw,
+		QueuedAt:    now,
+		NextAttempt: now.Add(o.RetryDelay),
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.write(o.Dir, e); err != nil {
+		return nil, err
+	}
+	o.entries[e.ID] = e
+	copied := *e
+	return &copied, nil
+}
+
+// Has reports whether any entry with key is queued.
+func (o *Outbox) Has(key string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, e := range o.entries {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Depth returns the number of queued entries, not counting dead letters.
+func (o *Outbox) Depth() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Entries returns the queued entries, oldest first.
+func (o *Outbox) Entries() []Entry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return copyEntries(sorted(o.entries))
+}
+
+// DeadLetters returns the entries that ran out of attempts, oldest first.
+func (o *Outbox) DeadLetters() []Entry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return copyEntries(sorted(o.dead))
+}
+
+// Replay offers every due entry to deliver, oldest first, and removes those
+// it accepts. It returns how many were delivered. Entries queued while it
+// runs wait for the next call.
+func (o *Outbox) Replay(ctx context.Context, deliver func(ctx context.Context, payload json.RawMessage) error) (int, error) {
+	o.replayMu.Lock()
+	defer o.replayMu.Unlock()
+
+	o.mu.Lock()
+	queued := sorted(o.entries)
+	o.mu.Unlock()
+
+	now := time.Now().UTC()
+	held := map[string]bool{}
+	delivered := 0
+	for _, e := range queued {
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+		if held[e.Key] {
+			continue
+		}
+		if e.NextAttempt.After(now) {
+			held[e.Key] = true
+			continue
+		}
+
+		// Only Replay changes queued entries, so e is safe to use unlocked.
+		err := deliver(ctx, e.Payload)
+
+		o.mu.Lock()
+		if err == nil {
+			err = os.Remove(o.path(e.ID))
+			if err == nil || os.IsNotExist(err) {
+				delete(o.entries, e.ID)
+				delivered++
+				err = nil
+			} else {
+				err = fmt.Errorf("failed to remove delivered entry %s: %w", e.ID, err)
+			}
+			o.mu.Unlock()
+			if err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		e.Attempts++
+		e.LastError = err.Error()
+		if o.MaxAttempts > 0 && e.Attempts >= o.MaxAttempts {
+			// Later entries with its key go ahead without it.
+			err = o.bury(e)
+			o.mu.Unlock()
+			if err != nil {
+				return delivered, err
+			}
+			log.Printf("🪦 Outbox entry %s (%s) moved to dead letters after %d attempts: %s", e.ID, e.Key, e.Attempts, e.LastError)
+			continue
+		}
+		held[e.Key] = true
+		e.NextAttempt = now.Add(o.retryDelay(e.Attempts))
+		err = o.write(o.Dir, e)
+		o.mu.Unlock()
+		if err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+// bury moves e from the queue to the dead letters. o.mu must be held.
+func (o *Outbox) bury(e *Entry) error {
+	if err := o.write(o.deadDir(), e); err != nil {
+		return err
+	}
+	if err := os.Remove(o.path(e.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove dead entry %s: %w", e.ID, err)
+	}
+	delete(o.entries, e.ID)
+	o.dead[e.ID] = e
+	return nil
+}
+
+// Run replays due entries every poll, or as soon as Wake is called, until
+// ctx is cancelled.
+func (o *Outbox) Run(ctx context.Context, poll time.Duration, deliver func(ctx context.Context, payload json.RawMessage) error) {
+	for {
+		delivered, err := o.Replay(ctx, deliver)
+		if err != nil {
+			log.Printf("❌ Outbox replay failed: %v", err)
+		}
+		if delivered > 0 {
+			log.Printf("📤 Replayed %d queued writes, %d still queued", delivered, o.Depth())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-time.After(poll):
+		}
+	}
+}
+
+// Wake makes Run replay without waiting for its next poll.
+func (o *Outbox) Wake() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// write stores e in dir atomically: a reader sees the old file or the new
+// one, never a partial write.
+func (o *Outbox) write(dir string, e *Entry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox entry: %w", err)
+	}
+	path := filepath.Join(dir, e.ID+".json")
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+	if _, err := f.Write(raw); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync outbox entry: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+
+	// Sync the directory so the rename itself survives a crash.
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to sync %s: %w", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", dir, err)
+	}
+	return nil
+}
+
+func (o *Outbox) path(id string) string {
+	return filepath.Join(o.Dir, id+".json")
+}
+
+func (o *Outbox) deadDir() string {
+	return filepath.Join(o.Dir, "dead")
+}
+
+func copyEntries(entries []*Entry) []Entry {
+	out := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, *e)
+	}
+	return out
+}
+
+// sorted returns entries oldest first. o.mu must be held for maps owned by
+// an Outbox.
+func sorted(entries map[string]*Entry) []*Entry {
+	out := make([]*Entry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].QueuedAt.Equal(out[j].QueuedAt) {
+			return out[i].QueuedAt.Before(out[j].QueuedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// retryDelay is the wait after the given number of failed attempts.
+func (o *Outbox) retryDelay(attempts int) time.Duration {
+	delay := o.RetryDelay
+	for i := 1; i < attempts && delay < o.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, o.MaxRetryDelay)
+}
@@ -0,0 +1,177 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// scan is the payload the tests queue.
+type scan struct {
+	Key string `json:"key"`
+	N   int    `json:"n"`
+}
+
+func open(t *testing.T, dir string, maxAttempts int) *Outbox {
+	t.Helper()
+	o, err := Open(dir, 0, 0, maxAttempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func enqueue(t *testing.T, o *Outbox, scans ...scan) {
+	t.Helper()
+	for _, s := range scans {
+		if _, err := o.Enqueue(s.Key, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// recorder delivers payloads, refusing those whose key is in fail, and
+// records the order it accepted them in.
+type recorder struct {
+	fail      map[string]bool
+	delivered []scan
+}
+
+func (r *recorder) deliver(ctx context.Context, payload json.RawMessage) error {
+	var s scan
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return err
+	}
+	if r.fail[s.Key] {
+		return errors.New("store unavailable")
+	}
+	r.delivered = append(r.delivered, s)
+	return nil
+}
+
+func TestReopenAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	o := open(t, dir, 0)
+	enqueue(t, o, scan{"a", 1}, scan{"b", 1}, scan{"a", 2})
+	want := o.Entries()
+
+	// A crash between writing an entry and renaming it leaves a .tmp file
+	// whose Enqueue never returned.
+	if err := os.WriteFile(filepath.Join(dir, "999-partial.json.tmp"), []byte(`{"id":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := open(t, dir, 0)
+	got := reopened.Entries()
+	if len(got) != len(want) {
+		t.Fatalf("reopened with %d entries, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i].ID != want[i].ID || string(got[i].Payload) != string(want[i].Payload) || !got[i].QueuedAt.Equal(want[i].QueuedAt) {
+			t.Errorf("entry %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "999-partial.json.tmp")); !os.IsNotExist(err) {
+		t.Errorf("partial write was not removed: %v", err)
+	}
+	if !reopened.Has("a") || !reopened.Has("b") || reopened.Has("c") {
+		t.Error("Has does not match the reopened entries")
+	}
+}
+
+func TestReplayOrder(t *testing.T) {
+	o := open(t, t.TempDir(), 0)
+	enqueue(t, o, scan{"a", 1}, scan{"b", 1}, scan{"a", 2}, scan{"a", 3})
+
+	r := &recorder{}
+	n, err := o.Replay(context.Background(), r.deliver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []scan{{"a", 1}, {"b", 1}, {"a", 2}, {"a", 3}}
+	if n != len(want) || len(r.delivered) != len(want) {
+		t.Fatalf("delivered %v, want %v", r.delivered, want)
+	}
+	for i := range want {
+		if r.delivered[i] != want[i] {
+			t.Errorf("delivery %d is %v, want %v", i, r.delivered[i], want[i])
+		}
+	}
+	if o.Depth() != 0 {
+		t.Errorf("%d entries left", o.Depth())
+	}
+}
+
+func TestFailedReplayStaysQueued(t *testing.T) {
+	dir := t.TempDir()
+	o := open(t, dir, 0)
+	enqueue(t, o, scan{"a", 1}, scan{"b", 1}, scan{"a", 2})
+
+	r := &recorder{fail: map[string]bool{"a": true}}
+	if _, err := o.Replay(context.Background(), r.deliver); err != nil {
+		t.Fatal(err)
+	}
+	// a/2 is held behind a/1 so a's chain keeps its order.
+	if len(r.delivered) != 1 || r.delivered[0] != (scan{"b", 1}) {
+		t.Fatalf("delivered %v, want only b/1", r.delivered)
+	}
+
+	reopened := open(t, dir, 0)
+	entries := reopened.Entries()
+	if len(entries) != 2 || entries[0].Attempts != 1 || entries[0].LastError != "store unavailable" || entries[1].Attempts != 0 {
+		t.Fatalf("entries after the failed replay are %+v", entries)
+	}
+
+	r.fail = nil
+	if _, err := reopened.Replay(context.Background(), r.deliver); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.delivered) != 3 || r.delivered[1] != (scan{"a", 1}) || r.delivered[2] != (scan{"a", 2}) {
+		t.Errorf("delivered %v, want b/1, a/1, a/2", r.delivered)
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	dir := t.TempDir()
+	o := open(t, dir, 2)
+	enqueue(t, o, scan{"a", 1})
+
+	r := &recorder{fail: map[string]bool{"a": true}}
+	if _, err := o.Replay(context.Background(), r.deliver); err != nil {
+		t.Fatal(err)
+	}
+	if o.Depth() != 1 || len(o.DeadLetters()) != 0 {
+		t.Fatalf("after one failure: depth %d, %d dead letters", o.Depth(), len(o.DeadLetters()))
+	}
+
+	// a/2 is queued behind a/1, which then runs out of attempts. a/2 must
+	// not wait for it.
+	enqueue(t, o, scan{"a", 2})
+	r.fail = map[string]bool{}
+	first := true
+	n, err := o.Replay(context.Background(), func(ctx context.Context, payload json.RawMessage) error {
+		if first {
+			first = false
+			return errors.New("violates check constraint")
+		}
+		return r.deliver(ctx, payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(r.delivered) != 1 || r.delivered[0] != (scan{"a", 2}) {
+		t.Fatalf("delivered %v, want a/2", r.delivered)
+	}
+	if o.Depth() != 0 || o.Has("a") {
+		t.Errorf("depth %d after the dead letter, want 0", o.Depth())
+	}
+
+	reopened := open(t, dir, 2)
+	dead := reopened.DeadLetters()
+	if reopened.Depth() != 0 || len(dead) != 1 || dead[0].Key != "a" || dead[0].Attempts != 2 || dead[0].LastError != "violates check constraint" {
+		t.Errorf("reopened with depth %d and dead letters %+v", reopened.Depth(), dead)
+	}
+}
@@ -0,0 +1,135 @@
+// Package receipt signs the receipts returned to scanners for every logged
+// scan, so a scanner or partner can later prove what the server accepted.
+//
+// A receipt is signed with Ed25519 over the RFC 8785 canonical JSON of every
+// receipt field except signature. Anyone holding the server's public key
+// (GET /api/receipt-key) can check one offline with Verify or any Ed25519
+// library.
+package receipt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/galanafai/aroni-backend/internal/crypto"
+)
+
+// Version identifies the receipt format and is part of the signed fields.
+const Version = "aroni-receipt-v1"
+
+// Algorithm is the signature algorithm used for receipts.
+const Algorithm = "Ed25519"
+
+// ErrInvalidSignature is returned by Verify when a receipt was not signed by
+// the given key or was changed after signing.
+var ErrInvalidSignature = errors.New("receipt signature is invalid")
+
+// Receipt is the signed part of a scan receipt.
+type Receipt struct {
+	Version     string `json:"version"`
+	KeyID       string `json:"key_id"`
+	TrackingID  string `json:"tracking_id"`
+	ScanHash    string `json:"scan_hash"`
+	HashVersion string `json:"hash_version"`
+	ScanTime    string `json:"scan_time"`
+	Result      string `json:"result"`
+}
+
+// Signed is a receipt together with its base64 signature.
+type Signed struct {
+	Receipt
+	Signature string `json:"signature"`
+}
+
+// Signer signs receipts with a single Ed25519 key.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewSigner returns a Signer for the given private key.
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, keyID: KeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// ParseSeed builds a Signer from a base64 encoded 32-byte Ed25519 seed, the
+// format of RECEIPT_SIGNING_KEY.
+func ParseSeed(encoded string) (*Signer, error) {
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signing key: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return NewSigner(ed25519.NewKeyFromSeed(seed)), nil
+}
+
+// GenerateSigner returns a Signer for a fresh random key.
+func GenerateSigner() (*Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(key), nil
+}
+
+// KeyID is the hex of the first 8 bytes of SHA-256 over the public key.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// PublicKey returns the signer's public key.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// KeyID returns the ID stamped on every receipt the signer issues.
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// Sign fills in Version and KeyID and signs the receipt.
+func (s *Signer) Sign(r Receipt) (*Signed, error) {
+	r.Version = Version
+	r.KeyID = s.keyID
+
+	msg, err := crypto.CanonicalJSON(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode receipt: %w", err)
+	}
+	sig := ed25519.Sign(s.key, msg)
+	return &Signed{Receipt: r, Signature: base64.StdEncoding.EncodeToString(sig)}, nil
+}
+
+// Verify checks a signed receipt against the server's public key.
+func Verify(pub ed25519.PublicKey, s Signed) error {
+	if len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(pub))
+	}
+	if s.Version != Version {
+		return fmt.Errorf("unsupported receipt version %q", s.Version)
+	}
+	if s.KeyID != KeyID(pub) {
+		return fmt.Errorf("receipt was signed by key %s, not %s", s.KeyID, KeyID(pub))
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	msg, err := crypto.CanonicalJSON(s.Receipt)
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %w", err)
+	}
+	if !ed25519.Verify(pub, msg, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package scanhash
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/models"
+)
+
+// ChainBreak describes one place where a package's scan chain is broken.
+type ChainBreak struct {
+	ScanHash string `json:"scan_hash"`
+	Detail   string `json:"detail"`
+}
+
+// ChainReport is the result of verifying the scans of one tracking ID.
+type ChainReport struct {
+	Valid  bool         `json:"valid"`
+	Length int          `json:"length"`
+	Breaks []ChainBreak `json:"breaks"`
+}
+
+// VerifyChain checks the scans of a single tracking ID. Every row
+// must still hash to its scan_hash, and every chained row must point at an
+// existing, earlier row that no other row also points at. Deleting, editing
+// or reordering a scan therefore shows up as a break. Rows hashed before
+// chaining existed are checked for alteration only.
+func VerifyChain(rows []models.ScanLog) ChainReport {
+	report := ChainReport{Length: len(rows), Breaks: []ChainBreak{}}
+
+	byHash := make(map[string]models.ScanLog, len(rows))
+	for _, row := range rows {
+		if row.ScanHash != "" {
+			byHash[row.ScanHash] = row
+		}
+	}
+
+	children := map[string][]string{}
+	starts := []string{}
+	for _, row := range rows {
+		hash := row.ScanHash
+
+		if computed, err := Recompute(row); err == nil && computed != hash {
+			report.Breaks = append(report.Breaks, ChainBreak{ScanHash: hash, Detail: "entry was altered after it was logged"})
+		}
+		if !Chained(row.HashVersion) {
+			continue
+		}
+
+		prev := row.PrevScanHash
+		if prev == "" {
+			starts = append(starts, hash)
+			continue
+		}
+		children[prev] = append(children[prev], hash)
+
+		prevRow, ok := byHash[prev]
+		if !ok {
+			report.Breaks = append(report.Breaks, ChainBreak{ScanHash: hash, Detail: fmt.Sprintf("previous entry %s is missing", prev)})
+			continue
+		}
+		if scanTime(row).Before(scanTime(prevRow)) {
+			report.Breaks = append(report.Breaks, ChainBreak{ScanHash: hash, Detail: "scan_time is earlier than the previous entry"})
+		}
+	}
+
+	if len(starts) > 1 {
+		sort.Strings(starts)
+		for _, hash := range starts[1:] {
+			report.Breaks = append(report.Breaks, ChainBreak{ScanHash: hash, Detail: "chain restarts without a previous entry"})
+		}
+	}
+
+	prevs := make([]string, 0, len(children))
+	for prev := range children {
+		prevs = append(prevs, prev)
+	}
+	sort.Strings(prevs)
+	for _, prev := range prevs {
+		if next := children[prev]; len(next) > 1 {
+			sort.Strings(next)
+			for _, hash := range next[1:] {
+				report.Breaks = append(report.Breaks, ChainBreak{ScanHash: hash, Detail: fmt.Sprintf("fork: %s already follows %s", next[0], prev)})
+			}
+		}
+	}
+
+	report.Valid = len(report.Breaks) == 0
+	return report
+}
+
+func scanTime(row models.ScanLog) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, row.ScanTime)
+	return t
+}
@@ -0,0 +1,165 @@
+// Package scanhash computes the scan_hash stored with every scan log entry.
+//
+// Version jcs-sha256-v1 is defined as follows, so any party holding a
+// scan_log row can reproduce the hash without this code:
+//
+//  1. Take exactly these fields from the row; a missing field is null:
+//     tracking_id, location, scanned_quantity, scanned_weight_kg,
+//     scanned_dimensions, dimension_permutation, result, notes, scan_time,
+//     hash_version.
+//  2. Normalise tracking_id to its lower-case string form and scan_time to
+//     UTC RFC 3339 with a "Z" suffix and no trailing fractional zeros
+//     (e.g. "2025-05-06T17:00:00Z").
+//  3. Encode the resulting object with the JSON Canonicalization Scheme
+//     (RFC 8785).
+//  4. scan_hash is the lower-case hex SHA-256 of those bytes.
+//
+// Version jcs-sha256-v2 is identical except that prev_scan_hash (the
+// scan_hash of the previous entry for the same tracking_id, null for the
+// first one) is added to the field list, chaining each package's scans.
+// Version jcs-sha256-v3 further adds device_id, the registered scanner that
+// signed the scan (null for unsigned scans). Version jcs-sha256-v4 further
+// adds reasons, the list of mismatch records (an empty list for a match).
+//
+// The version string is itself hashed, so a row cannot be relabelled to a
+// different scheme without changing its hash.
+package scanhash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/crypto"
+	"github.com/galanafai/aroni-backend/internal/models"
+)
+
+const (
+	// VersionLegacy marks hashes computed as SHA-256 over Go's json.Marshal
+	// of the scan map. They cannot be reproduced reliably and are never
+	// recomputed.
+	VersionLegacy = "json-sha256-v0"
+
+	// VersionJCSV1 is the canonical encoding documented above.
+	VersionJCSV1 = "jcs-sha256-v1"
+
+	// VersionJCSV2 adds prev_scan_hash to VersionJCSV1.
+	VersionJCSV2 = "jcs-sha256-v2"
+
+	// VersionJCSV3 adds device_id to VersionJCSV2.
+	VersionJCSV3 = "jcs-sha256-v3"
+
+	// VersionJCSV4 adds reasons to VersionJCSV3.
+	VersionJCSV4 = "jcs-sha256-v4"
+
+	// CurrentVersion is used for every new scan.
+	CurrentVersion = VersionJCSV4
+)
+
+// ErrUnsupportedVersion is returned for hash versions that cannot be recomputed.
+var ErrUnsupportedVersion = errors.New("hash version cannot be recomputed")
+
+var fieldsV1 = []string{
+	"tracking_id",
+	"location",
+	"scanned_quantity",
+	"scanned_weight_kg",
+	"scanned_dimensions",
+	"dimension_permutation",
+	"result",
+	"notes",
+	"scan_time",
+	"hash_version",
+}
+
+var fieldsV2 = append(append([]string{}, fieldsV1...), "prev_scan_hash")
+
+var fieldsV3 = append(append([]string{}, fieldsV2...), "device_id")
+
+var fieldsV4 = append(append([]string{}, fieldsV3...), "reasons")
+
+// fieldsByVersion lists the hashed fields of every recomputable version.
+var fieldsByVersion = map[string][]string{
+	VersionJCSV1: fieldsV1,
+	VersionJCSV2: fieldsV2,
+	VersionJCSV3: fieldsV3,
+	VersionJCSV4: fieldsV4,
+}
+
+// Chained reports whether rows hashed under version carry prev_scan_hash.
+func Chained(version string) bool {
+	return version != "" && version != VersionLegacy && version != VersionJCSV1
+}
+
+// Compute sets scan.HashVersion to CurrentVersion and returns the hash of
+// the scan under it.
+func Compute(scan *models.ScanLog) (string, error) {
+	scan.HashVersion = CurrentVersion
+	return Recompute(*scan)
+}
+
+// Recompute derives the hash of a stored scan using the version recorded in
+// its HashVersion. Scans without one are VersionLegacy.
+func Recompute(scan models.ScanLog) (string, error) {
+	version := scan.HashVersion
+	if version == "" {
+		version = VersionLegacy
+	}
+
+	canonical, err := Canonical(version, scan)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Canonical returns the exact bytes hashed for a scan under the given version.
+func Canonical(version string, scan models.ScanLog) ([]byte, error) {
+	fields, ok := fieldsByVersion[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedVersion, version)
+	}
+
+	// Work from the scan's JSON row, as stored, so the field names above
+	// are the whole definition.
+	raw, err := json.Marshal(scan)
+	if err != nil {
+		return nil, err
+	}
+	var row map[string]interface{}
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return nil, err
+	}
+
+	doc := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		doc[f] = row[f]
+	}
+	doc["hash_version"] = version
+
+	for _, f := range []string{"prev_scan_hash", "device_id"} {
+		if v, ok := doc[f]; ok && v == "" {
+			doc[f] = nil
+		}
+	}
+	if v, ok := doc["reasons"]; ok && v == nil {
+		doc["reasons"] = []interface{}{}
+	}
+	if v, ok := doc["tracking_id"]; ok && v != nil {
+		doc["tracking_id"] = strings.ToLower(fmt.Sprint(v))
+	}
+	if v, ok := doc["scan_time"].(string); ok {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scan_time %q: %w", v, err)
+		}
+		doc["scan_time"] = t.UTC().Format(time.RFC3339Nano)
+	}
+
+	return crypto.CanonicalJSON(doc)
+}
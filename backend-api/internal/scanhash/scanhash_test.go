@@ -0,0 +1,79 @@
+package scanhash
+
+import (
+	"testing"
+
+	"github.com/galanafai/aroni-backend/internal/models"
+)
+
+// TestRecompute checks scan hashes against canonical forms and SHA-256s
+// computed independently of this package, following the definition in the
+// package doc.
+func TestRecompute(t *testing.T) {
+	base := models.ScanLog{
+		TrackingID:           "3F2B8C1E-9D4A-4E6B-8F00-1A2B3C4D5E6F",
+		Location:             "Dock A",
+		ScannedQuantity:      48,
+		ScannedWeightKg:      12.4,
+		ScannedDimensions:    []float64{30, 40, 20},
+		DimensionPermutation: []int{1, 0, 2},
+		Result:               models.ResultMatch,
+		ScanTime:             "2025-05-06T19:00:00+02:00",
+	}
+
+	v1 := base
+	v1.HashVersion = VersionJCSV1
+
+	v4 := base
+	v4.HashVersion = VersionJCSV4
+	v4.ScannedQuantity = 47
+	v4.Result = models.ResultMinorMismatch
+	v4.Notes = "quantity mismatch: expected 48, observed 47, delta -1 exceeds tolerance ±0 (allowed 0)"
+	v4.Reasons = []models.MismatchReason{{Field: "quantity", Expected: 48, Observed: 47, Delta: -1, Tolerance: "±0", Severity: models.SeverityMinor}}
+	v4.PrevScanHash = "abababababababababababababababababababababababababababababababab"
+
+	tests := []struct {
+		name      string
+		scan      models.ScanLog
+		canonical string
+		hash      string
+	}{
+		{
+			name:      VersionJCSV1,
+			scan:      v1,
+			canonical: `{"dimension_permutation":[1,0,2],"hash_version":"jcs-sha256-v1","location":"Dock A","notes":"","result":"match","scan_time":"2025-05-06T17:00:00Z","scanned_dimensions":[30,40,20],"scanned_quantity":48,"scanned_weight_kg":12.4,"tracking_id":"3f2b8c1e-9d4a-4e6b-8f00-1a2b3c4d5e6f"}`,
+			hash:      "fac7d85779736b12b4b2b53c16872b16315e9c8a85b4bd184624b479b59f525d",
+		},
+		{
+			name:      VersionJCSV4,
+			scan:      v4,
+			canonical: `{"device_id":null,"dimension_permutation":[1,0,2],"hash_version":"jcs-sha256-v4","location":"Dock A","notes":"quantity mismatch: expected 48, observed 47, delta -1 exceeds tolerance ±0 (allowed 0)","prev_scan_hash":"abababababababababababababababababababababababababababababababab","reasons":[{"allowed":0,"delta":-1,"expected":48,"field":"quantity","observed":47,"severity":"minor","tolerance":"±0"}],"result":"minor_mismatch","scan_time":"2025-05-06T17:00:00Z","scanned_dimensions":[30,40,20],"scanned_quantity":47,"scanned_weight_kg":12.4,"tracking_id":"3f2b8c1e-9d4a-4e6b-8f00-1a2b3c4d5e6f"}`,
+			hash:      "f280623a7e4d75baf71b2583d71bd2579ce9ff61e0a75f6387d72286791a88e7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canonical, err := Canonical(tt.scan.HashVersion, tt.scan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(canonical) != tt.canonical {
+				t.Errorf("canonical form is\n%s\nwant\n%s", canonical, tt.canonical)
+			}
+			hash, err := Recompute(tt.scan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != tt.hash {
+				t.Errorf("hash is %s, want %s", hash, tt.hash)
+			}
+		})
+	}
+}
+
+func TestRecomputeLegacy(t *testing.T) {
+	if _, err := Recompute(models.ScanLog{TrackingID: "x"}); err == nil {
+		t.Error("legacy scans were recomputed")
+	}
+}
@@ -0,0 +1,175 @@
+// Package schema derives JSON Schemas (draft 2020-12) for API responses from
+// the Go types they are encoded from. It reads json tags the way
+// encoding/json does: fields tagged omitempty are optional, all others are
+// required, and nil slices, maps and pointers without omitempty may be
+// null. Named struct types are emitted once under $defs.
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema dialect of generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Enumer is implemented by string types with a fixed set of values, which
+// become the type's enum.
+type Enumer interface {
+	Enum() []string
+}
+
+var (
+	enumerType    = reflect.TypeOf((*Enumer)(nil)).Elem()
+	timeType      = reflect.TypeOf(time.Time{})
+	rawJSONType   = reflect.TypeOf(json.RawMessage{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType      = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Schema is a JSON Schema document.
+type Schema map[string]any
+
+// Generate returns the schema of the JSON encoding of v's type, titled
+// title.
+func Generate(title string, v any) Schema {
+	g := &generator{defs: map[string]Schema{}}
+	root := g.schema(reflect.TypeOf(v))
+
+	out := Schema{"$schema": Draft, "title": title}
+	for k, val := range root {
+		out[k] = val
+	}
+	if len(g.defs) > 0 {
+		out["$defs"] = g.defs
+	}
+	return out
+}
+
+type generator struct {
+	defs map[string]Schema
+}
+
+func (g *generator) schema(t reflect.Type) Schema {
+	if t == nil {
+		return Schema{}
+	}
+	if t.Implements(enumerType) && t.Kind() == reflect.String {
+		values := reflect.Zero(t).Interface().(Enumer).Enum()
+		return Schema{"type": "string", "enum": values}
+	}
+	switch t {
+	case timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case rawJSONType:
+		return Schema{}
+	}
+	if t.Implements(marshalerType) {
+		// A custom encoding can be anything.
+		return Schema{}
+	}
+	if t.Implements(textType) {
+		return Schema{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes byte slices as base64.
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return Schema{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil // reserve the name for recursive types
+			g.defs[t.Name()] = g.object(t)
+		}
+		return Schema{"$ref": "#/$defs/" + t.Name()}
+	}
+	// Interfaces can encode to anything.
+	return Schema{}
+}
+
+// object returns the schema of a struct's fields, flattening embedded
+// structs as encoding/json does.
+func (g *generator) object(t reflect.Type) Schema {
+	props := Schema{}
+	required := []string{}
+	g.fields(t, props, &required)
+	return Schema{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func (g *generator) fields(t reflect.Type, props Schema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && indirect(f.Type).Kind() == reflect.Struct {
+			g.fields(indirect(f.Type), props, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s := g.schema(f.Type)
+		omitempty := strings.Contains(opts, "omitempty")
+		if !omitempty && nullable(f.Type) {
+			s = Schema{"anyOf": []Schema{s, {"type": "null"}}}
+		}
+		props[name] = s
+		if !omitempty {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// nullable reports whether encoding/json writes null for the zero value of
+// t.
+func nullable(t reflect.Type) bool {
+	if t == rawJSONType || t.Implements(marshalerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,280 @@
+// Package tsa implements the client side of the RFC 3161 Time-Stamp
+// Protocol: building a TimeStampReq for a SHA-256 digest and parsing the
+// TimeStampToken a Time Stamping Authority signs over it.
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Content types of RFC 3161 §3.4 requests and responses sent over HTTP.
+const (
+	ContentTypeQuery = "application/timestamp-query"
+	ContentTypeReply = "application/timestamp-reply"
+)
+
+// PKIStatus values of a TimeStampResp.
+const (
+	StatusGranted                = 0
+	StatusGrantedWithMods        = 1
+	StatusRejection              = 2
+	StatusWaiting                = 3
+	StatusRevocationWarning      = 4
+	StatusRevocationNotification = 5
+)
+
+// maxResponseSize bounds how much of a TSA reply is read.
+const maxResponseSize = 1 << 20
+
+var (
+	oidSHA256     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+)
+
+// ErrImprintMismatch is returned when a token does not cover the digest
+// that was sent, or does not echo the request's nonce.
+var ErrImprintMismatch = errors.New("timestamp token does not match the request")
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// TSTInfo is the signed content of a timestamp token.
+type TSTInfo struct {
+	Policy        asn1.ObjectIdentifier
+	HashAlgorithm asn1.ObjectIdentifier
+	HashedMessage []byte
+	SerialNumber  *big.Int
+	GenTime       time.Time
+	Nonce         *big.Int
+}
+
+// Token is a parsed TimeStampToken.
+type Token struct {
+	// Raw is the DER ContentInfo, as stored and as accepted by
+	// `openssl ts -verify -token_in`.
+	Raw  []byte
+	Info TSTInfo
+
+	signed signedData
+	// content is the DER TSTInfo the signer's messageDigest covers.
+	content []byte
+}
+
+// NewRequest returns the DER TimeStampReq for a SHA-256 digest. The TSA is
+// asked to include its certificate so the token can be checked on its own.
+func NewRequest(digest []byte, nonce *big.Int) ([]byte, error) {
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("digest must be %d bytes, got %d", sha256.Size, len(digest))
+	}
+	return asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+}
+
+// ParseResponse parses a DER TimeStampResp and returns its token, or an
+// error if the TSA did not grant the request.
+func ParseResponse(der []byte) (*Token, error) {
+	var resp timeStampResp
+	rest, err := asn1.Unmarshal(der, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TimeStampResp: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("invalid TimeStampResp: trailing data")
+	}
+
+	if s := resp.Status.Status; s != StatusGranted && s != StatusGrantedWithMods {
+		var text []string
+		for _, v := range resp.Status.StatusString {
+			text = append(text, string(v.Bytes))
+		}
+		return nil, fmt.Errorf("TSA refused the request: status %d %s", s, strings.Join(text, "; "))
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("TSA granted the request but sent no token")
+	}
+	return ParseToken(resp.TimeStampToken.FullBytes)
+}
+
+// ParseToken parses a DER TimeStampToken. It does not check the signature.
+func ParseToken(der []byte) (*Token, error) {
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(der, &ci)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TimeStampToken: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("invalid TimeStampToken: trailing data")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("invalid TimeStampToken: content type %v is not signedData", ci.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("invalid SignedData: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("invalid TimeStampToken: content type %v is not TSTInfo", sd.EncapContentInfo.EContentType)
+	}
+	var content []byte
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &content); err != nil {
+		return nil, fmt.Errorf("invalid TimeStampToken content: %w", err)
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(content, &info); err != nil {
+		return nil, fmt.Errorf("invalid TSTInfo: %w", err)
+	}
+
+	return &Token{
+		Raw: der,
+		Info: TSTInfo{
+			Policy:        info.Policy,
+			HashAlgorithm: info.MessageImprint.HashAlgorithm.Algorithm,
+			HashedMessage: info.MessageImprint.HashedMessage,
+			SerialNumber:  info.SerialNumber,
+			GenTime:       info.GenTime,
+			Nonce:         info.Nonce,
+		},
+		signed:  sd,
+		content: content,
+	}, nil
+}
+
+// Covers reports whether the token timestamps the given SHA-256 digest.
+func (t *Token) Covers(digest []byte) bool {
+	return t.Info.HashAlgorithm.Equal(oidSHA256) && bytes.Equal(t.Info.HashedMessage, digest)
+}
+
+// Client requests timestamps from one TSA over HTTP.
+type Client struct {
+	URL  string
+	HTTP *http.Client
+}
+
+// NewClient returns a client for the TSA at url.
+func NewClient(url string) *Client {
+	return &Client{URL: url, HTTP: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Timestamp asks the TSA to timestamp a SHA-256 digest and returns the
+// token once it has checked that the token covers that digest.
+func (c *Client) Timestamp(ctx context.Context, digest []byte) (*Token, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	body, err := NewRequest(digest, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", ContentTypeQuery)
+	req.Header.Set("Accept", ContentTypeReply)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TSA responded with status %d", resp.StatusCode)
+	}
+
+	token, err := ParseResponse(reply)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Covers(digest) || token.Info.Nonce == nil || token.Info.Nonce.Cmp(nonce) != 0 {
+		return nil, ErrImprintMismatch
+	}
+	return token, nil
+}
@@ -0,0 +1,141 @@
+package tsa
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/galanafai/aroni-backend/internal/tsa/tsatest"
+)
+
+// newTSA serves h on a local test server and returns a client for it.
+func newTSA(t *testing.T, h http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL)
+}
+
+func newStub(t *testing.T) *tsatest.Stub {
+	t.Helper()
+	stub, err := tsatest.NewStub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stub
+}
+
+// rewrite answers each request with stub's reply to the request edit
+// returns, standing in for a TSA that signs something other than what it
+// was asked to.
+func rewrite(t *testing.T, stub *tsatest.Stub, edit func(*timeStampReq)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var req timeStampReq
+		if _, err := asn1.Unmarshal(body, &req); err != nil {
+			t.Error(err)
+			return
+		}
+		edit(&req)
+		query, err := asn1.Marshal(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		reply, err := stub.Respond(query)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeReply)
+		w.Write(reply)
+	}
+}
+
+func TestTimestampGranted(t *testing.T) {
+	stub := newStub(t)
+	digest := sha256.Sum256([]byte("batch root"))
+
+	token, err := newTSA(t, stub).Timestamp(context.Background(), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.Covers(digest[:]) {
+		t.Error("token does not cover the digest")
+	}
+	if token.Info.Nonce == nil {
+		t.Error("token has no nonce")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(stub.CA)
+	signer, err := token.Verify(roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.Equal(stub.Cert) {
+		t.Errorf("signed by %s, want %s", signer.Subject, stub.Cert.Subject)
+	}
+}
+
+func TestTimestampRejected(t *testing.T) {
+	client := newTSA(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply, err := tsatest.Reject("policy not supported", tsatest.FailInfoBadAlg)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeReply)
+		w.Write(reply)
+	}))
+	digest := sha256.Sum256([]byte("batch root"))
+
+	_, err := client.Timestamp(context.Background(), digest[:])
+	if err == nil || !strings.Contains(err.Error(), "status 2") || !strings.Contains(err.Error(), "policy not supported") {
+		t.Errorf("rejected request gave %v, want a status 2 refusal", err)
+	}
+}
+
+func TestTimestampHTTPError(t *testing.T) {
+	client := newTSA(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	digest := sha256.Sum256([]byte("batch root"))
+
+	if _, err := client.Timestamp(context.Background(), digest[:]); err == nil || !strings.Contains(err.Error(), "status 503") {
+		t.Errorf("HTTP 503 gave %v", err)
+	}
+}
+
+func TestTimestampMismatch(t *testing.T) {
+	stub := newStub(t)
+	other := sha256.Sum256([]byte("another root"))
+	tests := []struct {
+		name string
+		edit func(*timeStampReq)
+	}{
+		{"nonce", func(req *timeStampReq) { req.Nonce = new(big.Int).Add(req.Nonce, big.NewInt(1)) }},
+		{"no nonce", func(req *timeStampReq) { req.Nonce = nil }},
+		{"hash", func(req *timeStampReq) { req.MessageImprint.HashedMessage = other[:] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest := sha256.Sum256([]byte("batch root"))
+			_, err := newTSA(t, rewrite(t, stub, tt.edit)).Timestamp(context.Background(), digest[:])
+			if !errors.Is(err, ErrImprintMismatch) {
+				t.Errorf("got %v, want %v", err, ErrImprintMismatch)
+			}
+		})
+	}
+}
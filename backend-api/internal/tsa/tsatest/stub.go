@@ -0,0 +1,362 @@
+// Package tsatest provides a stub RFC 3161 Time Stamping Authority for
+// tests and local runs. It encodes its tokens independently of package tsa,
+// so tests of the client are not checking the client against itself.
+package tsatest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Content type of replies, PKIStatus values and OIDs as in package tsa.
+const (
+	contentTypeReply = "application/timestamp-reply"
+	statusGranted    = 0
+	statusRejection  = 2
+)
+
+var (
+	oidSHA256            = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSignedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttrContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningCertV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidECDSAWithSHA256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidExtKeyUsage       = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidKeyPurposeTSA     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+	oidStubPolicy        = asn1.ObjectIdentifier{1, 2, 3, 4, 1}
+)
+
+// PKIFailureInfo bits for Reject.
+var (
+	FailInfoBadAlg        = asn1.BitString{Bytes: []byte{0x80}, BitLength: 1}
+	FailInfoBadDataFormat = asn1.BitString{Bytes: []byte{0x04}, BitLength: 6}
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	SignerInfos      asn1.RawValue
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       accuracy  `asn1:"optional"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type essCertID struct {
+	CertHash []byte
+}
+
+type signingCertificate struct {
+	Certs []asn1.RawValue
+}
+
+// Stub is a minimal Time Stamping Authority. It signs SHA-256 requests with a throwaway ECDSA key whose
+// certificate is issued by CA; configure CA as the trusted TSA certificate
+// to verify its tokens. Its genTime is the local clock.
+type Stub struct {
+	CA     *x509.Certificate
+	Cert   *x509.Certificate
+	Signer crypto.Signer
+
+	mu     sync.Mutex
+	serial int64
+}
+
+// NewStub generates a CA and a time-stamping certificate issued by it.
+func NewStub() (*Stub, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Aroni Stub TSA CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	// RFC 3161 §2.3 requires the extended key usage to be critical, which
+	// the template's ExtKeyUsage field cannot express.
+	eku, err := asn1.Marshal([]asn1.ObjectIdentifier{oidKeyPurposeTSA})
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: "Aroni Stub TSA"},
+		NotBefore:       now.Add(-time.Hour),
+		NotAfter:        now.AddDate(10, 0, 0),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: oidExtKeyUsage, Critical: true, Value: eku}},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TSA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stub{CA: ca, Cert: cert, Signer: key}, nil
+}
+
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "failed to read request", http.StatusBadRequest)
+		return
+	}
+	reply, err := s.Respond(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeReply)
+	w.Write(reply)
+}
+
+// Respond answers a DER TimeStampReq with a DER TimeStampResp. Malformed or
+// non-SHA-256 requests get a rejection rather than an error.
+func (s *Stub) Respond(query []byte) ([]byte, error) {
+	var req timeStampReq
+	rest, err := asn1.Unmarshal(query, &req)
+	if err != nil || len(rest) > 0 || req.Version != 1 {
+		return Reject("malformed TimeStampReq", FailInfoBadDataFormat)
+	}
+	imprint := req.MessageImprint
+	if !imprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || len(imprint.HashedMessage) != sha256.Size {
+		return Reject("only SHA-256 imprints are supported", FailInfoBadAlg)
+	}
+
+	s.mu.Lock()
+	s.serial++
+	serial := s.serial
+	s.mu.Unlock()
+
+	content, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         oidStubPolicy,
+		MessageImprint: imprint,
+		SerialNumber:   big.NewInt(serial),
+		GenTime:        time.Now().UTC().Truncate(time.Second),
+		Accuracy:       accuracy{Seconds: 1},
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.sign(content, req.CertReq)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(timeStampResp{
+		Status:         pkiStatusInfo{Status: statusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+}
+
+// sign wraps a DER TSTInfo in a CMS SignedData ContentInfo.
+func (s *Stub) sign(content []byte, includeCert bool) ([]byte, error) {
+	digest := sha256.Sum256(content)
+	certHash := sha256.Sum256(s.Cert.Raw)
+	essID, err := asn1.Marshal(essCertID{CertHash: certHash[:]})
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs [][]byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidAttrContentType, oidTSTInfo},
+		{oidAttrMessageDigest, digest[:]},
+		{oidAttrSigningCertV2, signingCertificate{Certs: []asn1.RawValue{{FullBytes: essID}}}},
+	} {
+		value, err := asn1.Marshal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(attribute{
+			Type:   a.oid,
+			Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	// DER orders the members of a SET OF by their encodings.
+	sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+	attrBytes := bytes.Join(attrs, nil)
+
+	signedAttrs, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrBytes})
+	if err != nil {
+		return nil, err
+	}
+	attrDigest := sha256.Sum256(signedAttrs)
+	signature, err := s.Signer.Sign(rand.Reader, attrDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerial{
+		Issuer:       asn1.RawValue{FullBytes: s.Cert.RawIssuer},
+		SerialNumber: s.Cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	signerInfos, err := asn1.MarshalWithParams([]signerInfo{{
+		Version:            1,
+		SID:                asn1.RawValue{FullBytes: sid},
+		DigestAlgorithm:    sha256ID,
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrBytes},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+		Signature:          signature,
+	}}, "set")
+	if err != nil {
+		return nil, err
+	}
+	digestAlgorithms, err := asn1.MarshalWithParams([]pkix.AlgorithmIdentifier{sha256ID}, "set")
+	if err != nil {
+		return nil, err
+	}
+	eContent, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: asn1.RawValue{FullBytes: digestAlgorithms},
+		EncapContentInfo: encapContentInfo{
+			EContentType: oidTSTInfo,
+			EContent:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: eContent},
+		},
+		SignerInfos: asn1.RawValue{FullBytes: signerInfos},
+	}
+	if includeCert {
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: s.Cert.Raw}
+	}
+	sdBytes, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdBytes},
+	})
+}
+
+// Reject returns a DER TimeStampResp refusing a request for reason.
+func Reject(reason string, failInfo asn1.BitString) ([]byte, error) {
+	return asn1.Marshal(timeStampResp{Status: pkiStatusInfo{
+		Status:       statusRejection,
+		StatusString: []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(reason)}},
+		FailInfo:     failInfo,
+	}})
+}
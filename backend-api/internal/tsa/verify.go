@@ -0,0 +1,311 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	// Registers SHA-384 and SHA-512 for crypto.Hash.New.
+	_ "crypto/sha512"
+)
+
+// ErrUntrustedSigner is returned when a token's signature is valid but its
+// signer does not chain to a configured TSA certificate.
+var ErrUntrustedSigner = errors.New("timestamp token is not signed by a trusted TSA")
+
+// ErrInvalidSignature is returned when a token's signature, or the digest of
+// its content, does not check out.
+var ErrInvalidSignature = errors.New("invalid timestamp token signature")
+
+var (
+	oidAttrContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningCert   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidAttrSigningCertV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSAPSS = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+)
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// essCertID covers both ESSCertID (SHA-1 only) and ESSCertIDv2, whose hash
+// algorithm defaults to SHA-256.
+type essCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+	IssuerSerial  asn1.RawValue `asn1:"optional"`
+}
+
+type signingCertificate struct {
+	Certs    []asn1.RawValue
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+// LoadCertPool reads the PEM certificates in path. They may be TSA
+// certificates themselves or CAs that issue them.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCertPool(data)
+}
+
+// ParseCertPool parses PEM certificates into a pool.
+func ParseCertPool(data []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	n := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		pool.AddCert(cert)
+		n++
+	}
+	if n == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return pool, nil
+}
+
+// Verify checks the token's CMS signature and that the signer is a
+// time-stamping certificate chaining to roots, as of the token's genTime.
+// The signer's certificate is taken from the token, so the TSA must have
+// been asked to include it (NewRequest does), unless extra holds it.
+// It returns the signer's certificate.
+func (t *Token) Verify(roots *x509.CertPool, extra ...*x509.Certificate) (*x509.Certificate, error) {
+	var infos []signerInfo
+	if _, err := asn1.UnmarshalWithParams(t.signed.SignerInfos.FullBytes, &infos, "set"); err != nil {
+		return nil, fmt.Errorf("invalid SignerInfos: %w", err)
+	}
+	if len(infos) != 1 {
+		return nil, fmt.Errorf("%w: token has %d signers, want 1", ErrInvalidSignature, len(infos))
+	}
+	si := infos[0]
+
+	certs, err := x509.ParseCertificates(t.signed.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificates in token: %w", err)
+	}
+	certs = append(certs, extra...)
+	signer, err := findSigner(si.SID, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, ok := hashByOID(si.DigestAlgorithm.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported digest algorithm %v", ErrInvalidSignature, si.DigestAlgorithm.Algorithm)
+	}
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return nil, fmt.Errorf("%w: token has no signed attributes", ErrInvalidSignature)
+	}
+	// The signature covers the attributes encoded as a SET, not with the
+	// [0] tag they carry inside SignerInfo.
+	signedAttrs := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	if err := checkSignedAttrs(signedAttrs, hash, t.content, signer); err != nil {
+		return nil, err
+	}
+
+	alg, err := signatureAlgorithm(signer, hash, si.SignatureAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := signer.CheckSignature(alg, signedAttrs, si.Signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   t.Info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUntrustedSigner, err)
+	}
+	return signer, nil
+}
+
+// findSigner returns the certificate a SignerInfo's sid refers to.
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	switch {
+	case sid.Class == asn1.ClassUniversal && sid.Tag == asn1.TagSequence:
+		var ias issuerAndSerial
+		if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+			return nil, fmt.Errorf("invalid signer identifier: %w", err)
+		}
+		for _, c := range certs {
+			if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+				return c, nil
+			}
+		}
+	case sid.Class == asn1.ClassContextSpecific && sid.Tag == 0:
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c, nil
+			}
+		}
+	default:
+		return nil, errors.New("invalid signer identifier")
+	}
+	return nil, fmt.Errorf("%w: signer certificate not found", ErrUntrustedSigner)
+}
+
+// checkSignedAttrs checks that the signed attributes name TSTInfo as the
+// content type, carry its digest, and, when present, bind the signer's
+// certificate.
+func checkSignedAttrs(der []byte, hash crypto.Hash, content []byte, signer *x509.Certificate) error {
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(der, &attrs, "set"); err != nil {
+		return fmt.Errorf("invalid signed attributes: %w", err)
+	}
+
+	var contentType, digest bool
+	for _, a := range attrs {
+		switch {
+		case a.Type.Equal(oidAttrContentType):
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &oid); err != nil || !oid.Equal(oidTSTInfo) {
+				return fmt.Errorf("%w: content type is not TSTInfo", ErrInvalidSignature)
+			}
+			contentType = true
+		case a.Type.Equal(oidAttrMessageDigest):
+			var sum []byte
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &sum); err != nil {
+				return fmt.Errorf("invalid message digest: %w", err)
+			}
+			h := hash.New()
+			h.Write(content)
+			if !bytes.Equal(sum, h.Sum(nil)) {
+				return fmt.Errorf("%w: message digest does not match TSTInfo", ErrInvalidSignature)
+			}
+			digest = true
+		case a.Type.Equal(oidAttrSigningCert), a.Type.Equal(oidAttrSigningCertV2):
+			if err := checkSigningCert(a, signer); err != nil {
+				return err
+			}
+		}
+	}
+	if !contentType || !digest {
+		return fmt.Errorf("%w: content type or message digest attribute missing", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// checkSigningCert checks that the first certificate an ESS
+// signing-certificate attribute names is the signer's.
+func checkSigningCert(a attribute, signer *x509.Certificate) error {
+	var sc signingCertificate
+	if _, err := asn1.Unmarshal(a.Values.Bytes, &sc); err != nil || len(sc.Certs) == 0 {
+		return errors.New("invalid signing certificate attribute")
+	}
+	var id essCertID
+	if _, err := asn1.Unmarshal(sc.Certs[0].FullBytes, &id); err != nil {
+		return fmt.Errorf("invalid signing certificate attribute: %w", err)
+	}
+
+	var sum []byte
+	if a.Type.Equal(oidAttrSigningCert) {
+		s := sha1.Sum(signer.Raw)
+		sum = s[:]
+	} else {
+		hash := crypto.SHA256
+		if len(id.HashAlgorithm.Algorithm) > 0 {
+			var ok bool
+			if hash, ok = hashByOID(id.HashAlgorithm.Algorithm); !ok {
+				return fmt.Errorf("unsupported signing certificate hash %v", id.HashAlgorithm.Algorithm)
+			}
+		}
+		h := hash.New()
+		h.Write(signer.Raw)
+		sum = h.Sum(nil)
+	}
+	if !bytes.Equal(sum, id.CertHash) {
+		return fmt.Errorf("%w: signing certificate attribute names another certificate", ErrInvalidSignature)
+	}
+	return nil
+}
+
+func hashByOID(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// signatureAlgorithm maps the signer's key type and the SignerInfo digest
+// to the x509 algorithm that checks the signature.
+func signatureAlgorithm(signer *x509.Certificate, hash crypto.Hash, sigAlg asn1.ObjectIdentifier) (x509.SignatureAlgorithm, error) {
+	byHash := map[x509.PublicKeyAlgorithm]map[crypto.Hash]x509.SignatureAlgorithm{
+		x509.RSA: {
+			crypto.SHA256: x509.SHA256WithRSA,
+			crypto.SHA384: x509.SHA384WithRSA,
+			crypto.SHA512: x509.SHA512WithRSA,
+		},
+		x509.ECDSA: {
+			crypto.SHA256: x509.ECDSAWithSHA256,
+			crypto.SHA384: x509.ECDSAWithSHA384,
+			crypto.SHA512: x509.ECDSAWithSHA512,
+		},
+	}
+	if signer.PublicKeyAlgorithm == x509.RSA && sigAlg.Equal(oidRSAPSS) {
+		byHash[x509.RSA] = map[crypto.Hash]x509.SignatureAlgorithm{
+			crypto.SHA256: x509.SHA256WithRSAPSS,
+			crypto.SHA384: x509.SHA384WithRSAPSS,
+			crypto.SHA512: x509.SHA512WithRSAPSS,
+		}
+	}
+	if signer.PublicKeyAlgorithm == x509.Ed25519 {
+		return x509.PureEd25519, nil
+	}
+	if alg, ok := byHash[signer.PublicKeyAlgorithm][hash]; ok {
+		return alg, nil
+	}
+	return 0, fmt.Errorf("%w: unsupported signature algorithm %v", ErrInvalidSignature, sigAlg)
+}
@@ -0,0 +1,178 @@
+package tsa
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/galanafai/aroni-backend/internal/tsa/tsatest"
+)
+
+// vectorTokenHex is a token issued by `openssl ts -reply` for vectorDigest,
+// the SHA-256 of "aroni rfc3161 vector", by a TSA certificate issued by
+// vectorCA. It includes the TSA certificate and an ESS signingCertificateV2
+// attribute.
+const vectorTokenHex = "" +
+	"308208f306092a864886f70d010702a08208e4308208e0020103310f300d0609" +
+	"60864801650304020105003073060b2a864886f70d0109100104a06404623060" +
+	"02010106042a0304013031300d0609608648016503040201050004207a8bb128" +
+	"6f9cfc640b36464bf450007971307e5a3350525a8f82ab1d6031cb3002010518" +
+	"0f32303236313031383035343631385a300302010102090082cb62127ffc11e6" +
+	"a0820654308203263082020ea00302010202146cd546225b991869ecd0207429" +
+	"d6c20b874aa45f300d06092a864886f70d01010b05003011310f300d06035504" +
+	"030c06546573744341301e170d3236313031383035343432355a170d33363130" +
+	"31353035343432355a30123110300e06035504030c0754657374545341308201" +
+	"22300d06092a864886f70d01010105000382010f003082010a0282010100beb7" +
+	"708db3dd6c80985ace8604083e27c952c39726c0767b7b5633b0f19369f03ee2" +
+	"a43aa52be772cda845ad9b475b2e10905088aebaffde225c53161fdf081fb404" +
+	"60560063335b1c787ee633b6dda81e7bfc87a16d11641ddac3904876388ce794" +
+	"424ee9edf6718bb3802e584a5547acb765a8bf6a2f3bc3a02b0d22ee0192ad74" +
+	"aae095e2443ddb4dd04da9cada9be69bc98b4ba61fa2c9fb60f88803c051e6f9" +
+	"8cd60426df1a39cc88c4735bd4fcf20221a650d4ae574ebb9c3bc128b1107721" +
+	"83ad4163f52a088dab11d2116442bb61d657a9f1fa9b542c0a6acd05412c2384" +
+	"6e3bcf2ecbacbbdfa967b8943fb64bdbdd8e01f30486c8240c09186b02b10203" +
+	"010001a375307330090603551d130402300030160603551d250101ff040c300a" +
+	"06082b06010505070308300e0603551d0f0101ff040403020780301d0603551d" +
+	"0e041604141708a97326bdac04e8ac9c3219414b134d264a24301f0603551d23" +
+	"0418301680144e4ac0fcd71df17d94f401790d983a9c66c8827e300d06092a86" +
+	"4886f70d01010b050003820101000a5203a7a1dc19be7aedcc89be1df0ada45f" +
+	"eb8b7b78d9565ee02ff0cf4a5a66ef55304a93683ac62f8c08d0b75e7712a6b6" +
+	"40d589b85803d75fe8f20ff410dfc0fe5a55c4d4900eabb381b735017fdff5e5" +
+	"893c52f1e1f7ef213a88145d34f3b05bea8dab7fe47924b2a284d3b64d1ff081" +
+	"25c5f371727bb9e8180e370652dfb9cb228528b65d767b7fbeb4b3a88d3f8548" +
+	"5536d066d2058ea6b1ba5d40d8339910da8fb14328115bcbf48a1833d7fee789" +
+	"f2758e2d2a75595b20eb29547b72a721fa28f4c0228ab8ca127296c5c2d6501d" +
+	"25101beddbcefc835dba2de74a1f02710d14872849e37235d8e76c0c82f3ef19" +
+	"1f85f6e5aec25689d5436d44cc86308203263082020ea00302010202146cd546" +
+	"225b991869ecd0207429d6c20b874aa45f300d06092a864886f70d01010b0500" +
+	"3011310f300d06035504030c06546573744341301e170d323631303138303534" +
+	"3432355a170d3336313031353035343432355a30123110300e06035504030c07" +
+	"5465737454534130820122300d06092a864886f70d01010105000382010f0030" +
+	"82010a0282010100beb7708db3dd6c80985ace8604083e27c952c39726c0767b" +
+	"7b5633b0f19369f03ee2a43aa52be772cda845ad9b475b2e10905088aebaffde" +
+	"225c53161fdf081fb40460560063335b1c787ee633b6dda81e7bfc87a16d1164" +
+	"1ddac3904876388ce794424ee9edf6718bb3802e584a5547acb765a8bf6a2f3b" +
+	"c3a02b0d22ee0192ad74aae095e2443ddb4dd04da9cada9be69bc98b4ba61fa2" +
+	"c9fb60f88803c051e6f98cd60426df1a39cc88c4735bd4fcf20221a650d4ae57" +
+	"4ebb9c3bc128b110772183ad4163f52a088dab11d2116442bb61d657a9f1fa9b" +
+	"542c0a6acd05412c23846e3bcf2ecbacbbdfa967b8943fb64bdbdd8e01f30486" +
+	"c8240c09186b02b10203010001a375307330090603551d130402300030160603" +
+	"551d250101ff040c300a06082b06010505070308300e0603551d0f0101ff0404" +
+	"03020780301d0603551d0e041604141708a97326bdac04e8ac9c3219414b134d" +
+	"264a24301f0603551d230418301680144e4ac0fcd71df17d94f401790d983a9c" +
+	"66c8827e300d06092a864886f70d01010b050003820101000a5203a7a1dc19be" +
+	"7aedcc89be1df0ada45feb8b7b78d9565ee02ff0cf4a5a66ef55304a93683ac6" +
+	"2f8c08d0b75e7712a6b640d589b85803d75fe8f20ff410dfc0fe5a55c4d4900e" +
+	"abb381b735017fdff5e5893c52f1e1f7ef213a88145d34f3b05bea8dab7fe479" +
+	"24b2a284d3b64d1ff08125c5f371727bb9e8180e370652dfb9cb228528b65d76" +
+	"7b7fbeb4b3a88d3f85485536d066d2058ea6b1ba5d40d8339910da8fb1432811" +
+	"5bcbf48a1833d7fee789f2758e2d2a75595b20eb29547b72a721fa28f4c0228a" +
+	"b8ca127296c5c2d6501d25101beddbcefc835dba2de74a1f02710d14872849e3" +
+	"7235d8e76c0c82f3ef191f85f6e5aec25689d5436d44cc86318201fb308201f7" +
+	"02010130293011310f300d06035504030c0654657374434102146cd546225b99" +
+	"1869ecd0207429d6c20b874aa45f300d06096086480165030402010500a081a4" +
+	"301a06092a864886f70d010903310d060b2a864886f70d0109100104301c0609" +
+	"2a864886f70d010905310f170d3236313031383035343631385a302f06092a86" +
+	"4886f70d01090431220420ba13ba9c08e45b7ee6481942d0803537a0edb621ab" +
+	"63bcb747823ba03658948c3037060b2a864886f70d010910022f312830263024" +
+	"30220420c98330c4f93b6729f768087a4868ab4bc2368d28d30fc320996d2929" +
+	"ffa5c267300d06092a864886f70d010101050004820100129f7697d7ff84791d" +
+	"b2b1e3a9c17d4ec8859cfac3909a6dddd93ff25161865c84910fbf738ea9cb38" +
+	"c2999f25af9dcc7bd4e7cb93a7ba0f513bfe62bc76c8c24e4f440d54f0ae4745" +
+	"5fe5c13dba92860641f53280861640b2949176c867c25e3c35dbb36a3a8d5d6f" +
+	"a4856f06ebbf19a03c1873592c88cf47d2792d3bf0abeb4ea2c5e38ffd52532f" +
+	"ffb2a37f32f7c10b300ffcd3c17115da5ed0dafa5f224b400a84f08e04aed2f7" +
+	"5ee5b04620f66c3f05f6aae0e0aead041ec266f9f070b3f6e708718bda0ed608" +
+	"1cb1f1469b56172140c580dbd3356f29c913d2b4609a7e7bb4f48f815013035c" +
+	"aaf807da9eec7a42f077bd8683e5910c18b3631bda321d"
+
+const vectorDigest = "7a8bb1286f9cfc640b36464bf450007971307e5a3350525a8f82ab1d6031cb30"
+
+const vectorCA = `-----BEGIN CERTIFICATE-----
+MIIDAzCCAeugAwIBAgIUd2nv0z8hiEK3netHOVOVsCOZ8IEwDQYJKoZIhvcNAQEL
+BQAwETEPMA0GA1UEAwwGVGVzdENBMB4XDTI2MTAxODA1NDQyNVoXDTM2MTAxNTA1
+NDQyNVowETEPMA0GA1UEAwwGVGVzdENBMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A
+MIIBCgKCAQEAmPSKyJnSv3OIiC0rNV8Q/or+h8ELkgzJpJNr3clxecZSXEU95zp+
+/AjZaZs+wW86Yz1M9312Pjjf1jpyeczv5Hp8CVgMmemMRqbONI83BOWMlslf3bo/
+4EmcRK4SNs9tP16Qib20yXwZYQ5ELj4hlX4p+KhCXzuFc5XjBzxcEXDQX4Hpvqp/
+CdgutVVF5aptZxpna+KBYqhpmvZ2pAa3VlC910d4MBmd7F5yB9Hs9sZw4puyAhwf
+v2MHeZAygUvaTukiz5vvNIZAcuPgKCyV1baKmJmazLkyySnTyrHmcf8inzwSzIg9
+6/Oj4xkIpdCk838CZLS432vpm7wDAin0iwIDAQABo1MwUTAdBgNVHQ4EFgQUTkrA
+/Ncd8X2U9AF5DZg6nGbIgn4wHwYDVR0jBBgwFoAUTkrA/Ncd8X2U9AF5DZg6nGbI
+gn4wDwYDVR0TAQH/BAUwAwEB/zANBgkqhkiG9w0BAQsFAAOCAQEAgWtl6AkpARN6
+65W2EmE0v871RQgMI1Q3BhsfPQT1lL4Sg/H0R7fVpcJDKTTVdv/E4BIkxKiD6Ner
+jVdaEgqItDQZwj1tDfYb9d6Muiy/SeCvJ/IagB/CESAleBC8C5sIPfq3XvsknuEo
+zisXLeNkCBeGhSuZAuuunpq9CQt0BStkXKbD6jIPhV7XtWTWXK24YnzOzHvrKqMR
+mTZoj0Z0H4aqghYmWS4zDd3fV/lhg1/OpVRwkxXIVZjk+X6UdYiq3O58y4OaoRrg
+0+KpmVqbPQ7lvMg0GxqRy4jBEDHZNTpUvb4CaOnWo9PK4J1r+xV2GWeNH4vaJr9h
+/zaXuQPOcg==
+-----END CERTIFICATE-----
+`
+
+// vectorToken decodes the reference token and its digest and trusts vectorCA.
+func vectorToken(t *testing.T) (*Token, []byte, *x509.CertPool) {
+	t.Helper()
+	raw, err := hex.DecodeString(vectorTokenHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := hex.DecodeString(vectorDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, err := ParseCertPool([]byte(vectorCA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ParseToken(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, digest, roots
+}
+
+func TestReferenceToken(t *testing.T) {
+	token, digest, roots := vectorToken(t)
+	if !token.Covers(digest) {
+		t.Error("token does not cover its digest")
+	}
+	if _, err := token.Verify(roots); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTamperedToken(t *testing.T) {
+	token, _, roots := vectorToken(t)
+	token.content = append([]byte{}, token.content...)
+	token.content[len(token.content)-1] ^= 1
+	if _, err := token.Verify(roots); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered token gave %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestStubTokenUnderAnotherCA(t *testing.T) {
+	stub, err := tsatest.NewStub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("batch root"))
+	query, err := NewRequest(digest[:], big.NewInt(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := stub.Respond(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ParseResponse(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, roots := vectorToken(t)
+	if _, err := token.Verify(roots); !errors.Is(err, ErrUntrustedSigner) {
+		t.Errorf("stub token under another CA gave %v, want %v", err, ErrUntrustedSigner)
+	}
+}
@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/google/uuid"
+)
+
+// Dispatcher queues a delivery per subscription for every published event
+// and sends them. A delivery the receiver does not answer with a 2xx status
+// is queued again after RetryDelay, doubling with every attempt up to
+// MaxRetryDelay, until it has used its MaxAttempts. Every attempt is kept in
+// the store as the delivery log.
+//
+// Deliveries are claimed through the store with a Lease, so several
+// instances can run dispatchers against one store, and a delivery whose
+// dispatcher died is sent again once its lease runs out.
+type Dispatcher struct {
+	Store  db.Store
+	Client *http.Client
+	// Poll is how often the store is checked for deliveries queued
+	// elsewhere or due for a retry; Wake checks it straight away.
+	Poll          time.Duration
+	Lease         time.Duration
+	MaxAttempts   int
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+
+	once sync.Once
+	wake chan struct{}
+}
+
+// Publish queues event t with data for every subscription to t and wakes
+// the dispatcher.
+func (d *Dispatcher) Publish(ctx context.Context, t EventType, data any) error {
+	hooks, err := d.Store.FetchWebhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch webhooks: %w", err)
+	}
+	var subscribed []db.Webhook
+	for _, hook := range hooks {
+		if subscribes(hook, t) {
+			subscribed = append(subscribed, hook)
+		}
+	}
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s data: %w", t, err)
+	}
+	payload, err := json.Marshal(Event{ID: uuid.NewString(), Type: t, CreatedAt: time.Now().UTC(), Data: raw})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", t, err)
+	}
+	for _, hook := range subscribed {
+		delivery := &db.WebhookDelivery{WebhookID: hook.ID, Event: string(t), Payload: payload, MaxAttempts: d.MaxAttempts}
+		if err := d.Store.CreateWebhookDelivery(ctx, delivery); err != nil {
+			return fmt.Errorf("failed to queue %s delivery to webhook %s: %w", t, hook.ID, err)
+		}
+	}
+	d.Wake()
+	return nil
+}
+
+// Replay queues the payload of an earlier delivery to be sent again to the
+// same subscription, as a new delivery with a fresh set of attempts. It
+// returns nil if there is no such delivery.
+func (d *Dispatcher) Replay(ctx context.Context, deliveryID string) (*db.WebhookDelivery, error) {
+	orig, err := d.Store.FetchWebhookDelivery(ctx, deliveryID)
+	if err != nil || orig == nil {
+		return nil, err
+	}
+	delivery := &db.WebhookDelivery{
+		WebhookID:   orig.WebhookID,
+		Event:       orig.Event,
+		Payload:     orig.Payload,
+		MaxAttempts: d.MaxAttempts,
+		ReplayOf:    orig.ID,
+	}
+	if err := d.Store.CreateWebhookDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	d.Wake()
+	return delivery, nil
+}
+
+// Wake makes a running dispatcher check for deliveries without waiting for
+// Poll.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wakeC() <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) wakeC() chan struct{} {
+	d.once.Do(func() { d.wake = make(chan struct{}, 1) })
+	return d.wake
+}
+
+// Run sends deliveries as they become due until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		for ctx.Err() == nil {
+			delivery, err := d.Store.ClaimWebhookDelivery(ctx, d.Lease)
+			if err != nil {
+				log.Printf("❌ Failed to claim webhook delivery: %v", err)
+				break
+			}
+			if delivery == nil {
+				break
+			}
+			d.Process(ctx, delivery)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wakeC():
+		case <-time.After(d.Poll):
+		}
+	}
+}
+
+// Process makes one attempt at a claimed delivery and records the outcome.
+func (d *Dispatcher) Process(ctx context.Context, delivery *db.WebhookDelivery) {
+	err := d.attempt(ctx, delivery)
+	switch {
+	case err == nil:
+		delivery.Status = db.DeliveryDelivered
+		delivery.Error = ""
+		delivery.DeliveredAt = time.Now().UTC().Format(time.RFC3339)
+		log.Printf("📨 Webhook delivery %s (%s) delivered", delivery.ID, delivery.Event)
+	case delivery.Attempts >= delivery.MaxAttempts:
+		delivery.Status = db.DeliveryFailed
+		delivery.Error = err.Error()
+		log.Printf("❌ Webhook delivery %s failed after %d attempts: %v", delivery.ID, delivery.Attempts, err)
+	default:
+		delay := d.retryDelay(delivery.Attempts)
+		delivery.Status = db.DeliveryQueued
+		delivery.Error = err.Error()
+		delivery.RunAfter = time.Now().UTC().Add(delay).Format(time.RFC3339)
+		log.Printf("⚠️ Webhook delivery %s attempt %d failed, retrying in %s: %v", delivery.ID, delivery.Attempts, delay, err)
+		time.AfterFunc(delay, d.Wake)
+	}
+	if err := d.Store.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		log.Printf("❌ Failed to record webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// attempt POSTs the delivery's payload to its subscription, recording the
+// response status.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *db.WebhookDelivery) error {
+	delivery.ResponseStatus = 0
+	hook, err := d.Store.FetchWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch webhook: %w", err)
+	}
+	if hook == nil {
+		return fmt.Errorf("webhook %s no longer exists", delivery.WebhookID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "aroni-webhooks/1")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	delivery.ResponseStatus = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("receiver answered %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (d *Dispatcher) client() *http.Client {
+	if d.Client != nil {
+		return d.Client
+	}
+	return http.DefaultClient
+}
+
+// retryDelay is the wait before the attempt after the given one.
+func (d *Dispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.RetryDelay
+	for i := 1; i < attempts && delay < d.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, d.MaxRetryDelay)
+}
+
+func subscribes(hook db.Webhook, t EventType) bool {
+	for _, e := range hook.Events {
+		if e == string(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+)
+
+const testSecret = "whsec_test"
+
+// receiver is a local webhook endpoint that checks signatures and answers
+// each request with the next of its statuses, repeating the last one.
+type receiver struct {
+	t        *testing.T
+	statuses []int
+
+	mu     sync.Mutex
+	events []Event
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	t.Helper()
+	r := &receiver{t: t, statuses: statuses}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		r.t.Error(err)
+		return
+	}
+	if err := Verify(testSecret, req.Header.Get(SignatureHeader), body, time.Minute, time.Now()); err != nil {
+		r.t.Errorf("delivery %s: %v", req.Header.Get(DeliveryHeader), err)
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		r.t.Error(err)
+	}
+	if got := req.Header.Get(EventHeader); got != string(event.Type) {
+		r.t.Errorf("%s header is %q, body has %q", EventHeader, got, event.Type)
+	}
+
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	status := r.statuses[min(len(r.events), len(r.statuses))-1]
+	r.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func (r *receiver) received() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event{}, r.events...)
+}
+
+// subscribe returns a dispatcher over a fresh store with one subscription
+// to url for events.
+func subscribe(t *testing.T, url string, events ...EventType) (*Dispatcher, *db.MemoryStore) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	hook := &db.Webhook{URL: url, Secret: testSecret}
+	for _, e := range events {
+		hook.Events = append(hook.Events, string(e))
+	}
+	if err := store.CreateWebhook(context.Background(), hook); err != nil {
+		t.Fatal(err)
+	}
+	return &Dispatcher{Store: store, Lease: time.Minute, MaxAttempts: 3, RetryDelay: time.Millisecond, MaxRetryDelay: time.Millisecond}, store
+}
+
+// drain processes deliveries until none is due.
+func drain(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		delivery, err := d.Store.ClaimWebhookDelivery(ctx, d.Lease)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivery == nil {
+			return
+		}
+		d.Process(ctx, delivery)
+	}
+	t.Fatal("deliveries never ran out")
+}
+
+func deliveries(t *testing.T, store db.Store) []db.WebhookDelivery {
+	t.Helper()
+	out, err := store.FetchWebhookDeliveries(context.Background(), db.DeliveryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestDeliver(t *testing.T) {
+	recv, srv := newReceiver(t, http.StatusNoContent)
+	d, store := subscribe(t, srv.URL, ScanCreated)
+	ctx := context.Background()
+
+	if err := d.Publish(ctx, ScanCreated, map[string]string{"tracking_id": "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Publish(ctx, BatchAnchored, map[string]string{"id": "b1"}); err != nil {
+		t.Fatal(err)
+	}
+	drain(t, d)
+
+	got := deliveries(t, store)
+	if len(got) != 1 {
+		t.Fatalf("%d deliveries, want 1 for the one subscribed event", len(got))
+	}
+	if got[0].Status != db.DeliveryDelivered || got[0].Attempts != 1 || got[0].ResponseStatus != http.StatusNoContent {
+		t.Errorf("delivery is %s after %d attempts with %d", got[0].Status, got[0].Attempts, got[0].ResponseStatus)
+	}
+	events := recv.received()
+	if len(events) != 1 || events[0].Type != ScanCreated || string(events[0].Data) != `{"tracking_id":"t1"}` {
+		t.Errorf("receiver got %+v", events)
+	}
+}
+
+func TestRetryUntilMaxAttempts(t *testing.T) {
+	recv, srv := newReceiver(t, http.StatusServiceUnavailable)
+	d, store := subscribe(t, srv.URL, ScanCreated)
+
+	if err := d.Publish(context.Background(), ScanCreated, "scan"); err != nil {
+		t.Fatal(err)
+	}
+	drain(t, d)
+
+	got := deliveries(t, store)
+	if len(got) != 1 || got[0].Status != db.DeliveryFailed || got[0].Attempts != d.MaxAttempts {
+		t.Fatalf("deliveries are %+v, want one failed after %d attempts", got, d.MaxAttempts)
+	}
+	if got[0].ResponseStatus != http.StatusServiceUnavailable || got[0].Error == "" {
+		t.Errorf("last attempt recorded %d %q", got[0].ResponseStatus, got[0].Error)
+	}
+	if n := len(recv.received()); n != d.MaxAttempts {
+		t.Errorf("receiver got %d requests, want %d", n, d.MaxAttempts)
+	}
+}
+
+func TestRetryThenDeliver(t *testing.T) {
+	recv, srv := newReceiver(t, http.StatusInternalServerError, http.StatusOK)
+	d, store := subscribe(t, srv.URL, ScanCreated)
+
+	if err := d.Publish(context.Background(), ScanCreated, "scan"); err != nil {
+		t.Fatal(err)
+	}
+	drain(t, d)
+
+	got := deliveries(t, store)
+	if len(got) != 1 || got[0].Status != db.DeliveryDelivered || got[0].Attempts != 2 || got[0].Error != "" {
+		t.Fatalf("deliveries are %+v, want one delivered on the second attempt", got)
+	}
+	if events := recv.received(); len(events) != 2 || events[0].ID != events[1].ID {
+		t.Errorf("receiver got %+v, want the same event twice", events)
+	}
+}
+
+func TestRetryWaitsForBackoff(t *testing.T) {
+	_, srv := newReceiver(t, http.StatusServiceUnavailable)
+	d, store := subscribe(t, srv.URL, ScanCreated)
+	d.RetryDelay, d.MaxRetryDelay = time.Hour, time.Hour
+
+	if err := d.Publish(context.Background(), ScanCreated, "scan"); err != nil {
+		t.Fatal(err)
+	}
+	drain(t, d)
+
+	got := deliveries(t, store)
+	if len(got) != 1 || got[0].Status != db.DeliveryQueued || got[0].Attempts != 1 {
+		t.Fatalf("deliveries are %+v, want one queued after 1 attempt", got)
+	}
+	runAfter, err := time.Parse(time.RFC3339, got[0].RunAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait := time.Until(runAfter); wait < 59*time.Minute {
+		t.Errorf("retry is due in %s, want about an hour", wait)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	d := &Dispatcher{RetryDelay: 10 * time.Second, MaxRetryDelay: time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{20, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := d.retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	recv, srv := newReceiver(t, http.StatusNoContent)
+	d, store := subscribe(t, srv.URL, ScanMismatch)
+	ctx := context.Background()
+
+	if err := d.Publish(ctx, ScanMismatch, "scan"); err != nil {
+		t.Fatal(err)
+	}
+	drain(t, d)
+	orig := deliveries(t, store)[0]
+
+	replay, err := d.Replay(ctx, orig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.ID == "" || replay.ID == orig.ID || replay.ReplayOf != orig.ID || string(replay.Payload) != string(orig.Payload) {
+		t.Fatalf("replay is %+v, want a new delivery of %s", replay, orig.ID)
+	}
+	drain(t, d)
+
+	got, err := store.FetchWebhookDelivery(ctx, replay.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != db.DeliveryDelivered || got.Attempts != 1 {
+		t.Errorf("replay is %s after %d attempts", got.Status, got.Attempts)
+	}
+	if events := recv.received(); len(events) != 2 || events[0].ID != events[1].ID {
+		t.Errorf("receiver got %+v, want the same event twice", events)
+	}
+
+	if missing, err := d.Replay(ctx, "00000000-0000-0000-0000-000000000000"); missing != nil || err != nil {
+		t.Errorf("replaying an unknown delivery gave %+v, %v", missing, err)
+	}
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"log"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/models"
+)
+
+// Notifier is a db.Store that publishes events for the writes they
+// describe, so every path that logs a scan or moves a batch's anchor status
+// (the scan handler, the outbox, the anchor worker, scheduler and upgrader)
+// is covered. Failing to publish is logged and does not fail the write.
+type Notifier struct {
+	db.Store
+	Dispatcher *Dispatcher
+}
+
+var _ db.Store = (*Notifier)(nil)
+
+// PostScanLog stores the scan and publishes scan.created, and scan.mismatch
+// for minor and critical mismatches.
+func (n *Notifier) PostScanLog(ctx context.Context, scan *models.ScanLog) error {
+	if err := n.Store.PostScanLog(ctx, scan); err != nil {
+		return err
+	}
+	n.publish(ctx, ScanCreated, scan)
+	if scan.Result.IsMismatch() {
+		n.publish(ctx, ScanMismatch, scan)
+	}
+	return nil
+}
+
+// SetBatchAnchorStatus stores the status and publishes batch.anchored when
+// the batch first reaches submitted or beyond, and batch.confirmed when it
+// first reaches confirmed or verified. A batch anchored straight to a
+// confirmed status gets both.
+func (n *Notifier) SetBatchAnchorStatus(ctx context.Context, batchID string, status string) error {
+	before := db.AnchorPending
+	if batch, err := n.Store.FetchBatch(ctx, batchID); err != nil {
+		log.Printf("⚠️ Failed to fetch batch %s before its status change: %v", batchID, err)
+	} else if batch != nil {
+		before = batch.AnchorStatus
+	}
+	if err := n.Store.SetBatchAnchorStatus(ctx, batchID, status); err != nil {
+		return err
+	}
+
+	anchored := !anchoredStatus(before) && anchoredStatus(status)
+	confirmed := !confirmedStatus(before) && confirmedStatus(status)
+	if !anchored && !confirmed {
+		return nil
+	}
+	batch, err := n.Store.FetchBatch(ctx, batchID)
+	if err != nil || batch == nil {
+		log.Printf("⚠️ Failed to fetch batch %s for webhooks: %v", batchID, err)
+		return nil
+	}
+	if anchored {
+		n.publish(ctx, BatchAnchored, batch)
+	}
+	if confirmed {
+		n.publish(ctx, BatchConfirmed, batch)
+	}
+	return nil
+}
+
+func (n *Notifier) publish(ctx context.Context, t EventType, data any) {
+	if err := n.Dispatcher.Publish(ctx, t, data); err != nil {
+		log.Printf("❌ Failed to publish %s: %v", t, err)
+	}
+}
+
+func anchoredStatus(status string) bool {
+	return status == db.AnchorSubmitted || confirmedStatus(status)
+}
+
+func confirmedStatus(status string) bool {
+	return status == db.AnchorConfirmed || status == db.AnchorVerified
+}
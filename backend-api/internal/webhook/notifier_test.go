@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/galanafai/aroni-backend/internal/db"
+	"github.com/galanafai/aroni-backend/internal/models"
+)
+
+// published counts the deliveries queued for each event type.
+func published(t *testing.T, store db.Store) map[EventType]int {
+	t.Helper()
+	counts := map[EventType]int{}
+	for _, d := range deliveries(t, store) {
+		counts[EventType(d.Event)]++
+	}
+	return counts
+}
+
+func TestNotifierScanEvents(t *testing.T) {
+	d, store := subscribe(t, "http://receiver.invalid", ScanCreated, ScanMismatch)
+	n := &Notifier{Store: store, Dispatcher: d}
+	ctx := context.Background()
+
+	for _, result := range []models.ScanResult{models.ResultMatch, models.ResultMinorMismatch} {
+		if err := n.PostScanLog(ctx, &models.ScanLog{TrackingID: "t1", Result: result}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := published(t, store)
+	if got[ScanCreated] != 2 || got[ScanMismatch] != 1 {
+		t.Errorf("published %v, want 2 scan.created and 1 scan.mismatch", got)
+	}
+}
+
+func TestNotifierBatchEvents(t *testing.T) {
+	d, store := subscribe(t, "http://receiver.invalid", BatchAnchored, BatchConfirmed)
+	n := &Notifier{Store: store, Dispatcher: d}
+	ctx := context.Background()
+
+	newBatch := func() string {
+		batch := &db.Batch{RootHash: "00", AnchorStatus: db.AnchorPending}
+		if err := store.SaveBatch(ctx, batch, nil); err != nil {
+			t.Fatal(err)
+		}
+		return batch.ID
+	}
+	a, b := newBatch(), newBatch()
+
+	steps := []struct {
+		batch  string
+		status string
+		want   map[EventType]int
+	}{
+		{a, db.AnchorPending, map[EventType]int{}},
+		{a, db.AnchorSubmitted, map[EventType]int{BatchAnchored: 1}},
+		{a, db.AnchorSubmitted, map[EventType]int{BatchAnchored: 1}},
+		{a, db.AnchorConfirmed, map[EventType]int{BatchAnchored: 1, BatchConfirmed: 1}},
+		{a, db.AnchorVerified, map[EventType]int{BatchAnchored: 1, BatchConfirmed: 1}},
+		// Straight to confirmed publishes both.
+		{b, db.AnchorConfirmed, map[EventType]int{BatchAnchored: 2, BatchConfirmed: 2}},
+		{b, db.AnchorSubmitted, map[EventType]int{BatchAnchored: 2, BatchConfirmed: 2}},
+	}
+	for i, step := range steps {
+		if err := n.SetBatchAnchorStatus(ctx, step.batch, step.status); err != nil {
+			t.Fatal(err)
+		}
+		got := published(t, store)
+		if got[BatchAnchored] != step.want[BatchAnchored] || got[BatchConfirmed] != step.want[BatchConfirmed] {
+			t.Errorf("step %d (%s): published %v, want %v", i, step.status, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateTarget is returned for webhook URLs that reach loopback,
+// link-local or private addresses, which would let anyone who can subscribe
+// a URL make the server send scan data into its own network.
+var ErrPrivateTarget = errors.New("webhook URL must not point at a loopback, link-local or private address")
+
+// CheckURL checks that raw is an absolute http or https URL whose host
+// resolves only to public addresses.
+func CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook URL scheme must be http or https, not %q", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return errors.New("webhook URL has no host")
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host %q: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateTarget, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// PublicDialer returns a dialer that refuses to connect to anything but
+// public addresses, so a host that resolves differently after CheckURL, or a
+// redirect, cannot reach the local network either.
+func PublicDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateTarget, host)
+			}
+			return nil
+		},
+	}
+}
+
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		private bool
+		ok      bool
+	}{
+		{url: "https://93.184.216.34/hook", ok: true},
+		{url: "http://[2606:4700::1111]:8080/hook", ok: true},
+		{url: "http://127.0.0.1:8095/hook", private: true},
+		{url: "http://[::1]/hook", private: true},
+		{url: "http://10.1.2.3/hook", private: true},
+		{url: "http://192.168.0.10/hook", private: true},
+		{url: "http://172.16.0.1/hook", private: true},
+		{url: "http://169.254.169.254/latest/meta-data", private: true},
+		{url: "http://[fe80::1]/hook", private: true},
+		{url: "http://0.0.0.0/hook", private: true},
+		{url: "ftp://93.184.216.34/hook"},
+		{url: "http:///hook"},
+	}
+	for _, tt := range tests {
+		err := CheckURL(context.Background(), tt.url)
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("%s: %v", tt.url, err)
+		case !tt.ok && err == nil:
+			t.Errorf("%s was accepted", tt.url)
+		case tt.private && !errors.Is(err, ErrPrivateTarget):
+			t.Errorf("%s gave %v, want %v", tt.url, err, ErrPrivateTarget)
+		}
+	}
+}
+
+func TestPublicDialer(t *testing.T) {
+	_, srv := newReceiver(t, http.StatusNoContent)
+	dialer := PublicDialer(0)
+	conn, err := dialer.DialContext(context.Background(), "tcp", srv.Listener.Addr().String())
+	if err == nil {
+		conn.Close()
+	}
+	if !errors.Is(err, ErrPrivateTarget) {
+		t.Errorf("dialing %s gave %v, want %v", srv.Listener.Addr(), err, ErrPrivateTarget)
+	}
+}
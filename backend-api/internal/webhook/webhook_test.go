@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	const secret = "whsec_test"
+	now := time.Unix(1760000000, 0)
+	body := []byte(`{"id":"1","type":"scan.created"}`)
+	header := Sign(secret, now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		header    string
+		body      []byte
+		tolerance time.Duration
+		now       time.Time
+		want      error
+		wantText  string
+	}{
+		{name: "valid", secret: secret, header: header, body: body, tolerance: 5 * time.Minute, now: now},
+		{name: "rotated secret", secret: secret, header: header + ",v1=" + strings.Repeat("00", 32), body: body, tolerance: 5 * time.Minute, now: now},
+		{name: "changed body", secret: secret, header: header, body: []byte(`{"id":"2","type":"scan.created"}`), tolerance: 5 * time.Minute, now: now, want: ErrInvalidSignature},
+		{name: "other secret", secret: "whsec_other", header: header, body: body, tolerance: 5 * time.Minute, now: now, want: ErrInvalidSignature},
+		{name: "too old", secret: secret, header: header, body: body, tolerance: 5 * time.Minute, now: now.Add(6 * time.Minute), wantText: "off"},
+		{name: "from the future", secret: secret, header: header, body: body, tolerance: 5 * time.Minute, now: now.Add(-6 * time.Minute), wantText: "off"},
+		{name: "any age", secret: secret, header: header, body: body, now: now.Add(24 * time.Hour)},
+		{name: "no signature", secret: secret, header: "t=1760000000", body: body, now: now, wantText: "no v1 signature"},
+		{name: "no timestamp", secret: secret, header: "v1=00", body: body, now: now, wantText: "invalid signature timestamp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, tt.tolerance, tt.now)
+			switch {
+			case tt.want != nil:
+				if !errors.Is(err, tt.want) {
+					t.Errorf("got %v, want %v", err, tt.want)
+				}
+			case tt.wantText != "":
+				if err == nil || errors.Is(err, ErrInvalidSignature) || !strings.Contains(err.Error(), tt.wantText) {
+					t.Errorf("got %v, want an error mentioning %q", err, tt.wantText)
+				}
+			case err != nil:
+				t.Errorf("got %v, want nil", err)
+			}
+		})
+	}
+}
@@ -1,5 +1,16 @@
 import React, { useEffect, useState } from 'react';
 
+type MismatchReason = {
+  field: string;
+  axis?: number;
+  expected: number;
+  observed: number;
+  delta: number;
+  tolerance: string;
+  allowed: number;
+  severity: 'warning' | 'minor' | 'critical';
+};
+
 type ScanLog = {
   id: string;
   tracking_id: string;
@@ -8,60 +19,88 @@ type ScanLog = {
   scanned_quantity: number;
   scanned_weight_kg: number;
   scanned_dimensions: number[];
-  result: 'match' | 'mismatch';
+  result: string;
   scan_hash: string | null;
+  reasons: MismatchReason[] | null;
   notes: string;
 };
 
+const PAGE_SIZE = 50;
+
+const RESULTS = ['match', 'warning', 'minor_mismatch', 'critical_mismatch', 'unknown_package', 'mismatch'];
+
+const RESULT_STYLES: Record<string, string> = {
+  match: 'bg-green-100 text-green-700',
+  warning: 'bg-yellow-100 text-yellow-700',
+  minor_mismatch: 'bg-orange-100 text-orange-700',
+  unknown_package: 'bg-gray-100 text-gray-700',
+};
+
+const REASON_FIELDS = ['quantity', 'weight_kg', 'dimensions_cm', 'volume_cm3'];
+
 const Dashboard: React.FC = () => {
   const [scans, setScans] = useState<ScanLog[]>([]);
-  const [filtered, setFiltered] = useState<ScanLog[]>([]);
-  const [filter, setFilter] = useState<'all' | 'match' | 'mismatch'>('all');
+  const [total, setTotal] = useState(0);
+  const [cursor, setCursor] = useState<string | null>(null);
+  const [filter, setFilter] = useState('all');
+  const [field, setField] = useState('');
   const [selected, setSelected] = useState<ScanLog | null>(null);
   const [loading, setLoading] = useState(true);
 
-  useEffect(() => {
-    const fetchScans = async () => {
-      try {
-        const res = await fetch('http://localhost:8080/api/scans');
-        const data = await res.json();
-        setScans(data.data || []);
-      } catch (err) {
-        console.error('Failed to fetch scan logs:', err);
-      } finally {
-        setLoading(false);
-      }
-    };
-
-    fetchScans();
-  }, []);
+  const fetchScans = async (after: string | null) => {
+    const params = new URLSearchParams({ limit: String(PAGE_SIZE) });
+    if (filter !== 'all') params.set('result', filter);
+    if (field) params.set('field', field);
+    if (after) params.set('cursor', after);
+    try {
+      const res = await fetch(`http://localhost:8080/api/scans?${params}`);
+      const data = await res.json();
+      setScans(prev => (after ? [...prev, ...(data.data || [])] : data.data || []));
+      setTotal(data.total || 0);
+      setCursor(data.next_cursor || null);
+    } catch (err) {
+      console.error('Failed to fetch scan logs:', err);
+    } finally {
+      setLoading(false);
+    }
+  };
 
   useEffect(() => {
-    if (filter === 'all') {
-      setFiltered(scans);
-    } else {
-      setFiltered(scans.filter(s => s.result === filter));
-    }
-  }, [filter, scans]);
+    setLoading(true);
+    fetchScans(null);
+  }, [filter, field]);
 
   return (
     <div className="p-6 max-w-7xl mx-auto">
       <div className="flex justify-between items-center mb-4">
         <h1 className="text-2xl font-bold">📦 Aroni Scan Log Dashboard</h1>
-        <select
-          value={filter}
-          onChange={(e) => setFilter(e.target.value as 'all' | 'match' | 'mismatch')}
-          className="border px-2 py-1 text-sm"
-        >
-          <option value="all">All</option>
-          <option value="match">Matches</option>
-          <option value="mismatch">Mismatches</option>
-        </select>
+        <div className="flex gap-2">
+          <select
+            value={field}
+            onChange={(e) => setField(e.target.value)}
+            className="border px-2 py-1 text-sm"
+          >
+            <option value="">Any field</option>
+            {REASON_FIELDS.map((f) => (
+              <option key={f} value={f}>{f}</option>
+            ))}
+          </select>
+          <select
+            value={filter}
+            onChange={(e) => setFilter(e.target.value)}
+            className="border px-2 py-1 text-sm"
+          >
+            <option value="all">All results</option>
+            {RESULTS.map((r) => (
+              <option key={r} value={r}>{r.replace('_', ' ')}</option>
+            ))}
+          </select>
+        </div>
       </div>
 
       {loading ? (
         <p>Loading scan logs...</p>
-      ) : filtered.length === 0 ? (
+      ) : scans.length === 0 ? (
         <p>No scans found.</p>
       ) : (
         <div className="overflow-auto rounded border shadow-sm">
@@ -79,17 +118,15 @@ const Dashboard: React.FC = () => {
               </tr>
             </thead>
             <tbody>
-              {filtered.map((scan) => (
+              {scans.map((scan) => (
                 <tr key={scan.id} className="border-t hover:bg-gray-50">
                   <td className="p-2">
                     <span
                       className={`px-2 py-1 text-xs rounded-full font-medium ${
-                        scan.result === 'match'
-                          ? 'bg-green-100 text-green-700'
-                          : 'bg-red-100 text-red-700'
+                        RESULT_STYLES[scan.result] || 'bg-red-100 text-red-700'
                       }`}
                     >
-                      {scan.result.toUpperCase()}
+                      {scan.result.replace('_', ' ').toUpperCase()}
                     </span>
                   </td>
                   <td
@@ -116,6 +153,14 @@ const Dashboard: React.FC = () => {
               ))}
             </tbody>
           </table>
+          <div className="flex justify-between items-center p-2 text-xs text-gray-500">
+            <span>Showing {scans.length} of {total}</span>
+            {cursor && (
+              <button onClick={() => fetchScans(cursor)} className="text-blue-600 hover:underline">
+                Load more
+              </button>
+            )}
+          </div>
         </div>
       )}
 
@@ -133,7 +178,23 @@ const Dashboard: React.FC = () => {
               <p><strong>Qty:</strong> {selected.scanned_quantity}</p>
               <p><strong>Weight (kg):</strong> {selected.scanned_weight_kg}</p>
               <p><strong>Dimensions:</strong> {selected.scanned_dimensions.join(' × ')} cm</p>
-              <p><strong>Notes:</strong> {selected.notes || '—'}</p>
+              <div>
+                <strong>Reasons:</strong>
+                {selected.reasons && selected.reasons.length > 0 ? (
+                  <ul className="mt-1 space-y-1">
+                    {selected.reasons.map((r, i) => (
+                      <li key={i} className="text-xs">
+                        <span className={r.severity === 'critical' ? 'text-red-700' : r.severity === 'minor' ? 'text-orange-700' : 'text-yellow-700'}>
+                          {r.severity.toUpperCase()}
+                        </span>{' '}
+                        <code>{r.field}{r.axis !== undefined ? `[${r.axis}]` : ''}</code>: expected {r.expected}, observed {r.observed} (Δ {r.delta}, tolerance {r.tolerance})
+                      </li>
+                    ))}
+                  </ul>
+                ) : (
+                  <span> {selected.notes || '—'}</span>
+                )}
+              </div>
               <p><strong>Scan Time:</strong> {new Date(selected.scan_time).toLocaleString()}</p>
               <p><strong>Scan Hash:</strong> <code>{selected.scan_hash || '—'}</code></p>
               {selected.scan_hash && (
@@ -8,7 +8,7 @@ type ScanLog = {
   scanned_quantity: number;
   scanned_weight_kg: number;
   scanned_dimensions: number[];
-  result: 'match' | 'mismatch';
+  result: string;
   scan_hash: string | null;
   notes: string;
 };
@@ -43,9 +43,14 @@ const ScanSubmission: React.FC = () => {
 
       if (!res.ok) throw new Error(result.error || 'Failed to submit');
 
-      setStatus(result.result === 'match'
-        ? '✅ Scan matched successfully'
-        : `⚠️ Mismatch: ${result.reasons?.join(', ')}`);
+      const fields = result.reasons?.map((r: { field: string; axis?: number }) => (r.axis !== undefined ? `${r.field}[${r.axis}]` : r.field)).join(', ');
+      setStatus({
+        match: '✅ Scan matched successfully',
+        warning: `🟡 Matched, close to tolerance: ${fields}`,
+        minor_mismatch: `⚠️ Minor mismatch: ${fields}`,
+        critical_mismatch: `🚨 Critical mismatch: ${fields}`,
+        unknown_package: '❓ Unknown package: no metadata for this tracking ID',
+      }[result.result as string] || `⚠️ Mismatch: ${fields}`);
     } catch (err: any) {
       setStatus(`❌ Error: ${err.message}`);
     }
@@ -9,17 +9,63 @@ export interface ScanPayload {
     scanned_weight_kg: number;
     scanned_dimensions_cm: [number, number, number]; // width, height, depth
     location: string;
+    // Set by registered scanner devices only.
+    device_id?: string;
+    signed_at?: string;
+    signature?: string;
   }
   
   /**
-   * Response from scan submission, indicating match or mismatch.
+   * Graded scan outcome. `mismatch` is the ungraded result of older scans.
+   */
+  export type ScanResult =
+    | 'match'
+    | 'warning'
+    | 'minor_mismatch'
+    | 'critical_mismatch'
+    | 'unknown_package'
+    | 'mismatch';
+
+  /**
+   * Response from scan submission, with its graded outcome.
    */
   export interface ScanResponse {
     tracking_id: string;
-    result: 'match' | 'mismatch';
-    reasons: string[];
+    result: ScanResult;
+    reasons: MismatchReason[];
+    receipt?: ScanReceipt;
+  }
+
+  /**
+   * Server-signed proof that a scan was logged. `signature` is Ed25519
+   * over the RFC 8785 canonical JSON of the other fields.
+   */
+  export interface ScanReceipt {
+    version: string;
+    key_id: string;
+    tracking_id: string;
+    scan_hash: string;
+    hash_version: string;
+    scan_time: string;
+    result: ScanResult;
+    signature: string;
   }
   
+  /**
+   * One field of a scan that fell outside its tolerance.
+   */
+  export interface MismatchReason {
+    field: string;
+    /** Stored axis (0-2) of a dimensions_cm reason about one axis. */
+    axis?: number;
+    expected: number;
+    observed: number;
+    delta: number;
+    tolerance: string;
+    allowed: number;
+    severity: 'warning' | 'minor' | 'critical';
+  }
+
   /**
    * One scan entry in the full scan history log.
    */
@@ -30,10 +76,24 @@ export interface ScanPayload {
     scanned_quantity: number;
     scanned_weight_kg: number;
     scanned_dimensions: [number, number, number];
-    result: 'match' | 'mismatch';
+    dimension_permutation: number[] | null;
+    result: ScanResult;
+    reasons: MismatchReason[] | null;
     notes: string;
     location: string;
-    scan_hash: string | null;
+    scan_hash?: string;
+    hash_version?: string;
+    prev_scan_hash?: string;
+    device_id?: string;
+    batch_id?: string;
+  }
+
+  /**
+   * A point where a package's scan chain does not verify.
+   */
+  export interface ChainBreak {
+    scan_hash: string;
+    detail: string;
   }
   
   /**
@@ -42,6 +102,11 @@ export interface ScanPayload {
   export interface ScanHistoryResponse {
     tracking_id: string;
     history: ScanLogEntry[];
+    chain: {
+      valid: boolean;
+      length: number;
+      breaks: ChainBreak[];
+    };
   }
   
   /**
@@ -51,13 +116,22 @@ export interface ScanPayload {
     scan_hash: string;
   }
   
+  /**
+   * One sibling on the path from a scan hash to the Merkle root.
+   */
+  export interface ProofStep {
+    hash: string;
+    position: 'left' | 'right';
+  }
+
   /**
    * Response containing the Merkle proof for a scan hash.
    */
   export interface ProofResponse {
     scan_hash: string;
     root_hash: string;
-    proof: string[];
+    proof: ProofStep[];
+    hash_scheme?: string;
     tracking_id: string;
   }
   
@@ -67,7 +141,8 @@ export interface ScanPayload {
   export interface VerifyProofPayload {
     scan_hash: string;
     root_hash: string;
-    proof: string[];
+    proof: ProofStep[];
+    hash_scheme?: string;
   }
   
   /**